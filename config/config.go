@@ -0,0 +1,417 @@
+// Package config loads the application's settings from the environment once
+// at startup, so the rest of the code receives typed, validated values instead
+// of reading environment variables itself.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds every setting read from the environment
+type Config struct {
+	Server    ServerConfig
+	Database  DatabaseConfig
+	MinIO     MinIOConfig
+	Auth      AuthConfig
+	RateLimit RateLimitConfig
+	Upload    UploadConfig
+	Stream    StreamConfig
+	AccessLog AccessLogConfig
+}
+
+// ServerConfig covers the HTTP server and the middleware in front of every route
+type ServerConfig struct {
+	// Addr is the listen address, from ADDR or else PORT
+	Addr           string
+	GinMode        string
+	TrustedProxies []string
+	RequestTimeout time.Duration
+	// MaxJSONBodyBytes is the largest request body accepted outside of uploads
+	MaxJSONBodyBytes int64
+	ForceHTTPS       bool
+	// CanonicalHost is where FORCE_HTTPS redirects plain HTTP; empty rejects it
+	CanonicalHost string
+	// GzipLevel of zero disables response compression
+	GzipLevel         int
+	GzipMinSize       int
+	SlowRequest       time.Duration
+	SlowStreamRequest time.Duration
+	// CORSAllowedOrigins is empty when cross-origin access is off
+	CORSAllowedOrigins   []string
+	CORSMaxAge           time.Duration
+	CORSAllowCredentials bool
+	// CORSPublicAllowedOrigins applies to public and shared videos; empty
+	// leaves them under CORSAllowedOrigins
+	CORSPublicAllowedOrigins []string
+	ProblemJSON              bool
+	MaintenanceMode          bool
+	ReadOnlyMode             bool
+	// VideoAllowedReferers is empty when hotlink protection is off
+	VideoAllowedReferers []string
+	// PprofEnabled serves net/http/pprof to admins
+	PprofEnabled bool
+}
+
+// DatabaseConfig bounds how long startup waits for the database
+type DatabaseConfig struct {
+	ConnectAttempts int
+	ConnectMaxDelay time.Duration
+}
+
+// MinIOConfig locates and authenticates against the video store
+type MinIOConfig struct {
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	// Region is empty to let the client discover it
+	Region string
+	// RetryAttempts bounds how often a read failing with a transient error is tried
+	RetryAttempts int
+}
+
+// AuthConfig covers password hashing and JWTs
+type AuthConfig struct {
+	BcryptCost    int
+	JWTSecret     string
+	SigningMethod string
+	// Leeway tolerates clock skew between nodes when checking token times
+	Leeway     time.Duration
+	CookieName string
+	HeaderName string
+	// Scheme precedes the token in the header; empty expects the bare token
+	Scheme string
+	// IntrospectClientID and IntrospectClientSecret are the credential other
+	// services use for token introspection; an empty secret disables it
+	IntrospectClientID     string
+	IntrospectClientSecret string
+	// PasswordHistory is how many recent passwords a new one may not repeat; zero allows reuse
+	PasswordHistory int
+	// KeyRotationGrace is how long the signing key replaced by a rotation keeps
+	// verifying the tokens it signed
+	KeyRotationGrace time.Duration
+}
+
+// RateLimitConfig covers the per-client rate limits
+type RateLimitConfig struct {
+	Enabled bool
+	// AuthLimiter is "token" for a token bucket or "sliding" for a sliding window
+	AuthLimiter string
+	IPv4Prefix  int
+	IPv6Prefix  int
+	// MaxKeys caps the clients each limiter tracks; the least recently seen are evicted
+	MaxKeys int
+	// LoginPerEmail is the failed logins allowed per account and client
+	// network before one a minute; zero turns the per-account limit off
+	LoginPerEmail int
+}
+
+// UploadConfig covers video uploads
+type UploadConfig struct {
+	MaxConcurrent int
+	// QuotaMB is the default per-user quota; zero is unlimited
+	QuotaMB int
+	// SpoolMemory is how much of an upload is held in memory before spooling to disk
+	SpoolMemory int64
+	// TempDir is where uploads spool to; empty uses the system temp dir
+	TempDir string
+	// UserKeyPrefix stores each user's videos under their own key prefix
+	UserKeyPrefix bool
+	// ExpirySweepInterval is how often expired uploads are looked for
+	ExpirySweepInterval time.Duration
+	// AllowedTypes lists the content types uploads may have, such as video/mp4
+	// or video/*; empty allows any
+	AllowedTypes []string
+	// PartSize is the multipart upload part size in bytes; zero lets MinIO choose
+	PartSize uint64
+}
+
+// StreamConfig covers video playback
+type StreamConfig struct {
+	// BytesPerSecond limits each stream's egress; zero is unlimited
+	BytesPerSecond int
+	StatCacheTTL   time.Duration
+	// CacheMB sizes the segment cache; zero disables it
+	CacheMB    int
+	MaxPerUser int
+	// MaxRangeMB caps the bytes served for one Range request; zero is unlimited
+	MaxRangeMB int
+	// ContentTypes adds to or overrides the extension to type mapping used for
+	// objects stored as application/octet-stream
+	ContentTypes map[string]string
+}
+
+// AccessLogConfig covers the structured access log
+type AccessLogConfig struct {
+	// Path is empty to log to stderr
+	Path       string
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAgeDays int
+}
+
+// devJWTSecret signs tokens in debug and test mode when JWT_SECRET is unset.
+// It is public, so release mode refuses it.
+const devJWTSecret = "supersecretkey123"
+
+// Load reads the configuration from the environment, filling in defaults, and
+// validates it. All problems are reported together.
+func Load() (*Config, error) {
+	env := &reader{}
+
+	addr := env.string("ADDR", "")
+	if addr == "" {
+		addr = ":" + env.string("PORT", "8080")
+	}
+	trustedProxies := env.list("TRUSTED_PROXIES")
+	if len(trustedProxies) == 0 {
+		trustedProxies = []string{"127.0.0.1", "::1"}
+	}
+	ginMode := env.string("GIN_MODE", "release")
+	jwtSecret := env.string("JWT_SECRET", "")
+	if jwtSecret == "" && ginMode != "release" {
+		jwtSecret = devJWTSecret
+	}
+	scheme := env.string("JWT_AUTH_SCHEME", "Bearer")
+	if scheme == "none" {
+		scheme = ""
+	}
+
+	cfg := &Config{
+		Server: ServerConfig{
+			Addr:                     addr,
+			GinMode:                  ginMode,
+			TrustedProxies:           trustedProxies,
+			RequestTimeout:           env.seconds("REQUEST_TIMEOUT_SECONDS", 30),
+			MaxJSONBodyBytes:         int64(env.int("MAX_JSON_BODY_BYTES", 1<<20)),
+			ForceHTTPS:               env.bool("FORCE_HTTPS", false),
+			CanonicalHost:            env.string("CANONICAL_HOST", ""),
+			GzipLevel:                env.int("GZIP_LEVEL", -1),
+			GzipMinSize:              env.int("GZIP_MIN_SIZE", 1024),
+			SlowRequest:              time.Duration(env.int("SLOW_REQUEST_MS", 1000)) * time.Millisecond,
+			SlowStreamRequest:        time.Duration(env.int("SLOW_STREAM_REQUEST_MS", 300000)) * time.Millisecond,
+			CORSAllowedOrigins:       env.list("CORS_ALLOWED_ORIGINS"),
+			CORSMaxAge:               env.seconds("CORS_MAX_AGE_SECONDS", 0),
+			CORSAllowCredentials:     env.bool("CORS_ALLOW_CREDENTIALS", false),
+			CORSPublicAllowedOrigins: env.list("CORS_PUBLIC_ALLOWED_ORIGINS"),
+			ProblemJSON:              env.bool("PROBLEM_JSON", false),
+			MaintenanceMode:          env.bool("MAINTENANCE_MODE", false),
+			ReadOnlyMode:             env.bool("READ_ONLY_MODE", false),
+			VideoAllowedReferers:     env.list("VIDEO_ALLOWED_REFERERS"),
+			PprofEnabled:             env.bool("PPROF_ENABLED", false),
+		},
+		Database: DatabaseConfig{
+			ConnectAttempts: env.int("DB_CONNECT_ATTEMPTS", 10),
+			ConnectMaxDelay: env.seconds("DB_CONNECT_MAX_DELAY_SECONDS", 30),
+		},
+		MinIO: MinIOConfig{
+			Endpoint:      env.string("MINIO_ENDPOINT", "localhost:9000"),
+			AccessKey:     env.string("MINIO_ACCESS_KEY", ""),
+			SecretKey:     env.string("MINIO_SECRET_KEY", ""),
+			UseSSL:        env.bool("MINIO_USE_SSL", false),
+			Region:        env.string("MINIO_REGION", ""),
+			RetryAttempts: env.int("MINIO_RETRY_ATTEMPTS", 3),
+		},
+		Auth: AuthConfig{
+			BcryptCost:             env.int("BCRYPT_COST", 10),
+			JWTSecret:              jwtSecret,
+			SigningMethod:          env.string("JWT_SIGNING_METHOD", "HS256"),
+			Leeway:                 env.seconds("JWT_LEEWAY_SECONDS", 30),
+			CookieName:             env.string("JWT_COOKIE_NAME", "token"),
+			HeaderName:             env.string("JWT_HEADER_NAME", "Authorization"),
+			Scheme:                 scheme,
+			PasswordHistory:        env.int("PASSWORD_HISTORY", 5),
+			IntrospectClientID:     env.string("INTROSPECT_CLIENT_ID", "introspect"),
+			IntrospectClientSecret: env.string("INTROSPECT_CLIENT_SECRET", ""),
+			KeyRotationGrace:       env.seconds("JWT_ROTATION_GRACE_SECONDS", 86400),
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:       env.bool("RATE_LIMIT_ENABLED", true),
+			AuthLimiter:   env.string("AUTH_RATE_LIMITER", "token"),
+			IPv4Prefix:    env.int("RATE_LIMIT_IPV4_PREFIX", 32),
+			MaxKeys:       env.int("RATE_LIMIT_MAX_KEYS", 100000),
+			LoginPerEmail: env.int("LOGIN_ATTEMPTS_PER_EMAIL", 10),
+			IPv6Prefix:    env.int("RATE_LIMIT_IPV6_PREFIX", 64),
+		},
+		Upload: UploadConfig{
+			MaxConcurrent:       env.int("MAX_CONCURRENT_UPLOADS", 4),
+			QuotaMB:             env.int("UPLOAD_QUOTA_MB", 0),
+			SpoolMemory:         int64(env.int("UPLOAD_SPOOL_MEMORY_MB", 32)) << 20,
+			TempDir:             env.string("UPLOAD_TEMP_DIR", ""),
+			UserKeyPrefix:       env.bool("USER_KEY_PREFIX", false),
+			ExpirySweepInterval: env.seconds("UPLOAD_EXPIRY_SWEEP_SECONDS", 60),
+			AllowedTypes:        env.list("UPLOAD_ALLOWED_TYPES"),
+			PartSize:            uint64(env.int("UPLOAD_PART_SIZE_MB", 0)) << 20,
+		},
+		Stream: StreamConfig{
+			BytesPerSecond: env.int("STREAM_BYTES_PER_SECOND", 0),
+			StatCacheTTL:   env.seconds("STAT_CACHE_TTL_SECONDS", 5),
+			CacheMB:        env.int("STREAM_CACHE_MB", 0),
+			MaxPerUser:     env.int("STREAM_MAX_PER_USER", 8),
+			MaxRangeMB:     env.int("STREAM_MAX_RANGE_MB", 0),
+			ContentTypes:   env.pairs("CONTENT_TYPES"),
+		},
+		AccessLog: AccessLogConfig{
+			Path:       env.string("ACCESS_LOG_PATH", ""),
+			MaxSizeMB:  env.int("ACCESS_LOG_MAX_SIZE_MB", 100),
+			MaxBackups: env.int("ACCESS_LOG_MAX_BACKUPS", 5),
+			MaxAgeDays: env.int("ACCESS_LOG_MAX_AGE_DAYS", 30),
+		},
+	}
+
+	if err := errors.Join(append(env.errs, cfg.Validate())...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate reports every setting that is out of range or missing
+func (cfg *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(cfg.Server.Addr != "", "ADDR must not be empty")
+	switch cfg.Server.GinMode {
+	case "debug", "release", "test":
+	default:
+		check(false, "GIN_MODE must be debug, release or test, got %q", cfg.Server.GinMode)
+	}
+	check(cfg.Server.RequestTimeout > 0, "REQUEST_TIMEOUT_SECONDS must be positive")
+	check(cfg.Server.MaxJSONBodyBytes > 0, "MAX_JSON_BODY_BYTES must be positive")
+	// gzip.HuffmanOnly through gzip.BestCompression
+	check(cfg.Server.GzipLevel >= -2 && cfg.Server.GzipLevel <= 9, "GZIP_LEVEL must be between -2 and 9")
+	check(cfg.Server.GzipMinSize >= 0, "GZIP_MIN_SIZE must not be negative")
+	check(cfg.Server.SlowRequest >= 0, "SLOW_REQUEST_MS must not be negative")
+	check(cfg.Server.SlowStreamRequest >= 0, "SLOW_STREAM_REQUEST_MS must not be negative")
+	check(cfg.Server.CORSMaxAge >= 0, "CORS_MAX_AGE_SECONDS must not be negative")
+
+	check(cfg.Database.ConnectAttempts >= 1, "DB_CONNECT_ATTEMPTS must be at least 1")
+	check(cfg.Database.ConnectMaxDelay > 0, "DB_CONNECT_MAX_DELAY_SECONDS must be positive")
+
+	check(cfg.MinIO.Endpoint != "", "MINIO_ENDPOINT must not be empty")
+	check(cfg.MinIO.AccessKey != "", "MINIO_ACCESS_KEY is required")
+	check(cfg.MinIO.SecretKey != "", "MINIO_SECRET_KEY is required")
+	check(cfg.MinIO.RetryAttempts >= 1, "MINIO_RETRY_ATTEMPTS must be at least 1")
+
+	// bcrypt.MinCost through bcrypt.MaxCost
+	check(cfg.Auth.BcryptCost >= 4 && cfg.Auth.BcryptCost <= 31, "BCRYPT_COST must be between 4 and 31")
+	check(cfg.Auth.PasswordHistory >= 0, "PASSWORD_HISTORY must not be negative")
+	if cfg.Server.GinMode == "release" {
+		check(cfg.Auth.JWTSecret != "" && cfg.Auth.JWTSecret != devJWTSecret, "JWT_SECRET is required when GIN_MODE is release")
+	} else {
+		check(cfg.Auth.JWTSecret != "", "JWT_SECRET must not be empty")
+	}
+	switch cfg.Auth.SigningMethod {
+	case "HS256", "HS384", "HS512":
+	default:
+		check(false, "JWT_SIGNING_METHOD must be HS256, HS384 or HS512, got %q", cfg.Auth.SigningMethod)
+	}
+	check(cfg.Auth.Leeway >= 0, "JWT_LEEWAY_SECONDS must not be negative")
+	check(cfg.Auth.KeyRotationGrace >= 0, "JWT_ROTATION_GRACE_SECONDS must not be negative")
+	check(cfg.Auth.CookieName != "", "JWT_COOKIE_NAME must not be empty")
+	check(cfg.Auth.HeaderName != "", "JWT_HEADER_NAME must not be empty")
+
+	switch cfg.RateLimit.AuthLimiter {
+	case "token", "sliding":
+	default:
+		check(false, "AUTH_RATE_LIMITER must be token or sliding, got %q", cfg.RateLimit.AuthLimiter)
+	}
+	check(cfg.RateLimit.IPv4Prefix >= 1 && cfg.RateLimit.IPv4Prefix <= 32, "RATE_LIMIT_IPV4_PREFIX must be between 1 and 32")
+	check(cfg.RateLimit.IPv6Prefix >= 1 && cfg.RateLimit.IPv6Prefix <= 128, "RATE_LIMIT_IPV6_PREFIX must be between 1 and 128")
+	check(cfg.RateLimit.MaxKeys >= 1, "RATE_LIMIT_MAX_KEYS must be at least 1")
+	check(cfg.RateLimit.LoginPerEmail >= 0, "LOGIN_ATTEMPTS_PER_EMAIL must not be negative")
+
+	check(cfg.Upload.MaxConcurrent >= 1, "MAX_CONCURRENT_UPLOADS must be at least 1")
+	check(cfg.Upload.QuotaMB >= 0, "UPLOAD_QUOTA_MB must not be negative")
+	check(cfg.Upload.SpoolMemory >= 0, "UPLOAD_SPOOL_MEMORY_MB must not be negative")
+	check(cfg.Upload.ExpirySweepInterval > 0, "UPLOAD_EXPIRY_SWEEP_SECONDS must be positive")
+	// S3 parts are 5 MiB to 5 GiB
+	check(cfg.Upload.PartSize == 0 || cfg.Upload.PartSize >= 5<<20 && cfg.Upload.PartSize <= 5<<30,
+		"UPLOAD_PART_SIZE_MB must be 0 or between 5 and 5120")
+
+	check(cfg.Stream.BytesPerSecond >= 0, "STREAM_BYTES_PER_SECOND must not be negative")
+	check(cfg.Stream.StatCacheTTL >= 0, "STAT_CACHE_TTL_SECONDS must not be negative")
+	check(cfg.Stream.CacheMB >= 0, "STREAM_CACHE_MB must not be negative")
+	check(cfg.Stream.MaxPerUser >= 1, "STREAM_MAX_PER_USER must be at least 1")
+	check(cfg.Stream.MaxRangeMB >= 0, "STREAM_MAX_RANGE_MB must not be negative")
+
+	return errors.Join(errs...)
+}
+
+// reader parses environment variables, collecting malformed values
+type reader struct {
+	errs []error
+}
+
+func (r *reader) string(key, def string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return def
+}
+
+func (r *reader) int(key string, def int) int {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		r.errs = append(r.errs, fmt.Errorf("%s must be an integer, got %q", key, value))
+		return def
+	}
+	return n
+}
+
+func (r *reader) bool(key string, def bool) bool {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		r.errs = append(r.errs, fmt.Errorf("%s must be true or false, got %q", key, value))
+		return def
+	}
+	return b
+}
+
+// seconds reads a whole number of seconds
+func (r *reader) seconds(key string, def int) time.Duration {
+	return time.Duration(r.int(key, def)) * time.Second
+}
+
+// list splits a comma-separated value, dropping empty entries
+func (r *reader) list(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// pairs reads a comma-separated list of key=value entries
+func (r *reader) pairs(key string) map[string]string {
+	values := make(map[string]string)
+	for _, entry := range r.list(key) {
+		k, v, found := strings.Cut(entry, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !found || k == "" || v == "" {
+			r.errs = append(r.errs, fmt.Errorf("%s entries must be key=value, got %q", key, entry))
+			continue
+		}
+		values[k] = v
+	}
+	return values
+}
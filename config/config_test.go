@@ -0,0 +1,233 @@
+package config
+
+import (
+	"maps"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loadWith loads the configuration with the MinIO credentials set and env
+// applied on top
+func loadWith(t *testing.T, env map[string]string) (*Config, error) {
+	t.Helper()
+	t.Setenv("MINIO_ACCESS_KEY", "access")
+	t.Setenv("MINIO_SECRET_KEY", "secret")
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("GIN_MODE", "")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	return Load()
+}
+
+func TestJWTSecretRequiredInRelease(t *testing.T) {
+	_, err := loadWith(t, map[string]string{"GIN_MODE": "release"})
+	if err == nil || !strings.Contains(err.Error(), "JWT_SECRET") {
+		t.Fatalf("unset JWT_SECRET in release mode: got %v", err)
+	}
+
+	_, err = loadWith(t, map[string]string{"GIN_MODE": "release", "JWT_SECRET": devJWTSecret})
+	if err == nil || !strings.Contains(err.Error(), "JWT_SECRET") {
+		t.Fatalf("development JWT_SECRET in release mode: got %v", err)
+	}
+
+	cfg, err := loadWith(t, map[string]string{"GIN_MODE": "release", "JWT_SECRET": "production-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Auth.JWTSecret != "production-secret" {
+		t.Fatalf("got JWT secret %q", cfg.Auth.JWTSecret)
+	}
+}
+
+func TestJWTSecretDefaultsInDevelopment(t *testing.T) {
+	for _, mode := range []string{"debug", "test"} {
+		cfg, err := loadWith(t, map[string]string{"GIN_MODE": mode})
+		if err != nil {
+			t.Fatalf("%s mode: %v", mode, err)
+		}
+		if cfg.Auth.JWTSecret != devJWTSecret {
+			t.Fatalf("%s mode: got JWT secret %q, want the development one", mode, cfg.Auth.JWTSecret)
+		}
+	}
+}
+
+func TestGinMode(t *testing.T) {
+	cfg, err := loadWith(t, map[string]string{"JWT_SECRET": "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.GinMode != "release" {
+		t.Fatalf("default mode %q, want release", cfg.Server.GinMode)
+	}
+
+	cfg, err = loadWith(t, map[string]string{"GIN_MODE": "debug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.GinMode != "debug" {
+		t.Fatalf("got mode %q, want debug", cfg.Server.GinMode)
+	}
+
+	if _, err := loadWith(t, map[string]string{"GIN_MODE": "production"}); err == nil || !strings.Contains(err.Error(), "GIN_MODE") {
+		t.Fatalf("unknown mode: got %v", err)
+	}
+}
+
+func TestGzipSettings(t *testing.T) {
+	cfg, err := loadWith(t, map[string]string{"JWT_SECRET": "secret", "GZIP_LEVEL": "9", "GZIP_MIN_SIZE": "2048"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.GzipLevel != 9 || cfg.Server.GzipMinSize != 2048 {
+		t.Fatalf("got level %d and threshold %d", cfg.Server.GzipLevel, cfg.Server.GzipMinSize)
+	}
+
+	for _, env := range []map[string]string{{"GZIP_LEVEL": "10"}, {"GZIP_LEVEL": "-3"}, {"GZIP_MIN_SIZE": "-1"}} {
+		env["JWT_SECRET"] = "secret"
+		if _, err := loadWith(t, env); err == nil || !strings.Contains(err.Error(), "GZIP_") {
+			t.Fatalf("%v: got %v", env, err)
+		}
+	}
+}
+
+func TestMinIORegion(t *testing.T) {
+	cfg, err := loadWith(t, map[string]string{"JWT_SECRET": "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MinIO.Region != "" {
+		t.Fatalf("default region %q, want it left to the client", cfg.MinIO.Region)
+	}
+	cfg, err = loadWith(t, map[string]string{"JWT_SECRET": "secret", "MINIO_REGION": "eu-central-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MinIO.Region != "eu-central-1" {
+		t.Fatalf("got region %q", cfg.MinIO.Region)
+	}
+}
+
+func TestRateLimitEnabledByDefault(t *testing.T) {
+	cfg, err := loadWith(t, map[string]string{"JWT_SECRET": "secret", "RATE_LIMIT_ENABLED": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.RateLimit.Enabled {
+		t.Fatal("rate limiting off by default")
+	}
+	cfg, err = loadWith(t, map[string]string{"JWT_SECRET": "secret", "RATE_LIMIT_ENABLED": "false"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RateLimit.Enabled {
+		t.Fatal("RATE_LIMIT_ENABLED=false left rate limiting on")
+	}
+}
+
+func TestMinIORetryAttempts(t *testing.T) {
+	cfg, err := loadWith(t, map[string]string{"JWT_SECRET": "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MinIO.RetryAttempts != 3 {
+		t.Fatalf("got %d attempts by default, want 3", cfg.MinIO.RetryAttempts)
+	}
+	_, err = loadWith(t, map[string]string{"JWT_SECRET": "secret", "MINIO_RETRY_ATTEMPTS": "0"})
+	if err == nil || !strings.Contains(err.Error(), "MINIO_RETRY_ATTEMPTS") {
+		t.Fatalf("MINIO_RETRY_ATTEMPTS=0: got %v", err)
+	}
+}
+
+func TestPasswordHistory(t *testing.T) {
+	cfg, err := loadWith(t, map[string]string{"JWT_SECRET": "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Auth.PasswordHistory != 5 {
+		t.Fatalf("got a history of %d passwords by default, want 5", cfg.Auth.PasswordHistory)
+	}
+	_, err = loadWith(t, map[string]string{"JWT_SECRET": "secret", "PASSWORD_HISTORY": "-1"})
+	if err == nil || !strings.Contains(err.Error(), "PASSWORD_HISTORY") {
+		t.Fatalf("PASSWORD_HISTORY=-1: got %v", err)
+	}
+}
+
+func TestStreamMaxRange(t *testing.T) {
+	cfg, err := loadWith(t, map[string]string{"JWT_SECRET": "secret", "STREAM_MAX_RANGE_MB": "8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Stream.MaxRangeMB != 8 {
+		t.Fatalf("got a %d MB cap, want 8", cfg.Stream.MaxRangeMB)
+	}
+	_, err = loadWith(t, map[string]string{"JWT_SECRET": "secret", "STREAM_MAX_RANGE_MB": "-1"})
+	if err == nil || !strings.Contains(err.Error(), "STREAM_MAX_RANGE_MB") {
+		t.Fatalf("STREAM_MAX_RANGE_MB=-1: got %v", err)
+	}
+}
+
+func TestPprofDisabledByDefault(t *testing.T) {
+	cfg, err := loadWith(t, map[string]string{"JWT_SECRET": "secret", "PPROF_ENABLED": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.PprofEnabled {
+		t.Fatal("pprof enabled by default")
+	}
+	cfg, err = loadWith(t, map[string]string{"JWT_SECRET": "secret", "PPROF_ENABLED": "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Server.PprofEnabled {
+		t.Fatal("PPROF_ENABLED=true left pprof off")
+	}
+}
+
+func TestContentTypes(t *testing.T) {
+	cfg, err := loadWith(t, map[string]string{"JWT_SECRET": "secret", "CONTENT_TYPES": ".flv=video/x-flv, mkv = video/webm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{".flv": "video/x-flv", "mkv": "video/webm"}; !maps.Equal(cfg.Stream.ContentTypes, want) {
+		t.Fatalf("got %v, want %v", cfg.Stream.ContentTypes, want)
+	}
+	for _, value := range []string{".flv", ".flv=", "=video/x-flv"} {
+		_, err := loadWith(t, map[string]string{"JWT_SECRET": "secret", "CONTENT_TYPES": value})
+		if err == nil || !strings.Contains(err.Error(), "CONTENT_TYPES") {
+			t.Fatalf("CONTENT_TYPES=%q: got %v", value, err)
+		}
+	}
+}
+
+func TestUploadPartSize(t *testing.T) {
+	cfg, err := loadWith(t, map[string]string{"JWT_SECRET": "secret", "UPLOAD_PART_SIZE_MB": "64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Upload.PartSize != 64<<20 {
+		t.Fatalf("got %d byte parts, want 64 MiB", cfg.Upload.PartSize)
+	}
+	for _, value := range []string{"4", "5121", "-1"} {
+		_, err := loadWith(t, map[string]string{"JWT_SECRET": "secret", "UPLOAD_PART_SIZE_MB": value})
+		if err == nil || !strings.Contains(err.Error(), "UPLOAD_PART_SIZE_MB") {
+			t.Fatalf("UPLOAD_PART_SIZE_MB=%s: got %v", value, err)
+		}
+	}
+}
+
+func TestJWTTimings(t *testing.T) {
+	cfg, err := loadWith(t, map[string]string{"JWT_SECRET": "secret", "JWT_LEEWAY_SECONDS": "5", "JWT_ROTATION_GRACE_SECONDS": "3600"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Auth.Leeway != 5*time.Second || cfg.Auth.KeyRotationGrace != time.Hour {
+		t.Fatalf("got leeway %v and rotation grace %v", cfg.Auth.Leeway, cfg.Auth.KeyRotationGrace)
+	}
+	// Like every other timing setting, these are whole seconds
+	_, err = loadWith(t, map[string]string{"JWT_SECRET": "secret", "JWT_LEEWAY_SECONDS": "30s"})
+	if err == nil || !strings.Contains(err.Error(), "JWT_LEEWAY_SECONDS") {
+		t.Fatalf("JWT_LEEWAY_SECONDS=30s: got %v", err)
+	}
+}
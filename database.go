@@ -0,0 +1,30 @@
+package main
+
+import (
+	"config"
+	"fmt"
+	"log"
+	"time"
+)
+
+const initialDBConnectDelay = 500 * time.Millisecond
+
+// connectWithRetry calls connect until it succeeds, doubling the wait between
+// attempts up to cfg.ConnectMaxDelay, and returns the last error after
+// cfg.ConnectAttempts failures. sleep is time.Sleep outside of tests.
+func connectWithRetry(connect func() error, cfg config.DatabaseConfig, sleep func(time.Duration)) error {
+	delay := initialDBConnectDelay
+	var err error
+	for attempt := 1; attempt <= cfg.ConnectAttempts; attempt++ {
+		if err = connect(); err == nil {
+			return nil
+		}
+		if attempt == cfg.ConnectAttempts {
+			break
+		}
+		log.Printf("Database unavailable (attempt %d/%d), retrying in %v: %v\n", attempt, cfg.ConnectAttempts, delay, err)
+		sleep(delay)
+		delay = min(delay*2, cfg.ConnectMaxDelay)
+	}
+	return fmt.Errorf("connecting to database after %d attempts: %w", cfg.ConnectAttempts, err)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"config"
+)
+
+func TestConnectWithRetry(t *testing.T) {
+	cfg := config.DatabaseConfig{ConnectAttempts: 5, ConnectMaxDelay: 2 * time.Second}
+	unavailable := errors.New("connection refused")
+
+	tests := []struct {
+		name       string
+		failures   int
+		wantErr    bool
+		wantSleeps []time.Duration
+	}{
+		{"first attempt", 0, false, nil},
+		{"after retries", 3, false, []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second}},
+		// The delay stops doubling at ConnectMaxDelay, and there is no wait after the last attempt
+		{"gives up", 5, true, []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 2 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			var sleeps []time.Duration
+			err := connectWithRetry(func() error {
+				attempts++
+				if attempts <= tt.failures {
+					return unavailable
+				}
+				return nil
+			}, cfg, func(d time.Duration) { sleeps = append(sleeps, d) })
+
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("got error %v, want error: %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, unavailable) {
+				t.Fatalf("error %v does not wrap the last connection error", err)
+			}
+			if !slices.Equal(sleeps, tt.wantSleeps) {
+				t.Fatalf("slept %v, want %v", sleeps, tt.wantSleeps)
+			}
+		})
+	}
+}
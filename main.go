@@ -1,16 +1,30 @@
 package main
 
 import (
+	"config"
+	"context"
 	"db"
+	"log"
 	"router"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
-	gin.SetMode(gin.ReleaseMode)
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	gin.SetMode(cfg.Server.GinMode)
+	shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	database := db.NewClient()
-	if err := database.Connect(); err != nil {
+	if err := connectWithRetry(database.Connect, cfg.Database, time.Sleep); err != nil {
 		panic(err)
 	}
 	defer func() {
@@ -21,6 +35,6 @@ func main() {
 
 	// Public group
 
-	r := router.SetupRouter(database)
-	r.Run() // default :8080
+	r := router.SetupRouter(context.Background(), database, cfg)
+	r.Run(cfg.Server.Addr)
 }
@@ -1,7 +1,11 @@
 package middlewares
 
 import (
+	"errors"
 	"net/http"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -9,67 +13,267 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// passwordCost is the bcrypt cost used for new hashes, set by Configure
+var passwordCost = bcrypt.DefaultCost
+
 // hashPassword takes a plain password and returns the bcrypt hash.
+// The cost is embedded in the hash, so hashes made at other costs still verify.
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
 	return string(bytes), err
 }
 
+// NeedsRehash reports whether a bcrypt hash was made at a cost other than the configured one.
+func NeedsRehash(hashed string) bool {
+	cost, err := bcrypt.Cost([]byte(hashed))
+	return err == nil && cost != passwordCost
+}
+
 // checkPassword compares a bcrypt-hashed password with its possible plaintext equivalent.
 func CheckPassword(hashed, password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password))
 	return err == nil
 }
 
-// You’d normally load this from env/config
-var jwtSecret = []byte("supersecretkey123")
+// signingMethod is the HMAC variant tokens are signed and verified with
+var signingMethod = jwt.SigningMethodHS256
+
+// signingMethodFor returns the HMAC variant named HS256, HS384 or HS512,
+// defaulting to HS256.
+func signingMethodFor(name string) *jwt.SigningMethodHMAC {
+	switch name {
+	case "HS384":
+		return jwt.SigningMethodHS384
+	case "HS512":
+		return jwt.SigningMethodHS512
+	default:
+		return jwt.SigningMethodHS256
+	}
+}
 
-// Claims defines the JWT payload
+// Claims defines the JWT payload. Name is empty in tokens issued before it was added.
 type Claims struct {
 	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// generateToken creates a JWT for a given username
-func GenerateToken(email string) (string, error) {
+// generateToken creates a JWT for a given user, limited to the given
+// audiences if any (see RequireAudience)
+func GenerateToken(email, name string, audience ...string) (string, error) {
 	claims := &Claims{
 		Email: email,
+		Name:  name,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenLifetime)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "myapp",
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	if len(audience) > 0 {
+		claims.Audience = audience
+	}
+	return signingKeys.signToken(jwt.NewWithClaims(signingMethod, claims))
+}
+
+func init() {
+	// Issue times carry microseconds, so a token issued just before a
+	// revocation is told apart from one issued by logging in right after it
+	jwt.TimePrecision = time.Microsecond
+}
+
+// tokenLifetime is how long an issued token stays valid
+const tokenLifetime = 24 * time.Hour
+
+// revocations maps an email to the time its tokens were revoked
+var revocations = struct {
+	sync.Mutex
+	revokedAt map[string]time.Time
+}{revokedAt: make(map[string]time.Time)}
+
+// RevokeTokens invalidates every token issued to email up to now
+func RevokeTokens(email string) {
+	revocations.Lock()
+	defer revocations.Unlock()
+
+	now := time.Now()
+	// Entries older than a token lifetime can no longer match a valid token
+	for key, revokedAt := range revocations.revokedAt {
+		if now.Sub(revokedAt) > tokenLifetime {
+			delete(revocations.revokedAt, key)
+		}
+	}
+	revocations.revokedAt[email] = now
+}
+
+// isRevoked reports whether the token was issued before its email was revoked
+func isRevoked(claims *Claims) bool {
+	revocations.Lock()
+	defer revocations.Unlock()
+
+	revokedAt, ok := revocations.revokedAt[claims.Email]
+	if !ok {
+		return false
+	}
+	return claims.IssuedAt == nil || claims.IssuedAt.Before(revokedAt)
+}
+
+// jwtLeeway tolerates clock skew between nodes when checking token times
+var jwtLeeway = 30 * time.Second
+
+// signingKey is the jwt.Keyfunc for our tokens. It verifies the signing
+// method, so other HMAC variants are rejected too, and picks the key named by
+// the kid header.
+func signingKey(t *jwt.Token) (interface{}, error) {
+	if t.Method.Alg() != signingMethod.Alg() {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	kid, _ := t.Header["kid"].(string)
+	secret, ok := signingKeys.verificationKey(kid, time.Now())
+	if !ok {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return secret, nil
+}
+
+// validTimes checks the token's time claims against now, allowing jwtLeeway
+// of skew. An expiry is required; tokens without one are never accepted.
+func validTimes(claims *jwt.RegisteredClaims, now time.Time) bool {
+	if claims.ExpiresAt == nil || !claims.ExpiresAt.After(now.Add(-jwtLeeway)) {
+		return false
+	}
+	if claims.NotBefore != nil && claims.NotBefore.After(now.Add(jwtLeeway)) {
+		return false
+	}
+	if claims.IssuedAt != nil && claims.IssuedAt.After(now.Add(jwtLeeway)) {
+		return false
+	}
+	return true
+}
+
+// tokenCookieName is the cookie browsers send the JWT in
+var tokenCookieName = "token"
+
+// SetTokenCookie stores the token in a Secure, HttpOnly, SameSite=Strict cookie
+// so browser clients never have to expose it to scripts.
+func SetTokenCookie(c *gin.Context, token string) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(tokenCookieName, token, int(tokenLifetime.Seconds()), "/", "", true, true)
+}
+
+// ClearTokenCookie tells the browser to drop the token cookie.
+func ClearTokenCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(tokenCookieName, "", -1, "/", "", true, true)
+}
+
+// HasTokenCookie reports whether the request carried the token cookie.
+func HasTokenCookie(c *gin.Context) bool {
+	_, err := c.Cookie(tokenCookieName)
+	return err == nil
+}
+
+// tokenHeaderName is the request header carrying the JWT
+var tokenHeaderName = "Authorization"
+
+// TokenHeaderName returns the request header the JWT is read from
+func TokenHeaderName() string {
+	return tokenHeaderName
+}
+
+// tokenScheme is the scheme the JWT is prefixed with in the header; empty
+// expects the bare token.
+var tokenScheme = "Bearer"
+
+// tokenFromRequest returns the JWT from the token header, falling back to the
+// token cookie when no header was sent.
+func tokenFromRequest(c *gin.Context) (string, bool) {
+	authHeader := c.GetHeader(tokenHeaderName)
+	if authHeader == "" {
+		token, err := c.Cookie(tokenCookieName)
+		return token, err == nil && token != ""
+	}
+	if tokenScheme == "" {
+		return authHeader, true
+	}
+	// Expect header in format "<scheme> <token>"; schemes are case-insensitive
+	scheme, token, found := strings.Cut(authHeader, " ")
+	if !found || !strings.EqualFold(scheme, tokenScheme) || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// Reasons ValidateToken rejects a token
+var (
+	ErrInvalidToken = errors.New("invalid or expired token")
+	ErrRevokedToken = errors.New("token has been revoked")
+)
+
+// ValidateToken checks an API token's signature, times and revocation and
+// returns its claims. Stream tokens are rejected, as they only grant access to
+// a single video.
+func ValidateToken(tokenStr string) (*Claims, error) {
+	claims := &Claims{}
+	// Time-based claims are checked below with leeway, which jwt/v4 cannot do itself
+	token, err := jwt.ParseWithClaims(tokenStr, claims, signingKey, jwt.WithoutClaimsValidation())
+	if err != nil || !token.Valid || !validTimes(&claims.RegisteredClaims, time.Now()) ||
+		claims.VerifyAudience(streamTokenAudience, true) {
+		return nil, ErrInvalidToken
+	}
+	if isRevoked(claims) {
+		return nil, ErrRevokedToken
+	}
+	return claims, nil
 }
 
 // jwtMiddleware checks the JWT on incoming requests
 func JwtMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		// Expect header in format "Bearer <token>"
-		if authHeader == "" || len(authHeader) < 7 || authHeader[:7] != "Bearer " {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing or malformed token"})
+		tokenStr, ok := tokenFromRequest(c)
+		if !ok {
+			abortWithProblem(c, http.StatusUnauthorized, CodeUnauthorized, "missing or malformed token")
 			return
 		}
-		tokenStr := authHeader[7:]
-
-		token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(t *jwt.Token) (interface{}, error) {
-			// verify signing method
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return jwtSecret, nil
-		})
-		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+
+		claims, err := ValidateToken(tokenStr)
+		if err != nil {
+			abortWithProblem(c, http.StatusUnauthorized, CodeUnauthorized, err.Error())
 			return
 		}
 
 		// store claims in context if you need them downstream
-		if claims, ok := token.Claims.(*Claims); ok {
-			c.Set("email", claims.Email)
+		c.Set("email", claims.Email)
+		c.Set("name", claims.Name)
+		c.Set("audience", []string(claims.Audience))
+		if claims.ExpiresAt != nil {
+			c.Set("tokenExpiresAt", claims.ExpiresAt.Time)
+		}
+		c.Next()
+	}
+}
+
+// Audiences that scope a token to part of the API. Tokens from login carry no
+// audience and reach every route.
+const (
+	// AudienceVideos is for the video routes
+	AudienceVideos = "videos"
+	// AudienceAccount is for the profile and account routes
+	AudienceAccount = "account"
+	// AudienceAdmin guards the admin routes. Scoped tokens are never issued
+	// for it, so only unscoped tokens reach them.
+	AudienceAdmin = "admin"
+)
+
+// RequireAudience limits the route group to tokens whose aud claim includes
+// aud, and to unscoped tokens. It must follow JwtMiddleware and answers 403 to
+// tokens scoped to other audiences.
+func RequireAudience(aud string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenAudience := c.GetStringSlice("audience")
+		if len(tokenAudience) > 0 && !slices.Contains(tokenAudience, aud) {
+			abortWithProblem(c, http.StatusForbidden, CodeForbidden, "token not valid for this audience")
+			return
 		}
 		c.Next()
 	}
@@ -0,0 +1,361 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// signedToken signs claims for email issued at issuedAt with the current key
+func signedToken(t *testing.T, email string, issuedAt time.Time) string {
+	t.Helper()
+	token, err := signingKeys.signToken(jwt.NewWithClaims(signingMethod, &Claims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// signClaims signs claims with the current key
+func signClaims(t *testing.T, claims *Claims) string {
+	t.Helper()
+	token, err := signingKeys.signToken(jwt.NewWithClaims(signingMethod, claims))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestTokensWithoutExpiryAreRejected(t *testing.T) {
+	now := time.Now()
+	forever := signClaims(t, &Claims{
+		Email:            "user@example.com",
+		RegisteredClaims: jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(now)},
+	})
+	if _, err := ValidateToken(forever); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("token without exp: got %v, want ErrInvalidToken", err)
+	}
+	if _, err := ValidateToken(signedToken(t, "user@example.com", now)); err != nil {
+		t.Fatalf("token with exp: %v", err)
+	}
+}
+
+func TestRevokeTokens(t *testing.T) {
+	email := "revoked@example.com"
+	before := signedToken(t, email, time.Now().Add(-2*time.Second))
+	// A token minted just before the revocation, likely in the same second
+	sameSecond, err := GenerateToken(email, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	RevokeTokens(email)
+
+	if _, err := ValidateToken(before); !errors.Is(err, ErrRevokedToken) {
+		t.Fatalf("token issued before the revocation: got %v, want ErrRevokedToken", err)
+	}
+	if _, err := ValidateToken(sameSecond); !errors.Is(err, ErrRevokedToken) {
+		t.Fatalf("token issued just before the revocation: got %v, want ErrRevokedToken", err)
+	}
+	// Logging in again right away is told apart by the microseconds of iat
+	time.Sleep(time.Millisecond)
+	after, err := GenerateToken(email, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(after); err != nil {
+		t.Fatalf("token issued right after the revocation: %v", err)
+	}
+	if _, err := ValidateToken(signedToken(t, "other@example.com", time.Now().Add(-2*time.Second))); err != nil {
+		t.Fatalf("other users' tokens: %v", err)
+	}
+}
+
+func TestRequireAudience(t *testing.T) {
+	r := gin.New()
+	r.Use(JwtMiddleware())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/videos", RequireAudience(AudienceVideos), ok)
+	r.GET("/account", RequireAudience(AudienceAccount), ok)
+
+	unscoped, err := GenerateToken("user@example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	videosOnly, err := GenerateToken("user@example.com", "", AudienceVideos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		token string
+		path  string
+		want  int
+	}{
+		{"unscoped on videos", unscoped, "/videos", http.StatusOK},
+		{"unscoped on account", unscoped, "/account", http.StatusOK},
+		{"videos token on videos", videosOnly, "/videos", http.StatusOK},
+		{"videos token on account", videosOnly, "/account", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("got %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+// setPasswordCost sets the configured bcrypt cost until the test ends
+func setPasswordCost(t *testing.T, cost int) {
+	t.Helper()
+	previous := passwordCost
+	passwordCost = cost
+	t.Cleanup(func() { passwordCost = previous })
+}
+
+func TestHashPasswordUsesConfiguredCost(t *testing.T) {
+	setPasswordCost(t, 5)
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost, err := bcrypt.Cost([]byte(hash)); err != nil || cost != 5 {
+		t.Fatalf("got cost %d, %v; want 5", cost, err)
+	}
+	if !CheckPassword(hash, "correct horse") || CheckPassword(hash, "wrong horse") {
+		t.Fatal("hash does not verify the password")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	setPasswordCost(t, 4)
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if NeedsRehash(hash) {
+		t.Fatal("hash at the configured cost needs rehashing")
+	}
+	passwordCost = 5
+	if !NeedsRehash(hash) {
+		t.Fatal("hash at an outdated cost does not need rehashing")
+	}
+	if NeedsRehash("not a bcrypt hash") {
+		t.Fatal("malformed hash needs rehashing")
+	}
+}
+
+func TestLeeway(t *testing.T) {
+	previous := jwtLeeway
+	jwtLeeway = 30 * time.Second
+	t.Cleanup(func() { jwtLeeway = previous })
+
+	now := time.Now()
+	at := func(offset time.Duration) *jwt.NumericDate { return jwt.NewNumericDate(now.Add(offset)) }
+	hour := at(time.Hour)
+	tests := []struct {
+		name   string
+		claims jwt.RegisteredClaims
+		want   bool
+	}{
+		{"expired within leeway", jwt.RegisteredClaims{ExpiresAt: at(-10 * time.Second)}, true},
+		{"expired beyond leeway", jwt.RegisteredClaims{ExpiresAt: at(-40 * time.Second)}, false},
+		{"not yet valid within leeway", jwt.RegisteredClaims{ExpiresAt: hour, NotBefore: at(10 * time.Second)}, true},
+		{"not yet valid beyond leeway", jwt.RegisteredClaims{ExpiresAt: hour, NotBefore: at(40 * time.Second)}, false},
+		{"issued ahead within leeway", jwt.RegisteredClaims{ExpiresAt: hour, IssuedAt: at(10 * time.Second)}, true},
+		{"issued ahead beyond leeway", jwt.RegisteredClaims{ExpiresAt: hour, IssuedAt: at(40 * time.Second)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validTimes(&tt.claims, now); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// authStatus sends a request through JwtMiddleware with the given headers and
+// cookies and returns the status
+func authStatus(headers map[string]string, cookies ...*http.Cookie) int {
+	r := gin.New()
+	r.GET("/", JwtMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestTokenCookie(t *testing.T) {
+	token, err := GenerateToken("user@example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookie := &http.Cookie{Name: "token", Value: token}
+	tests := []struct {
+		name    string
+		headers map[string]string
+		cookies []*http.Cookie
+		want    int
+	}{
+		{"header", map[string]string{"Authorization": "Bearer " + token}, nil, http.StatusOK},
+		{"scheme in lowercase", map[string]string{"Authorization": "bearer " + token}, nil, http.StatusOK},
+		{"cookie", nil, []*http.Cookie{cookie}, http.StatusOK},
+		{"header wins over cookie", map[string]string{"Authorization": "Bearer invalid"}, []*http.Cookie{cookie}, http.StatusUnauthorized},
+		{"empty cookie", nil, []*http.Cookie{{Name: "token", Value: ""}}, http.StatusUnauthorized},
+		{"neither", nil, nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := authStatus(tt.headers, tt.cookies...); got != tt.want {
+				t.Fatalf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	SetTokenCookie(c, token)
+	set := w.Result().Cookies()
+	if len(set) != 1 || set[0].Value != token || !set[0].HttpOnly || !set[0].Secure || set[0].SameSite != http.SameSiteStrictMode {
+		t.Fatalf("got cookies %+v, want one Secure, HttpOnly, SameSite=Strict token cookie", set)
+	}
+}
+
+func TestSigningMethods(t *testing.T) {
+	previous := signingMethod
+	t.Cleanup(func() { signingMethod = previous })
+
+	tokens := make(map[string]string)
+	for _, name := range []string{"HS256", "HS384", "HS512"} {
+		signingMethod = signingMethodFor(name)
+		token, err := GenerateToken("user@example.com", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if alg := parsed.Method.Alg(); alg != name {
+			t.Fatalf("configured %s, signed with %s", name, alg)
+		}
+		if _, err := ValidateToken(token); err != nil {
+			t.Fatalf("%s token: %v", name, err)
+		}
+		tokens[name] = token
+	}
+
+	// Tokens signed with the same key but another HMAC variant are rejected
+	signingMethod = jwt.SigningMethodHS512
+	for _, name := range []string{"HS256", "HS384"} {
+		if _, err := ValidateToken(tokens[name]); err == nil {
+			t.Fatalf("%s token accepted while HS512 is configured", name)
+		}
+		if got := authStatus(map[string]string{"Authorization": "Bearer " + tokens[name]}); got != http.StatusUnauthorized {
+			t.Fatalf("%s token through JwtMiddleware: got %d, want 401", name, got)
+		}
+	}
+}
+
+func TestCustomTokenHeader(t *testing.T) {
+	previousHeader, previousScheme, previousCookie := tokenHeaderName, tokenScheme, tokenCookieName
+	t.Cleanup(func() {
+		tokenHeaderName, tokenScheme, tokenCookieName = previousHeader, previousScheme, previousCookie
+	})
+	token, err := GenerateToken("user@example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokenHeaderName, tokenScheme, tokenCookieName = "X-Gateway-Auth", "JWT", "session"
+	tests := []struct {
+		name    string
+		headers map[string]string
+		cookies []*http.Cookie
+		want    int
+	}{
+		{"custom header and scheme", map[string]string{"X-Gateway-Auth": "JWT " + token}, nil, http.StatusOK},
+		{"custom cookie", nil, []*http.Cookie{{Name: "session", Value: token}}, http.StatusOK},
+		{"default scheme", map[string]string{"X-Gateway-Auth": "Bearer " + token}, nil, http.StatusUnauthorized},
+		{"default header", map[string]string{"Authorization": "JWT " + token}, nil, http.StatusUnauthorized},
+		{"default cookie", nil, []*http.Cookie{{Name: "token", Value: token}}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := authStatus(tt.headers, tt.cookies...); got != tt.want {
+				t.Fatalf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// Without a scheme the header holds the bare token
+	tokenScheme = ""
+	if got := authStatus(map[string]string{"X-Gateway-Auth": token}); got != http.StatusOK {
+		t.Fatalf("bare token: got %d, want 200", got)
+	}
+	if got := authStatus(map[string]string{"X-Gateway-Auth": "Bearer " + token}); got != http.StatusUnauthorized {
+		t.Fatalf("prefixed token without a scheme: got %d, want 401", got)
+	}
+}
+
+func TestNameClaim(t *testing.T) {
+	r := gin.New()
+	r.Use(JwtMiddleware())
+	r.GET("/whoami", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("email")+" "+c.GetString("name"))
+	})
+	whoami := func(token string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want 200", w.Code)
+		}
+		return w.Body.String()
+	}
+
+	token, err := GenerateToken("user@example.com", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Name != "user" {
+		t.Fatalf("name claim is %q, want user", claims.Name)
+	}
+	if got := whoami(token); got != "user@example.com user" {
+		t.Fatalf("context holds %q, want the email and name", got)
+	}
+
+	// Tokens issued before the claim was added are still accepted, without a name
+	if got := whoami(signedToken(t, "user@example.com", time.Now())); got != "user@example.com " {
+		t.Fatalf("token without a name claim: context holds %q", got)
+	}
+}
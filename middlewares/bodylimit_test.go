@@ -0,0 +1,64 @@
+package middlewares
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func bodyLimitRouter(limit int64) *gin.Engine {
+	r := gin.New()
+	r.Use(BodyLimitMiddleware(limit, "POST /upload"))
+	echo := func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.String(http.StatusOK, string(body))
+	}
+	r.POST("/json", echo)
+	r.POST("/upload", echo)
+	return r
+}
+
+func TestBodyLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		chunked     bool
+		want        int
+	}{
+		{"small JSON", "/json", "application/json", `{"a":1}`, false, http.StatusOK},
+		{"large JSON", "/json", "application/json", strings.Repeat("a", 11), false, http.StatusRequestEntityTooLarge},
+		{"large text/plain", "/json", "text/plain", strings.Repeat("a", 11), false, http.StatusRequestEntityTooLarge},
+		{"large without Content-Type", "/json", "", strings.Repeat("a", 11), false, http.StatusRequestEntityTooLarge},
+		{"large chunked", "/json", "application/json", strings.Repeat("a", 11), true, http.StatusRequestEntityTooLarge},
+		{"large on exempt route", "/upload", "multipart/form-data", strings.Repeat("a", 11), false, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			bodyLimitRouter(10).ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("got %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want == http.StatusOK && w.Body.String() != tt.body {
+				t.Fatalf("handler read %q, want %q", w.Body, tt.body)
+			}
+		})
+	}
+}
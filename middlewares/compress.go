@@ -0,0 +1,162 @@
+package middlewares
+
+import (
+	"bytes"
+	"compress/gzip"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gzipWriter holds the response back until it reaches minSize bytes, then
+// compresses it. Responses that finish below minSize are sent as they are.
+type gzipWriter struct {
+	gin.ResponseWriter
+	level   int
+	minSize int
+	status  int
+	buffer  bytes.Buffer
+	gz      *gzip.Writer
+	started bool
+	// disabled is set through DisableCompression
+	disabled bool
+}
+
+func (w *gzipWriter) WriteHeader(code int) {
+	if !w.started {
+		w.status = code
+	}
+}
+
+// WriteHeaderNow is deferred until the compression decision is made
+func (w *gzipWriter) WriteHeaderNow() {}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if w.started {
+		if w.gz != nil {
+			return w.gz.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+	w.buffer.Write(b)
+	if w.disabled || w.buffer.Len() >= w.minSize {
+		if err := w.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *gzipWriter) Status() int {
+	return w.status
+}
+
+func (w *gzipWriter) Written() bool {
+	return w.started || w.buffer.Len() > 0
+}
+
+// Flush sends what is buffered, uncompressed if the threshold was not reached.
+func (w *gzipWriter) Flush() {
+	if !w.started {
+		w.start(false)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// start writes the status and headers, compressing from here on if asked
+// and the handler has not encoded the body itself, then sends the buffer.
+func (w *gzipWriter) start(compress bool) error {
+	w.started = true
+	header := w.ResponseWriter.Header()
+	if compress && !w.disabled && header.Get("Content-Encoding") == "" {
+		header.Set("Content-Encoding", "gzip")
+		header.Add("Vary", "Accept-Encoding")
+		header.Del("Content-Length")
+		// The level was validated by GzipMiddleware
+		w.gz, _ = gzip.NewWriterLevel(w.ResponseWriter, w.level)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.buffer.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(w.buffer.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buffer.Bytes())
+	}
+	w.buffer.Reset()
+	return err
+}
+
+// finish sends a response that stayed below the threshold and closes the gzip stream.
+func (w *gzipWriter) finish() {
+	if !w.started {
+		w.start(false)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
+
+// DisableCompression makes sure the response written to w goes out as it is,
+// whatever the client accepts. Handlers writing binary or ranged bodies call
+// it before writing; it has no effect once the response has started or when
+// no compression is in place.
+func DisableCompression(w http.ResponseWriter) {
+	if gz, ok := w.(*gzipWriter); ok && !gz.started {
+		gz.disabled = true
+	}
+}
+
+// NoCompression opts a route out of GzipMiddleware.
+func NoCompression() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		DisableCompression(c.Writer)
+		c.Next()
+	}
+}
+
+// GzipMiddleware compresses responses of at least minSize bytes at the given
+// gzip level for clients accepting gzip. Routes in exempt (by full path), such
+// as video streams, are never compressed.
+func GzipMiddleware(level, minSize int, exempt ...string) gin.HandlerFunc {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		log.Printf("Invalid gzip level %d; using the default\n", level)
+		level = gzip.DefaultCompression
+	}
+	skip := make(map[string]bool, len(exempt))
+	for _, path := range exempt {
+		skip[path] = true
+	}
+
+	return func(c *gin.Context) {
+		if skip[c.FullPath()] || c.Request.Method == http.MethodHead ||
+			!strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+			c.Next()
+			return
+		}
+
+		original := c.Writer
+		writer := &gzipWriter{
+			ResponseWriter: original,
+			level:          level,
+			minSize:        minSize,
+			status:         http.StatusOK,
+		}
+		c.Writer = writer
+		// On a panic the buffer is dropped so the recovery response goes out uncompressed
+		defer func() { c.Writer = original }()
+		c.Next()
+		writer.finish()
+	}
+}
@@ -0,0 +1,80 @@
+package middlewares
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gzipped compresses body at level, as the middleware should
+func gzipped(t *testing.T, body string, level int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(gz, body)
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestGzipMiddleware(t *testing.T) {
+	large := strings.Repeat("compressible response ", 100)
+	newRouter := func(level int) *gin.Engine {
+		r := gin.New()
+		r.Use(GzipMiddleware(level, 1024, "/api/video"))
+		r.GET("/small", func(c *gin.Context) { c.String(http.StatusOK, "small") })
+		r.GET("/large", func(c *gin.Context) { c.String(http.StatusOK, large) })
+		r.GET("/api/video", func(c *gin.Context) { c.String(http.StatusOK, large) })
+		r.GET("/raw", NoCompression(), func(c *gin.Context) { c.String(http.StatusOK, large) })
+		return r
+	}
+	get := func(r *gin.Engine, path string, acceptGzip bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptGzip {
+			req.Header.Set("Accept-Encoding", "gzip, deflate")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, level := range []int{gzip.BestSpeed, gzip.BestCompression} {
+		w := get(newRouter(level), "/large", true)
+		if w.Header().Get("Content-Encoding") != "gzip" {
+			t.Fatalf("level %d: large body not compressed", level)
+		}
+		if !bytes.Equal(w.Body.Bytes(), gzipped(t, large, level)) {
+			t.Fatalf("level %d: body not compressed at the configured level", level)
+		}
+	}
+
+	r := newRouter(gzip.DefaultCompression)
+	tests := []struct {
+		name       string
+		path       string
+		acceptGzip bool
+		want       string
+	}{
+		{"below the threshold", "/small", true, "small"},
+		{"client without gzip", "/large", false, large},
+		{"streaming route", "/api/video", true, large},
+		{"opted out", "/raw", true, large},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(r, tt.path, tt.acceptGzip)
+			if w.Header().Get("Content-Encoding") != "" || w.Body.String() != tt.want {
+				t.Fatalf("got Content-Encoding %q and %d bytes, want the body as it is",
+					w.Header().Get("Content-Encoding"), w.Body.Len())
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package middlewares
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConcurrencyLimiter counts in-flight requests per key
+type ConcurrencyLimiter struct {
+	mu       sync.Mutex
+	inFlight map[string]int
+	max      int
+}
+
+// NewConcurrencyLimiter creates a limiter allowing max simultaneous requests per key
+func NewConcurrencyLimiter(max int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		inFlight: make(map[string]int),
+		max:      max,
+	}
+}
+
+// acquire takes a slot for key, reporting false when it has none left
+func (cl *ConcurrencyLimiter) acquire(key string) bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if cl.inFlight[key] >= cl.max {
+		return false
+	}
+	cl.inFlight[key]++
+	return true
+}
+
+// release frees a slot for key
+func (cl *ConcurrencyLimiter) release(key string) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.inFlight[key]--
+	if cl.inFlight[key] <= 0 {
+		delete(cl.inFlight, key)
+	}
+}
+
+// ConcurrencyLimitMiddleware caps simultaneous requests per authenticated user,
+// falling back to the client IP for unauthenticated requests, and answers 429
+// once the cap is reached. Slots are released when the handler returns.
+func ConcurrencyLimitMiddleware(cl *ConcurrencyLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetString("email")
+		if key == "" {
+			key = c.ClientIP()
+		}
+
+		if !cl.acquire(key) {
+			AbortWithError(c, http.StatusTooManyRequests, CodeRateLimited, "too many concurrent streams")
+			return
+		}
+		defer cl.release(key)
+
+		c.Next()
+	}
+}
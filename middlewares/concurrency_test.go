@@ -0,0 +1,59 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestConcurrencyLimitPerUser(t *testing.T) {
+	limiter := NewConcurrencyLimiter(2)
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	r := gin.New()
+	r.GET("/video", func(c *gin.Context) {
+		c.Set("email", c.GetHeader("User"))
+	}, ConcurrencyLimitMiddleware(limiter), func(c *gin.Context) {
+		if c.Query("hold") != "" {
+			entered <- struct{}{}
+			<-release
+		}
+		c.Status(http.StatusOK)
+	})
+	stream := func(user, query string) int {
+		req := httptest.NewRequest(http.MethodGet, "/video"+query, nil)
+		req.Header.Set("User", user)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stream("a@example.com", "?hold=1")
+		}()
+		<-entered
+	}
+
+	if got := stream("a@example.com", ""); got != http.StatusTooManyRequests {
+		t.Fatalf("third concurrent stream: got %d, want 429", got)
+	}
+	if got := stream("b@example.com", ""); got != http.StatusOK {
+		t.Fatalf("another user's stream: got %d, want 200", got)
+	}
+
+	close(release)
+	wg.Wait()
+	if got := stream("a@example.com", ""); got != http.StatusOK {
+		t.Fatalf("stream after the others ended: got %d, want 200", got)
+	}
+	if len(limiter.inFlight) != 0 {
+		t.Fatalf("slots left behind: %v", limiter.inFlight)
+	}
+}
@@ -0,0 +1,20 @@
+package middlewares
+
+import "config"
+
+// Configure applies the settings the package-level helpers depend on, such as
+// the JWT secret used by GenerateToken. Call it once at startup, before any
+// request is served.
+func Configure(cfg *config.Config) {
+	passwordCost = cfg.Auth.BcryptCost
+	signingKeys = newKeyset([]byte(cfg.Auth.JWTSecret))
+	signingMethod = signingMethodFor(cfg.Auth.SigningMethod)
+	jwtLeeway = cfg.Auth.Leeway
+	tokenCookieName = cfg.Auth.CookieName
+	tokenHeaderName = cfg.Auth.HeaderName
+	tokenScheme = cfg.Auth.Scheme
+	ipv4KeyPrefix = cfg.RateLimit.IPv4Prefix
+	ipv6KeyPrefix = cfg.RateLimit.IPv6Prefix
+	maxLimiterKeys = cfg.RateLimit.MaxKeys
+	problemJSONEnabled = cfg.Server.ProblemJSON
+}
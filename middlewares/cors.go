@@ -0,0 +1,144 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORSConfig describes which cross-origin requests are allowed
+type CORSConfig struct {
+	// AllowedOrigins lists exact origins; "*" allows any origin
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// ExposedHeaders are response headers scripts on other origins may read
+	ExposedHeaders []string
+	// MaxAge is how long browsers may cache a preflight response; zero leaves it to the browser
+	MaxAge time.Duration
+	// AllowCredentials lets browsers send cookies and read responses to
+	// credentialed requests. It cannot be combined with the "*" origin.
+	AllowCredentials bool
+}
+
+// Validate reports configurations browsers would reject, such as credentials with a wildcard origin.
+func (cfg CORSConfig) Validate() error {
+	if !cfg.AllowCredentials {
+		return nil
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			return errors.New("CORS credentials cannot be allowed for the \"*\" origin")
+		}
+	}
+	return nil
+}
+
+// CORSMiddleware applies cfg to cross-origin requests and answers preflight
+// requests directly. Requests without an Origin header are passed through.
+// It panics if cfg does not pass Validate.
+func CORSMiddleware(cfg CORSConfig) gin.HandlerFunc {
+	if err := cfg.Validate(); err != nil {
+		panic(err)
+	}
+	anyOrigin := false
+	origins := make(map[string]bool, len(cfg.AllowedOrigins))
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			anyOrigin = true
+		}
+		origins[origin] = true
+	}
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Origin")
+		allowed := anyOrigin || origins[origin]
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if !allowed {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if anyOrigin {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			c.Header("Access-Control-Allow-Methods", methods)
+			c.Header("Access-Control-Allow-Headers", headers)
+			if cfg.MaxAge > 0 {
+				c.Header("Access-Control-Max-Age", maxAge)
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		if len(cfg.ExposedHeaders) > 0 {
+			c.Header("Access-Control-Expose-Headers", strings.Join(cfg.ExposedHeaders, ", "))
+		}
+		c.Next()
+	}
+}
+
+// CORSGroups applies a separate CORS policy to each route group, keyed by the
+// group's path prefix. The longest matching prefix wins and requests under no
+// prefix are passed through. It matches the request path instead of gin's
+// route since preflight requests match no route of their own, so it must be
+// installed on the engine rather than on the groups.
+func CORSGroups(groups map[string]CORSConfig) gin.HandlerFunc {
+	handlers := make(map[string]gin.HandlerFunc, len(groups))
+	prefixes := make([]string, 0, len(groups))
+	for prefix, cfg := range groups {
+		prefix = strings.TrimSuffix(prefix, "/")
+		handlers[prefix] = CORSMiddleware(cfg)
+		prefixes = append(prefixes, prefix)
+	}
+	// Nested groups are checked before the groups containing them
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		for _, prefix := range prefixes {
+			if path == prefix || strings.HasPrefix(path, prefix+"/") {
+				handlers[prefix](c)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// ExposeHeaders adds headers to Access-Control-Expose-Headers on a route when
+// the CORS middleware has allowed the request's origin.
+func ExposeHeaders(headers ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Writer.Header().Get("Access-Control-Allow-Origin") != "" {
+			c.Writer.Header().Add("Access-Control-Expose-Headers", strings.Join(headers, ", "))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,143 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// corsRequest sends a request with the given Origin, and as a preflight if
+// preflight is set, through handlers and returns the response
+func corsRequest(r *gin.Engine, method, path, origin string, preflight bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if preflight {
+		req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestExposeRangeHeaders(t *testing.T) {
+	r := gin.New()
+	r.Use(CORSMiddleware(CORSConfig{AllowedOrigins: []string{"https://app.example.com"}}))
+	r.GET("/video", ExposeHeaders("Content-Range", "Accept-Ranges", "Content-Length"), func(c *gin.Context) {
+		c.Status(http.StatusPartialContent)
+	})
+	r.GET("/profile", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := corsRequest(r, http.MethodGet, "/video", "https://app.example.com", false)
+	if got := w.Header().Get("Access-Control-Expose-Headers"); got != "Content-Range, Accept-Ranges, Content-Length" {
+		t.Fatalf("video exposes %q", got)
+	}
+	// Other routes and other origins see nothing extra
+	if got := corsRequest(r, http.MethodGet, "/profile", "https://app.example.com", false).Header().Get("Access-Control-Expose-Headers"); got != "" {
+		t.Fatalf("profile exposes %q", got)
+	}
+	if got := corsRequest(r, http.MethodGet, "/video", "https://evil.example.net", false).Header().Get("Access-Control-Expose-Headers"); got != "" {
+		t.Fatalf("disallowed origin sees %q exposed", got)
+	}
+}
+
+func TestCORSMaxAgeAndCredentials(t *testing.T) {
+	r := gin.New()
+	r.Use(CORSMiddleware(CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{http.MethodGet},
+		MaxAge:           10 * time.Minute,
+		AllowCredentials: true,
+	}))
+	r.GET("/profile", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := corsRequest(r, http.MethodOptions, "/profile", "https://app.example.com", true)
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Fatalf("preflight: got %d with Max-Age %q, want 204 with 600", w.Code, w.Header().Get("Access-Control-Max-Age"))
+	}
+	// Credentialed responses name the origin; "*" would be rejected by browsers
+	w = corsRequest(r, http.MethodGet, "/profile", "https://app.example.com", false)
+	if w.Header().Get("Access-Control-Allow-Credentials") != "true" || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Fatalf("got headers %v", w.Header())
+	}
+	if got := w.Header().Get("Access-Control-Max-Age"); got != "" {
+		t.Fatalf("simple request carries Max-Age %q", got)
+	}
+
+	// Neither header is sent unless configured
+	r = gin.New()
+	r.Use(CORSMiddleware(CORSConfig{AllowedOrigins: []string{"*"}, AllowedMethods: []string{http.MethodGet}}))
+	r.GET("/profile", func(c *gin.Context) { c.Status(http.StatusOK) })
+	w = corsRequest(r, http.MethodOptions, "/profile", "https://app.example.com", true)
+	if w.Header().Get("Access-Control-Max-Age") != "" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Fatalf("unconfigured: got headers %v", w.Header())
+	}
+}
+
+func TestCORSCredentialsRejectWildcard(t *testing.T) {
+	cfg := CORSConfig{AllowedOrigins: []string{"https://app.example.com", "*"}, AllowCredentials: true}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("credentials with the \"*\" origin passed validation")
+	}
+	if err := (CORSConfig{AllowedOrigins: []string{"*"}}).Validate(); err != nil {
+		t.Fatalf("\"*\" origin without credentials: %v", err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("CORSMiddleware accepted credentials with the \"*\" origin")
+		}
+	}()
+	CORSMiddleware(cfg)
+}
+
+func TestCORSGroups(t *testing.T) {
+	r := gin.New()
+	r.Use(CORSGroups(map[string]CORSConfig{
+		"/api": {
+			AllowedOrigins:   []string{"https://app.example.com"},
+			AllowedMethods:   []string{http.MethodGet},
+			AllowCredentials: true,
+		},
+		"/api/public/": {AllowedOrigins: []string{"*"}, AllowedMethods: []string{http.MethodGet}},
+	}))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	for _, path := range []string{"/api/profile", "/api/public/video", "/api/publicity", "/health"} {
+		r.GET(path, ok)
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		origin      string
+		allowOrigin string
+		credentials string
+		// preflight is the status of a preflight from origin
+		preflight int
+	}{
+		{"API from the app", "/api/profile", "https://app.example.com", "https://app.example.com", "true", http.StatusNoContent},
+		{"API from elsewhere", "/api/profile", "https://other.example.net", "", "", http.StatusForbidden},
+		{"public video from elsewhere", "/api/public/video", "https://other.example.net", "*", "", http.StatusNoContent},
+		{"public video from the app", "/api/public/video", "https://app.example.com", "*", "", http.StatusNoContent},
+		{"sibling of the public group", "/api/publicity", "https://other.example.net", "", "", http.StatusForbidden},
+		// Outside every group, preflights find no route
+		{"outside the groups", "/health", "https://other.example.net", "", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := corsRequest(r, http.MethodGet, tt.path, tt.origin, false)
+			if w.Header().Get("Access-Control-Allow-Origin") != tt.allowOrigin ||
+				w.Header().Get("Access-Control-Allow-Credentials") != tt.credentials {
+				t.Fatalf("got Allow-Origin %q and Allow-Credentials %q, want %q and %q",
+					w.Header().Get("Access-Control-Allow-Origin"), w.Header().Get("Access-Control-Allow-Credentials"),
+					tt.allowOrigin, tt.credentials)
+			}
+			if w := corsRequest(r, http.MethodOptions, tt.path, tt.origin, true); w.Code != tt.preflight {
+				t.Fatalf("preflight: got %d, want %d", w.Code, tt.preflight)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package middlewares
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+)
+
+// ErrInvalidEmail is returned by NormalizeEmail for malformed addresses
+var ErrInvalidEmail = errors.New("invalid email address")
+
+// NormalizeEmail trims and lowercases an email address and rejects forms the
+// binding validator lets through, such as consecutive or trailing dots.
+// The normalized form is what gets stored and compared on login.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" {
+		return "", ErrInvalidEmail
+	}
+
+	at := strings.LastIndex(email, "@")
+	local, domain := email[:at], email[at+1:]
+	if !validDotAtoms(local) || !validDotAtoms(domain) {
+		return "", ErrInvalidEmail
+	}
+
+	// Require a dotted domain with an alphabetic top-level label
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return "", ErrInvalidEmail
+	}
+	tld := labels[len(labels)-1]
+	if len(tld) < 2 || strings.IndexFunc(tld, func(r rune) bool { return r < 'a' || r > 'z' }) >= 0 {
+		return "", ErrInvalidEmail
+	}
+	for _, label := range labels {
+		if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return "", ErrInvalidEmail
+		}
+	}
+	return email, nil
+}
+
+// validDotAtoms reports whether s is non-empty and has no leading, trailing or consecutive dots
+func validDotAtoms(s string) bool {
+	return s != "" && !strings.HasPrefix(s, ".") && !strings.HasSuffix(s, ".") && !strings.Contains(s, "..")
+}
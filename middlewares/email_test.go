@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	valid := map[string]string{
+		"user@example.com":           "user@example.com",
+		"  User@Example.COM ":        "user@example.com",
+		"first.last@mail.example.io": "first.last@mail.example.io",
+		"a-b@my-host.example.org":    "a-b@my-host.example.org",
+	}
+	for email, want := range valid {
+		got, err := NormalizeEmail(email)
+		if err != nil || got != want {
+			t.Errorf("NormalizeEmail(%q) = %q, %v; want %q", email, got, err, want)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"user",
+		"user@localhost",
+		"user@example.c0m",
+		"user@example.c",
+		"user..name@example.com",
+		".user@example.com",
+		"user.@example.com",
+		"user@example..com",
+		"user@-example.com",
+		"user@example-.com",
+		"User <user@example.com>",
+	}
+	for _, email := range invalid {
+		if got, err := NormalizeEmail(email); !errors.Is(err, ErrInvalidEmail) {
+			t.Errorf("NormalizeEmail(%q) = %q, %v; want ErrInvalidEmail", email, got, err)
+		}
+	}
+}
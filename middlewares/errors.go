@@ -0,0 +1,87 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Machine-readable error codes sent in APIError.Code
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeValidationFailed     = "validation_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeConflict             = "conflict"
+	CodePreconditionFailed   = "precondition_failed"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeUnprocessable        = "unprocessable"
+	CodeRangeNotSatisfiable  = "range_not_satisfiable"
+	CodeRateLimited          = "rate_limited"
+	CodeInternal             = "internal_error"
+	CodeUnavailable          = "unavailable"
+	CodeTimeout              = "timeout"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+)
+
+// APIError is the body of every error response: a stable code for programs
+// and a message for people. Validation failures add the failing fields.
+type APIError struct {
+	Code    string            `json:"code"`
+	Message string            `json:"error"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// Error implements the error interface
+func (e APIError) Error() string {
+	return e.Message
+}
+
+// CodeForStatus returns the default error code for an HTTP status, for
+// errors that carry no more specific code.
+func CodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusPreconditionFailed:
+		return CodePreconditionFailed
+	case http.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case http.StatusUnsupportedMediaType:
+		return CodeUnsupportedMediaType
+	case http.StatusRequestedRangeNotSatisfiable:
+		return CodeRangeNotSatisfiable
+	case http.StatusUnprocessableEntity:
+		return CodeUnprocessable
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	case http.StatusGatewayTimeout:
+		return CodeTimeout
+	default:
+		return CodeInternal
+	}
+}
+
+// RespondError writes an APIError response.
+func RespondError(c *gin.Context, status int, code, message string) {
+	c.JSON(status, APIError{Code: code, Message: message})
+}
+
+// AbortWithError writes an APIError response and stops the handler chain.
+func AbortWithError(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, APIError{Code: code, Message: message})
+}
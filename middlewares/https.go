@@ -0,0 +1,109 @@
+package middlewares
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HTTPSConfig describes how HTTPSMiddleware tells plain HTTP requests apart
+// and where it sends them
+type HTTPSConfig struct {
+	HSTSMaxAge time.Duration
+	// TrustedProxies lists the IPs and CIDRs, as for gin's SetTrustedProxies,
+	// whose X-Forwarded-Proto is believed
+	TrustedProxies []string
+	// CanonicalHost is the host, with an optional port, redirects point at.
+	// Empty rejects plain HTTP requests instead of redirecting them.
+	CanonicalHost string
+}
+
+// trustedPrefixes parses TrustedProxies, bare IPs becoming single-address prefixes
+func (cfg HTTPSConfig) trustedPrefixes() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cfg.TrustedProxies))
+	for _, proxy := range cfg.TrustedProxies {
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// Validate reports trusted proxies that do not parse and canonical hosts that
+// are more than a host and port.
+func (cfg HTTPSConfig) Validate() error {
+	if _, err := cfg.trustedPrefixes(); err != nil {
+		return err
+	}
+	if cfg.CanonicalHost != "" {
+		u, err := url.Parse("https://" + cfg.CanonicalHost)
+		if err != nil || u.Host != cfg.CanonicalHost || u.User != nil {
+			return fmt.Errorf("canonical host %q must be a host with an optional port", cfg.CanonicalHost)
+		}
+	}
+	return nil
+}
+
+// HTTPSMiddleware enforces secure transport behind a TLS-terminating proxy.
+// Requests a trusted proxy marks as plain HTTP via X-Forwarded-Proto are
+// redirected to the canonical host over HTTPS when safe (GET/HEAD) and
+// rejected otherwise; the header is ignored from anyone else, since clients
+// could set it themselves. All other responses carry a
+// Strict-Transport-Security header. It panics if cfg does not pass Validate.
+func HTTPSMiddleware(cfg HTTPSConfig) gin.HandlerFunc {
+	if err := cfg.Validate(); err != nil {
+		panic(err)
+	}
+	trusted, _ := cfg.trustedPrefixes()
+	hsts := "max-age=" + strconv.Itoa(int(cfg.HSTSMaxAge.Seconds())) + "; includeSubDomains"
+
+	fromTrustedProxy := func(c *gin.Context) bool {
+		host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+		if err != nil {
+			host = c.Request.RemoteAddr
+		}
+		addr, err := netip.ParseAddr(host)
+		if err != nil {
+			return false
+		}
+		for _, prefix := range trusted {
+			if prefix.Contains(addr.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(c *gin.Context) {
+		if c.GetHeader("X-Forwarded-Proto") == "http" && fromTrustedProxy(c) {
+			safe := c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead
+			if safe && cfg.CanonicalHost != "" {
+				c.Redirect(http.StatusMovedPermanently, "https://"+cfg.CanonicalHost+c.Request.URL.RequestURI())
+				c.Abort()
+				return
+			}
+			AbortWithError(c, http.StatusForbidden, CodeForbidden, "https required")
+			return
+		}
+
+		c.Header("Strict-Transport-Security", hsts)
+		c.Next()
+	}
+}
@@ -0,0 +1,74 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		method        string
+		canonicalHost string
+		want          int
+		location      string
+	}{
+		{"trusted proxy", "10.0.0.5:1234", http.MethodGet, "videos.example.com", http.StatusMovedPermanently, "https://videos.example.com/api/video?x=1"},
+		{"trusted proxy, unsafe method", "10.0.0.5:1234", http.MethodPost, "videos.example.com", http.StatusForbidden, ""},
+		{"trusted proxy, no canonical host", "10.0.0.5:1234", http.MethodGet, "", http.StatusForbidden, ""},
+		{"single trusted address", "127.0.0.1:1234", http.MethodGet, "videos.example.com", http.StatusMovedPermanently, "https://videos.example.com/api/video?x=1"},
+		{"untrusted client", "203.0.113.9:1234", http.MethodGet, "videos.example.com", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(HTTPSMiddleware(HTTPSConfig{
+				HSTSMaxAge:     time.Hour,
+				TrustedProxies: []string{"10.0.0.0/8", "127.0.0.1"},
+				CanonicalHost:  tt.canonicalHost,
+			}))
+			r.Handle(tt.method, "/api/video", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(tt.method, "/api/video?x=1", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Host = "evil.example.net"
+			req.Header.Set("X-Forwarded-Proto", "http")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("got %d, want %d", w.Code, tt.want)
+			}
+			if got := w.Header().Get("Location"); got != tt.location {
+				t.Fatalf("redirected to %q, want %q", got, tt.location)
+			}
+		})
+	}
+}
+
+func TestHTTPSConfigValidate(t *testing.T) {
+	valid := []HTTPSConfig{
+		{TrustedProxies: []string{"127.0.0.1", "::1", "10.0.0.0/8"}, CanonicalHost: "example.com:8443"},
+		{},
+	}
+	for _, cfg := range valid {
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("%+v: %v", cfg, err)
+		}
+	}
+	invalid := []HTTPSConfig{
+		{TrustedProxies: []string{"not an ip"}},
+		{CanonicalHost: "example.com/path"},
+		{CanonicalHost: "user@example.com"},
+	}
+	for _, cfg := range invalid {
+		if cfg.Validate() == nil {
+			t.Errorf("%+v accepted", cfg)
+		}
+	}
+}
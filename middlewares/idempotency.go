@@ -0,0 +1,156 @@
+package middlewares
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idempotentResponse is a cached response replayed for a repeated Idempotency-Key
+type idempotentResponse struct {
+	requestHash [sha256.Size]byte
+	done        bool
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+	// element is the entry's place in IdempotencyStore.order
+	element *list.Element
+}
+
+// IdempotencyStore keeps responses keyed by Idempotency-Key in memory for a
+// TTL, holding at most maxEntries; past that the oldest are dropped early.
+type IdempotencyStore struct {
+	mu        sync.Mutex
+	responses map[string]*idempotentResponse
+	// order holds the keys oldest first, which with a single TTL is also the
+	// order they expire in
+	order      *list.List
+	ttl        time.Duration
+	maxEntries int
+}
+
+// NewIdempotencyStore creates a store whose entries expire after ttl, holding
+// at most maxEntries of them
+func NewIdempotencyStore(ttl time.Duration, maxEntries int) *IdempotencyStore {
+	return &IdempotencyStore{
+		responses:  make(map[string]*idempotentResponse),
+		order:      list.New(),
+		ttl:        ttl,
+		maxEntries: max(maxEntries, 1),
+	}
+}
+
+// evict drops expired entries, and the oldest ones while the store holds more
+// than room leaves for. Callers hold mu.
+func (s *IdempotencyStore) evict(now time.Time, room int) {
+	for front := s.order.Front(); front != nil; front = s.order.Front() {
+		key := front.Value.(string)
+		if s.order.Len() <= s.maxEntries-room && !now.After(s.responses[key].expires) {
+			return
+		}
+		s.remove(key)
+	}
+}
+
+// remove deletes the entry for key. Callers hold mu.
+func (s *IdempotencyStore) remove(key string) {
+	if entry, ok := s.responses[key]; ok {
+		s.order.Remove(entry.element)
+		delete(s.responses, key)
+	}
+}
+
+// bodyRecorder copies everything written to the response so it can be cached
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware replays the original response when a request is retried
+// with the same Idempotency-Key header. Keys belong to the authenticated
+// caller, so it goes after JwtMiddleware; without a caller the header is
+// ignored. Keep it off routes whose responses carry credentials, like login,
+// since they would sit in memory for the TTL. Reusing a key with a different
+// body is rejected with 422, and a retry that arrives while the first attempt
+// is still running gets 409. Server errors are not cached so they can be
+// retried.
+func IdempotencyMiddleware(store *IdempotencyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		email := c.GetString("email")
+		if key == "" || email == "" {
+			c.Next()
+			return
+		}
+		key = email + " " + c.Request.Method + " " + c.FullPath() + " " + key
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			AbortWithError(c, http.StatusBadRequest, CodeInvalidRequest, "could not read request body")
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.Sum256(body)
+
+		store.mu.Lock()
+		now := time.Now()
+		store.evict(now, 0)
+		if cached, ok := store.responses[key]; ok {
+			store.mu.Unlock()
+			switch {
+			case cached.requestHash != hash:
+				AbortWithError(c, http.StatusUnprocessableEntity, CodeUnprocessable, "idempotency key reused with a different request")
+			case !cached.done:
+				AbortWithError(c, http.StatusConflict, CodeConflict, "request with this idempotency key is in progress")
+			default:
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(cached.status, cached.contentType, cached.body)
+				c.Abort()
+			}
+			return
+		}
+		store.evict(now, 1)
+		entry := &idempotentResponse{requestHash: hash, expires: now.Add(store.ttl)}
+		entry.element = store.order.PushBack(key)
+		store.responses[key] = entry
+		store.mu.Unlock()
+
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		// Deferred so a panicking handler does not leave the key stuck in progress
+		defer func() {
+			store.mu.Lock()
+			defer store.mu.Unlock()
+			// The entry may have been evicted, and the key reused, meanwhile
+			if store.responses[key] != entry {
+				return
+			}
+			if !c.Writer.Written() || recorder.Status() >= http.StatusInternalServerError {
+				store.remove(key)
+				return
+			}
+			entry.done = true
+			entry.status = recorder.Status()
+			entry.contentType = recorder.Header().Get("Content-Type")
+			entry.body = recorder.body.Bytes()
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,109 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idempotencyRouter counts the requests reaching its handler. Callers name
+// themselves in the User header, standing in for JwtMiddleware.
+func idempotencyRouter(store *IdempotencyStore, calls *int) *gin.Engine {
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if user := c.GetHeader("User"); user != "" {
+			c.Set("email", user)
+		}
+	})
+	r.POST("/copy", IdempotencyMiddleware(store), func(c *gin.Context) {
+		*calls++
+		c.JSON(http.StatusCreated, gin.H{"call": *calls})
+	})
+	return r
+}
+
+func postIdempotent(r *gin.Engine, user, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/copy", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", key)
+	if user != "" {
+		req.Header.Set("User", user)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplaysResponse(t *testing.T) {
+	var calls int
+	r := idempotencyRouter(NewIdempotencyStore(time.Minute, 10), &calls)
+
+	first := postIdempotent(r, "a@example.com", "k", `{"n":1}`)
+	again := postIdempotent(r, "a@example.com", "k", `{"n":1}`)
+	if calls != 1 || again.Code != first.Code || again.Body.String() != first.Body.String() {
+		t.Fatalf("retry ran the handler again: %d calls, %d %s", calls, again.Code, again.Body)
+	}
+	if again.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatal("replayed response is not marked")
+	}
+
+	if w := postIdempotent(r, "a@example.com", "k", `{"n":2}`); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("key reused with another body: got %d, want 422", w.Code)
+	}
+}
+
+func TestIdempotencyKeysArePerUser(t *testing.T) {
+	var calls int
+	r := idempotencyRouter(NewIdempotencyStore(time.Minute, 10), &calls)
+
+	postIdempotent(r, "a@example.com", "k", `{}`)
+	w := postIdempotent(r, "b@example.com", "k", `{}`)
+	if calls != 2 || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatal("another user's key replayed a response")
+	}
+
+	// Without a caller the header is ignored
+	postIdempotent(r, "", "k", `{}`)
+	postIdempotent(r, "", "k", `{}`)
+	if calls != 4 {
+		t.Fatalf("anonymous retries: %d calls, want 4", calls)
+	}
+}
+
+func TestIdempotencyStoreIsBounded(t *testing.T) {
+	var calls int
+	store := NewIdempotencyStore(time.Minute, 2)
+	r := idempotencyRouter(store, &calls)
+
+	for _, key := range []string{"1", "2", "3"} {
+		postIdempotent(r, "a@example.com", key, `{}`)
+	}
+	if len(store.responses) != 2 || store.order.Len() != 2 {
+		t.Fatalf("store holds %d entries, want 2", len(store.responses))
+	}
+	// The oldest key was evicted and runs again; the newest still replays
+	postIdempotent(r, "a@example.com", "1", `{}`)
+	postIdempotent(r, "a@example.com", "3", `{}`)
+	if calls != 4 {
+		t.Fatalf("%d calls, want 4", calls)
+	}
+}
+
+func TestIdempotencyEntriesExpire(t *testing.T) {
+	var calls int
+	store := NewIdempotencyStore(time.Minute, 10)
+	r := idempotencyRouter(store, &calls)
+
+	postIdempotent(r, "a@example.com", "k", `{}`)
+	store.evict(time.Now().Add(2*time.Minute), 0)
+	if len(store.responses) != 0 {
+		t.Fatal("expired entry kept")
+	}
+	postIdempotent(r, "a@example.com", "k", `{}`)
+	if calls != 2 {
+		t.Fatalf("%d calls after expiry, want 2", calls)
+	}
+}
@@ -0,0 +1,247 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// StoredSigningKey is a signing key as a KeyStore keeps it. Each rotation adds
+// one, naming the key it replaced and how long that key keeps verifying.
+type StoredSigningKey struct {
+	ID     string
+	Secret []byte
+	// PreviousID is the key this one replaced, which may be the JWT_SECRET key
+	PreviousID         string
+	PreviousValidUntil time.Time
+}
+
+// ErrRotationConflict is returned by KeyStore.AddSigningKey when the key being
+// replaced already was, by a rotation on another instance.
+var ErrRotationConflict = errors.New("signing key was already rotated")
+
+// KeyStore persists rotated signing keys, so a restart does not go back to
+// JWT_SECRET and every instance signs and verifies with the same keys.
+type KeyStore interface {
+	// SigningKeys returns every stored key, oldest first
+	SigningKeys(ctx context.Context) ([]StoredSigningKey, error)
+	// AddSigningKey stores key as the new current key. It fails with
+	// ErrRotationConflict if key.PreviousID has already been replaced.
+	AddSigningKey(ctx context.Context, key StoredSigningKey) error
+}
+
+// keyReloadInterval is how often an unknown kid may trigger a reload of the
+// stored keys, so forged kids cannot turn into a query per request
+const keyReloadInterval = 5 * time.Second
+
+// keyset holds the key new tokens are signed with and the keys it replaced,
+// which keep verifying tokens until their grace window ends. Tokens name their
+// key in the kid header. With a store, the keys are loaded from it and
+// rotations are written to it.
+type keyset struct {
+	sync.RWMutex
+	currentID string
+	secrets   map[string][]byte
+	// retiredUntil is when each replaced key stops verifying
+	retiredUntil map[string]time.Time
+	// configuredID is the kid of JWT_SECRET. Tokens issued before kids were
+	// added are verified with it.
+	configuredID     string
+	configuredSecret []byte
+	store            KeyStore
+	loadedAt         time.Time
+}
+
+// newKeyset returns a keyset whose only key is secret
+func newKeyset(secret []byte) *keyset {
+	id := keyID(secret)
+	return &keyset{
+		currentID:        id,
+		secrets:          map[string][]byte{id: secret},
+		retiredUntil:     make(map[string]time.Time),
+		configuredID:     id,
+		configuredSecret: secret,
+	}
+}
+
+// signingKeys signs and verifies tokens, set by Configure
+var signingKeys = newKeyset([]byte("supersecretkey123"))
+
+// keyID derives a kid from a secret without revealing it, so every instance
+// started with the same JWT_SECRET names it the same way.
+func keyID(secret []byte) string {
+	sum := sha256.Sum256(secret)
+	return hex.EncodeToString(sum[:8])
+}
+
+// signToken signs token with the current key and names it in the kid header
+func (keys *keyset) signToken(token *jwt.Token) (string, error) {
+	keys.RLock()
+	id, secret := keys.currentID, keys.secrets[keys.currentID]
+	keys.RUnlock()
+
+	token.Header["kid"] = id
+	return token.SignedString(secret)
+}
+
+// verificationKey returns the secret named by kid, as long as it is current
+// or still within its grace window. An empty kid means JWT_SECRET. A kid it
+// does not know may have been added by another instance, so the stored keys
+// are reloaded, at most once per keyReloadInterval.
+func (keys *keyset) verificationKey(kid string, now time.Time) ([]byte, bool) {
+	secret, ok, known := keys.lookup(kid, now)
+	if known || !keys.reloadDue(now) {
+		return secret, ok
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := keys.reload(ctx, now); err != nil {
+		log.Printf("Failed to reload signing keys: %v\n", err)
+		return nil, false
+	}
+	secret, ok, _ = keys.lookup(kid, now)
+	return secret, ok
+}
+
+// lookup is verificationKey without reloading; known reports whether kid is
+// in the keyset at all, valid or not.
+func (keys *keyset) lookup(kid string, now time.Time) (secret []byte, ok, known bool) {
+	keys.RLock()
+	defer keys.RUnlock()
+
+	if kid == "" {
+		kid = keys.configuredID
+	}
+	secret, known = keys.secrets[kid]
+	if !known {
+		return nil, false, false
+	}
+	if until, retired := keys.retiredUntil[kid]; retired && !now.Before(until) {
+		return nil, false, true
+	}
+	return secret, true, true
+}
+
+// reloadDue reports whether a miss may reload the stored keys
+func (keys *keyset) reloadDue(now time.Time) bool {
+	keys.RLock()
+	defer keys.RUnlock()
+	return keys.store != nil && now.Sub(keys.loadedAt) >= keyReloadInterval
+}
+
+// reload replaces the keys with the ones in the store. Without stored keys
+// JWT_SECRET is current; once a rotation has replaced it, it only verifies
+// until its grace window ends and never signs again.
+func (keys *keyset) reload(ctx context.Context, now time.Time) error {
+	stored, err := keys.keyStore().SigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys.Lock()
+	defer keys.Unlock()
+
+	keys.currentID = keys.configuredID
+	keys.secrets = map[string][]byte{keys.configuredID: keys.configuredSecret}
+	keys.retiredUntil = make(map[string]time.Time)
+	for _, key := range stored {
+		keys.secrets[key.ID] = key.Secret
+		keys.retiredUntil[key.PreviousID] = key.PreviousValidUntil
+		keys.currentID = key.ID
+	}
+	keys.loadedAt = now
+	return nil
+}
+
+// keyStore returns the store the keys are kept in, nil if there is none
+func (keys *keyset) keyStore() KeyStore {
+	keys.RLock()
+	defer keys.RUnlock()
+	return keys.store
+}
+
+// UseKeyStore loads the signing keys from store and writes later rotations to
+// it. Call it at startup, after Configure; the error is fatal, since signing
+// with JWT_SECRET after it was rotated away would bring a replaced key back.
+func UseKeyStore(ctx context.Context, store KeyStore) error {
+	signingKeys.Lock()
+	signingKeys.store = store
+	signingKeys.Unlock()
+	return signingKeys.reload(ctx, time.Now())
+}
+
+// RefreshSigningKeys reloads the stored keys every interval until ctx is done,
+// so rotations made on other instances are picked up for signing too.
+func RefreshSigningKeys(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if signingKeys.keyStore() == nil {
+				continue
+			}
+			reloadCtx, cancel := context.WithTimeout(ctx, interval)
+			if err := signingKeys.reload(reloadCtx, now); err != nil {
+				log.Printf("Failed to reload signing keys: %v\n", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// RotateSigningKey signs new tokens with a fresh random key. The key it
+// replaces keeps verifying for grace, so tokens already handed out stay valid
+// until then. It returns the kid of the new key, or ErrRotationConflict if
+// another instance rotated first.
+func RotateSigningKey(ctx context.Context, grace time.Duration) (string, error) {
+	return signingKeys.rotate(ctx, grace, time.Now())
+}
+
+// rotate replaces the current key as of now; see RotateSigningKey
+func (keys *keyset) rotate(ctx context.Context, grace time.Duration, now time.Time) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	id := keyID(secret)
+
+	keys.RLock()
+	next := StoredSigningKey{
+		ID:                 id,
+		Secret:             secret,
+		PreviousID:         keys.currentID,
+		PreviousValidUntil: now.Add(grace),
+	}
+	store := keys.store
+	keys.RUnlock()
+
+	if store == nil {
+		keys.Lock()
+		defer keys.Unlock()
+		keys.retiredUntil[next.PreviousID] = next.PreviousValidUntil
+		keys.secrets[id] = secret
+		keys.currentID = id
+		return id, nil
+	}
+
+	err := store.AddSigningKey(ctx, next)
+	// Either way the store now knows better than this instance
+	if reloadErr := keys.reload(ctx, now); err == nil {
+		err = reloadErr
+	}
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
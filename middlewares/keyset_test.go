@@ -0,0 +1,140 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// memoryKeyStore is a KeyStore shared by the keysets of simulated instances
+type memoryKeyStore struct {
+	mu   sync.Mutex
+	keys []StoredSigningKey
+}
+
+func (s *memoryKeyStore) SigningKeys(ctx context.Context) ([]StoredSigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]StoredSigningKey(nil), s.keys...), nil
+}
+
+func (s *memoryKeyStore) AddSigningKey(ctx context.Context, key StoredSigningKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, stored := range s.keys {
+		if stored.PreviousID == key.PreviousID {
+			return ErrRotationConflict
+		}
+	}
+	s.keys = append(s.keys, key)
+	return nil
+}
+
+// newInstance returns the keyset of an instance started with secret and store
+func newInstance(t *testing.T, secret string, store KeyStore, now time.Time) *keyset {
+	t.Helper()
+	keys := newKeyset([]byte(secret))
+	keys.store = store
+	if err := keys.reload(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+// sign signs a token with the current key of keys and returns it with its kid
+func sign(t *testing.T, keys *keyset) (string, string) {
+	t.Helper()
+	token := jwt.NewWithClaims(signingMethod, jwt.RegisteredClaims{Subject: "user"})
+	signed, err := keys.signToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed, token.Header["kid"].(string)
+}
+
+// verifies reports whether keys accepts signed at now
+func verifies(keys *keyset, signed string, now time.Time) bool {
+	_, err := jwt.Parse(signed, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		secret, ok := keys.verificationKey(kid, now)
+		if !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return secret, nil
+	})
+	return err == nil
+}
+
+func TestRotationGraceWindow(t *testing.T) {
+	now := time.Now()
+	keys := newInstance(t, "configured", &memoryKeyStore{}, now)
+	old, oldID := sign(t, keys)
+
+	newID, err := keys.rotate(context.Background(), time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, kid := sign(t, keys)
+	if kid != newID || kid == oldID {
+		t.Fatalf("signed with %s, want the new key %s", kid, newID)
+	}
+
+	if !verifies(keys, old, now.Add(59*time.Minute)) {
+		t.Fatal("token signed with the previous key rejected during the grace window")
+	}
+	if verifies(keys, old, now.Add(61*time.Minute)) {
+		t.Fatal("token signed with the previous key accepted after the grace window")
+	}
+	if !verifies(keys, current, now.Add(61*time.Minute)) {
+		t.Fatal("token signed with the current key rejected")
+	}
+}
+
+func TestRotationSurvivesRestart(t *testing.T) {
+	now := time.Now()
+	store := &memoryKeyStore{}
+	keys := newInstance(t, "configured", store, now)
+	before, configuredID := sign(t, keys)
+	if _, err := keys.rotate(context.Background(), time.Hour, now); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := sign(t, keys)
+
+	restarted := newInstance(t, "configured", store, now)
+	if _, kid := sign(t, restarted); kid == configuredID {
+		t.Fatal("JWT_SECRET signs again after a restart")
+	}
+	if !verifies(restarted, after, now) || !verifies(restarted, before, now) {
+		t.Fatal("restarted instance rejects tokens signed before the restart")
+	}
+	if verifies(restarted, before, now.Add(2*time.Hour)) {
+		t.Fatal("JWT_SECRET verifies after its grace window")
+	}
+}
+
+func TestRotationIsSharedBetweenInstances(t *testing.T) {
+	now := time.Now()
+	store := &memoryKeyStore{}
+	first := newInstance(t, "configured", store, now)
+	second := newInstance(t, "configured", store, now)
+
+	if _, err := first.rotate(context.Background(), time.Hour, now); err != nil {
+		t.Fatal(err)
+	}
+	signed, _ := sign(t, first)
+	// The second instance learns about the new key on its first miss
+	if !verifies(second, signed, now.Add(keyReloadInterval)) {
+		t.Fatal("other instance rejects a token signed with the rotated key")
+	}
+
+	// An instance that has not reloaded yet cannot replace the configured key again
+	stale := newKeyset([]byte("configured"))
+	stale.store = store
+	if _, err := stale.rotate(context.Background(), time.Hour, now); !errors.Is(err, ErrRotationConflict) {
+		t.Fatalf("rotating a replaced key: got %v, want ErrRotationConflict", err)
+	}
+}
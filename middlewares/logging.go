@@ -1,14 +1,53 @@
 package middlewares
 
 import (
-	"log"
+	"io"
+	"log/slog"
+	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"config"
 )
 
-// LoggingMiddleware logs details about each request and its response.
-func LoggingMiddleware() gin.HandlerFunc {
+// accessLogWriter returns the destination for access logs. When cfg has a
+// path, logs go to that file and are rotated by size and pruned by count and age.
+func accessLogWriter(cfg config.AccessLogConfig) io.Writer {
+	if cfg.Path == "" {
+		return os.Stderr
+	}
+	return &lumberjack.Logger{
+		Filename:   cfg.Path,
+		MaxSize:    cfg.MaxSizeMB,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAgeDays,
+	}
+}
+
+// NewAccessLogger returns a structured logger writing to the access log destination.
+func NewAccessLogger(cfg config.AccessLogConfig) *slog.Logger {
+	return slog.New(slog.NewTextHandler(accessLogWriter(cfg), nil))
+}
+
+// SlowRequestThresholds sets the latency above which a request is logged as a
+// warning instead of at info level. A zero threshold never warns.
+type SlowRequestThresholds struct {
+	Default time.Duration
+	// Stream applies to StreamRoutes (by full path), which are long-lived by design
+	Stream       time.Duration
+	StreamRoutes []string
+}
+
+// LoggingMiddleware logs details about each request and its response to
+// logger, as a warning when the request was slower than its threshold.
+func LoggingMiddleware(logger *slog.Logger, slow SlowRequestThresholds) gin.HandlerFunc {
+	streamRoutes := make(map[string]bool, len(slow.StreamRoutes))
+	for _, path := range slow.StreamRoutes {
+		streamRoutes[path] = true
+	}
+
 	return func(c *gin.Context) {
 		// Start timer
 		startTime := time.Now()
@@ -19,13 +58,29 @@ func LoggingMiddleware() gin.HandlerFunc {
 		// Calculate latency
 		latency := time.Since(startTime)
 
-		// Log request details
-		method := c.Request.Method
-		path := c.Request.URL.Path
-		status := c.Writer.Status()
-		clientIP := c.ClientIP()
+		threshold := slow.Default
+		if streamRoutes[c.FullPath()] {
+			threshold = slow.Stream
+		}
+		level, message := slog.LevelInfo, "request"
+		if threshold > 0 && latency > threshold {
+			level, message = slog.LevelWarn, "slow request"
+		}
+
+		// JwtMiddleware has run by now on authenticated routes
+		user := c.GetString("email")
+		if user == "" {
+			user = "-"
+		}
 
-		log.Printf("[%s] %s %d | %v | %s\n",
-			method, path, status, latency, clientIP)
+		// Log request details
+		logger.LogAttrs(c.Request.Context(), level, message,
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", c.Writer.Status()),
+			slog.Duration("latency", latency),
+			slog.String("clientIP", c.ClientIP()),
+			slog.String("user", user),
+		)
 	}
 }
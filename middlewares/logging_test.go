@@ -0,0 +1,135 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"config"
+)
+
+func TestAccessLogWritesToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	cfg := config.AccessLogConfig{Path: path, MaxSizeMB: 1, MaxBackups: 2, MaxAgeDays: 3}
+
+	writer, ok := accessLogWriter(cfg).(*lumberjack.Logger)
+	if !ok {
+		t.Fatal("access log with a path is not rotated")
+	}
+	if writer.MaxSize != 1 || writer.MaxBackups != 2 || writer.MaxAge != 3 {
+		t.Fatalf("rotation settings not applied: %+v", writer)
+	}
+
+	logger := NewAccessLogger(cfg)
+	logger.Info("request", "path", "/api/version")
+	logged, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(logged), "path=/api/version") {
+		t.Fatalf("got %q", logged)
+	}
+
+	if accessLogWriter(config.AccessLogConfig{}) != os.Stderr {
+		t.Fatal("access log without a path does not go to stderr")
+	}
+}
+
+func TestSlowRequestsLogAsWarnings(t *testing.T) {
+	var logged bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logged, nil))
+	r := gin.New()
+	r.Use(LoggingMiddleware(logger, SlowRequestThresholds{
+		Default:      20 * time.Millisecond,
+		Stream:       time.Hour,
+		StreamRoutes: []string{"/api/video"},
+	}))
+	slow := func(c *gin.Context) {
+		time.Sleep(40 * time.Millisecond)
+		c.Status(http.StatusOK)
+	}
+	r.GET("/fast", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/slow", slow)
+	r.GET("/api/video", slow)
+
+	tests := []struct {
+		path    string
+		level   string
+		message string
+	}{
+		{"/fast", "INFO", "request"},
+		{"/slow", "WARN", "slow request"},
+		{"/api/video", "INFO", "request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			logged.Reset()
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+			var entry struct {
+				Level string `json:"level"`
+				Msg   string `json:"msg"`
+				Path  string `json:"path"`
+			}
+			if err := json.Unmarshal(logged.Bytes(), &entry); err != nil {
+				t.Fatalf("decoding %q: %v", logged.String(), err)
+			}
+			if entry.Level != tt.level || entry.Msg != tt.message || entry.Path != tt.path {
+				t.Fatalf("got %+v, want %s %q", entry, tt.level, tt.message)
+			}
+		})
+	}
+}
+
+func TestLoggingIncludesUser(t *testing.T) {
+	var logged bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logged, nil))
+	r := gin.New()
+	r.Use(LoggingMiddleware(logger, SlowRequestThresholds{Default: time.Hour, Stream: time.Hour}))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/public", ok)
+	r.GET("/private", JwtMiddleware(), ok)
+
+	token, err := GenerateToken("user@example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		want  string
+	}{
+		{"authenticated", "/private", token, "user@example.com"},
+		{"anonymous", "/public", "", "-"},
+		{"rejected token", "/private", "not-a-token", "-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logged.Reset()
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+			var entry struct {
+				User string `json:"user"`
+			}
+			if err := json.Unmarshal(logged.Bytes(), &entry); err != nil {
+				t.Fatalf("decoding %q: %v", logged.String(), err)
+			}
+			if entry.User != tt.want {
+				t.Fatalf("logged user %q, want %q", entry.User, tt.want)
+			}
+		})
+	}
+}
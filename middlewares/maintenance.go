@@ -0,0 +1,47 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaintenanceMode is a switch that can be flipped at runtime to pause writes during deploys
+type MaintenanceMode struct {
+	enabled    atomic.Bool
+	retryAfter time.Duration
+}
+
+// NewMaintenanceMode creates a switch, initially set to enabled, whose blocked
+// requests are told to retry after retryAfter.
+func NewMaintenanceMode(enabled bool, retryAfter time.Duration) *MaintenanceMode {
+	m := &MaintenanceMode{retryAfter: retryAfter}
+	m.enabled.Store(enabled)
+	return m
+}
+
+// Set turns maintenance mode on or off
+func (m *MaintenanceMode) Set(enabled bool) {
+	m.enabled.Store(enabled)
+}
+
+// Enabled reports whether maintenance mode is on
+func (m *MaintenanceMode) Enabled() bool {
+	return m.enabled.Load()
+}
+
+// MaintenanceMiddleware answers 503 with Retry-After while maintenance mode is
+// on. Attach it to the write routes that must pause; reads stay available.
+func MaintenanceMiddleware(m *MaintenanceMode) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if m.Enabled() {
+			c.Header("Retry-After", strconv.Itoa(int(m.retryAfter.Seconds())))
+			AbortWithError(c, http.StatusServiceUnavailable, CodeUnavailable, "service under maintenance")
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,55 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// problemJSONEnabled switches error responses to RFC 9457 problem details, set by Configure
+var problemJSONEnabled bool
+
+// Problem is an RFC 9457 problem details object. Code is an extension
+// member carrying the same code an APIError would.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Code   string `json:"code,omitempty"`
+}
+
+// ProblemJSON writes an application/problem+json response, with code as the
+// code extension unless it is empty. An empty title falls back to the status
+// text, as RFC 9457 asks for the about:blank type.
+func ProblemJSON(c *gin.Context, status int, code, title, detail string) {
+	if title == "" {
+		title = http.StatusText(status)
+	}
+	// gin only sets application/json when no Content-Type is present
+	c.Header("Content-Type", "application/problem+json")
+	c.JSON(status, Problem{
+		Type:   "about:blank",
+		Title:  title,
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	})
+}
+
+// RespondProblem writes message as problem details when PROBLEM_JSON is
+// enabled and as an APIError otherwise. Handlers use it for rate-limit and
+// auth errors, so they match the ones the middlewares send.
+func RespondProblem(c *gin.Context, status int, code, message string) {
+	if !problemJSONEnabled {
+		RespondError(c, status, code, message)
+		return
+	}
+	ProblemJSON(c, status, code, "", message)
+}
+
+// abortWithProblem is RespondProblem that also stops the handler chain
+func abortWithProblem(c *gin.Context, status int, code, message string) {
+	RespondProblem(c, status, code, message)
+	c.Abort()
+}
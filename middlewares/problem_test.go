@@ -0,0 +1,90 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// decodeProblem checks that w holds problem details and returns them
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder, status int) Problem {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("got %d, want %d", w.Code, status)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("got Content-Type %q, want application/problem+json", ct)
+	}
+	var problem Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if problem.Type != "about:blank" || problem.Status != status || problem.Title != http.StatusText(status) {
+		t.Fatalf("got %+v", problem)
+	}
+	return problem
+}
+
+func TestProblemJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	ProblemJSON(c, http.StatusConflict, CodeConflict, "", "already exists")
+	if problem := decodeProblem(t, w, http.StatusConflict); problem.Detail != "already exists" || problem.Code != CodeConflict {
+		t.Fatalf("got %+v", problem)
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	ProblemJSON(c, http.StatusBadRequest, "", "Bad range", "")
+	var problem Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil || problem.Title != "Bad range" {
+		t.Fatalf("got title %q, want the given one", problem.Title)
+	}
+}
+
+func TestProblemJSONErrors(t *testing.T) {
+	previous := problemJSONEnabled
+	t.Cleanup(func() { problemJSONEnabled = previous })
+
+	r := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/private", JwtMiddleware(), ok)
+	limited := RateLimitMiddleware(NewSlidingWindowLimiter(1, time.Hour))
+	r.GET("/limited", limited, ok)
+	send := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	problemJSONEnabled = true
+	if problem := decodeProblem(t, send("/private"), http.StatusUnauthorized); problem.Code != CodeUnauthorized || problem.Detail == "" {
+		t.Fatalf("auth error: got %+v", problem)
+	}
+	send("/limited")
+	if problem := decodeProblem(t, send("/limited"), http.StatusTooManyRequests); problem.Code != CodeRateLimited {
+		t.Fatalf("rate limit error: got %+v", problem)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	RespondProblem(c, http.StatusUnauthorized, CodeUnauthorized, "invalid credentials")
+	if problem := decodeProblem(t, w, http.StatusUnauthorized); problem.Code != CodeUnauthorized || problem.Detail != "invalid credentials" {
+		t.Fatalf("handler error: got %+v", problem)
+	}
+
+	// Without the flag errors stay APIErrors
+	problemJSONEnabled = false
+	w = send("/private")
+	var body APIError
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != CodeUnauthorized {
+		t.Fatalf("body %s is not an unauthorized APIError", w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Fatalf("got Content-Type %q", ct)
+	}
+}
@@ -1,7 +1,10 @@
 package middlewares
 
 import (
+	"container/list"
+	"context"
 	"net/http"
+	"net/netip"
 	"sync"
 	"time"
 
@@ -9,20 +12,49 @@ import (
 	"golang.org/x/time/rate"
 )
 
+// Limiter decides whether another request for a key (the client's network) may proceed.
+// RateLimiter and SlidingWindowLimiter both satisfy it.
+type Limiter interface {
+	Allow(key string) bool
+}
+
+// limiterEntry pairs a limiter with its key and the last time it was used
+type limiterEntry struct {
+	key      string
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// maxLimiterKeys caps how many clients each limiter tracks, so a flood of
+// distinct addresses cannot grow it without bound between cleanups. Set by Configure.
+var maxLimiterKeys = 100000
+
 // RateLimiter holds the rate limiter configuration
 type RateLimiter struct {
-	limiters map[string]*rate.Limiter
-	mu       sync.RWMutex
-	rate     rate.Limit
-	burst    int
+	// limiters indexes the elements of recent, which holds *limiterEntry values
+	// from most to least recently used
+	limiters        map[string]*list.Element
+	recent          *list.List
+	maxKeys         int
+	mu              sync.RWMutex
+	rate            rate.Limit
+	burst           int
+	cleanupInterval time.Duration
+	idleTimeout     time.Duration
 }
 
-// NewRateLimiter creates a new rate limiter
-func NewRateLimiter(rps rate.Limit, burst int) *RateLimiter {
+// NewRateLimiter creates a new rate limiter. Limiters that have not been used
+// for idleTimeout are removed every cleanupInterval, and the least recently
+// used ones are evicted whenever more than maxLimiterKeys clients are tracked.
+func NewRateLimiter(rps rate.Limit, burst int, cleanupInterval, idleTimeout time.Duration) *RateLimiter {
 	return &RateLimiter{
-		limiters: make(map[string]*rate.Limiter),
-		rate:     rps,
-		burst:    burst,
+		limiters:        make(map[string]*list.Element),
+		recent:          list.New(),
+		maxKeys:         maxLimiterKeys,
+		rate:            rps,
+		burst:           burst,
+		cleanupInterval: cleanupInterval,
+		idleTimeout:     idleTimeout,
 	}
 }
 
@@ -31,47 +63,111 @@ func (rl *RateLimiter) GetLimiter(key string) *rate.Limiter {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
-	limiter, exists := rl.limiters[key]
-	if !exists {
-		limiter = rate.NewLimiter(rl.rate, rl.burst)
-		rl.limiters[key] = limiter
+	element, exists := rl.limiters[key]
+	if exists {
+		rl.recent.MoveToFront(element)
+	} else {
+		element = rl.recent.PushFront(&limiterEntry{key: key, limiter: rate.NewLimiter(rl.rate, rl.burst)})
+		rl.limiters[key] = element
+		// An evicted client starts over with a full bucket, which is the
+		// price of bounding memory
+		for len(rl.limiters) > rl.maxKeys {
+			rl.remove(rl.recent.Back())
+		}
 	}
+	entry := element.Value.(*limiterEntry)
+	entry.lastSeen = time.Now()
+
+	return entry.limiter
+}
 
-	return limiter
+// Allow reports whether the token bucket for key has a token left
+func (rl *RateLimiter) Allow(key string) bool {
+	return rl.GetLimiter(key).Allow()
 }
 
-// CleanupExpiredLimiters removes expired limiters to prevent memory leaks
-func (rl *RateLimiter) CleanupExpiredLimiters() {
-	ticker := time.NewTicker(time.Minute * 5)
+// Exhausted reports whether the token bucket for key is empty, without taking
+// a token, for callers that only spend tokens on some outcomes
+func (rl *RateLimiter) Exhausted(key string) bool {
+	return rl.GetLimiter(key).Tokens() < 1
+}
+
+// CleanupExpiredLimiters removes expired limiters to prevent memory leaks,
+// until ctx is done
+func (rl *RateLimiter) CleanupExpiredLimiters(ctx context.Context) {
+	ticker := time.NewTicker(rl.cleanupInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
-			rl.mu.Lock()
-			for key, limiter := range rl.limiters {
-				// Remove limiters that haven't been used in the last 5 minutes
-				if limiter.TokensAt(time.Now()) == float64(rl.burst) {
-					delete(rl.limiters, key)
-				}
-			}
-			rl.mu.Unlock()
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			rl.RemoveIdle(now)
 		}
 	}
 }
 
+// RemoveIdle deletes every limiter that has not been used since now minus the idle timeout
+func (rl *RateLimiter) RemoveIdle(now time.Time) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	// Entries are ordered by use, so the idle ones are all at the back
+	for element := rl.recent.Back(); element != nil; element = rl.recent.Back() {
+		if now.Sub(element.Value.(*limiterEntry).lastSeen) <= rl.idleTimeout {
+			break
+		}
+		rl.remove(element)
+	}
+}
+
+// remove drops a limiter; rl.mu must be held
+func (rl *RateLimiter) remove(element *list.Element) {
+	rl.recent.Remove(element)
+	delete(rl.limiters, element.Value.(*limiterEntry).key)
+}
+
+// Clients are limited per network rather than per address, so rotating through
+// addresses in a prefix (trivial within an IPv6 /64) does not evade the limit.
+// Configure sets the prefix lengths.
+var (
+	ipv4KeyPrefix = 32
+	ipv6KeyPrefix = 64
+)
+
+// LimiterKey maps a client IP to the network it is limited as. Anything that
+// does not parse as an IP is used as is.
+func LimiterKey(ip string, v4Bits, v6Bits int) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+	bits := v6Bits
+	if addr.Is4() {
+		bits = v4Bits
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
+
+// RateLimitKey is the limiter key for the request's client: its network
+func RateLimitKey(c *gin.Context) string {
+	return LimiterKey(c.ClientIP(), ipv4KeyPrefix, ipv6KeyPrefix)
+}
+
 // RateLimitMiddleware creates a rate limiting middleware
-func RateLimitMiddleware(rl *RateLimiter) gin.HandlerFunc {
+func RateLimitMiddleware(rl Limiter) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Use client IP as the key
-		key := c.ClientIP()
-		limiter := rl.GetLimiter(key)
-
-		if !limiter.Allow() {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "rate limit exceeded",
-			})
-			c.Abort()
+		// Use the client's network as the key
+		key := RateLimitKey(c)
+
+		if !rl.Allow(key) {
+			abortWithProblem(c, http.StatusTooManyRequests, CodeRateLimited, "rate limit exceeded")
 			return
 		}
 
@@ -80,17 +176,13 @@ func RateLimitMiddleware(rl *RateLimiter) gin.HandlerFunc {
 }
 
 // StrictRateLimitMiddleware creates a stricter rate limiting middleware for sensitive endpoints
-func StrictRateLimitMiddleware(rl *RateLimiter) gin.HandlerFunc {
+func StrictRateLimitMiddleware(rl Limiter) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		key := c.ClientIP()
-		limiter := rl.GetLimiter(key)
-
-		if !limiter.Allow() {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":       "rate limit exceeded",
-				"retry_after": "60s",
-			})
-			c.Abort()
+		key := RateLimitKey(c)
+
+		if !rl.Allow(key) {
+			c.Header("Retry-After", "60")
+			abortWithProblem(c, http.StatusTooManyRequests, CodeRateLimited, "rate limit exceeded, retry after 60s")
 			return
 		}
 
@@ -0,0 +1,234 @@
+package middlewares
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+func TestCleanupStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	limiter := NewRateLimiter(rate.Every(time.Second), 1, time.Millisecond, time.Millisecond)
+	sliding := NewSlidingWindowLimiter(1, time.Minute)
+
+	done := make(chan struct{}, 2)
+	go func() { limiter.CleanupExpiredLimiters(ctx); done <- struct{}{} }()
+	go func() { sliding.CleanupExpiredLimiters(ctx, time.Millisecond); done <- struct{}{} }()
+	cancel()
+	for range 2 {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("cleanup kept running after its context was cancelled")
+		}
+	}
+}
+
+func TestExhaustedTakesNoToken(t *testing.T) {
+	limiter := NewRateLimiter(rate.Every(time.Hour), 1, time.Minute, time.Minute)
+	for range 3 {
+		if limiter.Exhausted("key") {
+			t.Fatal("checking the bucket used up its token")
+		}
+	}
+	limiter.Allow("key")
+	if !limiter.Exhausted("key") {
+		t.Fatal("bucket not exhausted after its only token was taken")
+	}
+}
+
+func TestLimiterKeysAreCapped(t *testing.T) {
+	limiter := NewRateLimiter(rate.Every(time.Hour), 1, time.Minute, time.Minute)
+	limiter.maxKeys = 3
+	for _, key := range []string{"a", "b", "c"} {
+		limiter.Allow(key)
+	}
+	// Using a again leaves b as the least recently used
+	limiter.Allow("a")
+	limiter.Allow("d")
+
+	if len(limiter.limiters) != 3 || limiter.recent.Len() != 3 {
+		t.Fatalf("tracking %d keys in a list of %d, want 3", len(limiter.limiters), limiter.recent.Len())
+	}
+	if _, ok := limiter.limiters["b"]; ok {
+		t.Fatal("least recently used key not evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if !limiter.Exhausted(key) {
+			t.Fatalf("%s lost its state", key)
+		}
+	}
+	// An evicted client starts over
+	if !limiter.Allow("b") {
+		t.Fatal("evicted key still limited")
+	}
+}
+
+func TestRemoveIdle(t *testing.T) {
+	limiter := NewRateLimiter(rate.Every(time.Hour), 1, time.Minute, time.Minute)
+	limiter.Allow("idle")
+	limiter.Allow("active")
+	limiter.limiters["idle"].Value.(*limiterEntry).lastSeen = time.Now().Add(-2 * time.Minute)
+
+	limiter.RemoveIdle(time.Now())
+	if _, ok := limiter.limiters["idle"]; ok {
+		t.Fatal("idle limiter kept")
+	}
+	if _, ok := limiter.limiters["active"]; !ok || limiter.recent.Len() != 1 {
+		t.Fatal("active limiter removed")
+	}
+}
+
+func TestStrictRateLimitResponse(t *testing.T) {
+	r := gin.New()
+	r.Use(StrictRateLimitMiddleware(NewRateLimiter(rate.Every(time.Hour), 1, time.Minute, time.Minute)))
+	r.POST("/login", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", nil))
+		return w
+	}
+	if w := send(); w.Code != http.StatusOK {
+		t.Fatalf("first request: got %d", w.Code)
+	}
+	w := send()
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Fatalf("got %d with Retry-After %q, want 429 with 60", w.Code, w.Header().Get("Retry-After"))
+	}
+	var body APIError
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != CodeRateLimited {
+		t.Fatalf("body %s is not a rate_limited APIError", w.Body)
+	}
+}
+
+func TestSlidingWindowBoundary(t *testing.T) {
+	limiter := NewSlidingWindowLimiter(10, time.Minute)
+	start := time.Now().Truncate(time.Minute)
+
+	// A full window just before the boundary
+	for i := range 10 {
+		if !limiter.allowAt("key", start.Add(59*time.Second)) {
+			t.Fatalf("request %d within the limit rejected", i+1)
+		}
+	}
+	if limiter.allowAt("key", start.Add(59*time.Second)) {
+		t.Fatal("request over the limit allowed")
+	}
+	if !limiter.allowAt("other", start.Add(59*time.Second)) {
+		t.Fatal("another key shares the limit")
+	}
+	// Right after the boundary the previous window still counts almost fully
+	if limiter.allowAt("key", start.Add(61*time.Second)) {
+		t.Fatal("burst allowed across the window boundary")
+	}
+	// Halfway through the next window, half of the previous one still counts
+	allowed := 0
+	for limiter.allowAt("key", start.Add(90*time.Second)) {
+		allowed++
+	}
+	if allowed != 5 {
+		t.Fatalf("halfway through the next window: allowed %d, want 5", allowed)
+	}
+	// After two windows nothing carries over
+	allowed = 0
+	for limiter.allowAt("key", start.Add(3*time.Minute)) {
+		allowed++
+	}
+	if allowed != 10 {
+		t.Fatalf("after idle windows: allowed %d, want 10", allowed)
+	}
+}
+
+func TestSlidingWindowAllowsFewerBurstsThanTokenBucket(t *testing.T) {
+	// Both allow 10 requests a minute on average, and 10 at once
+	sliding := NewSlidingWindowLimiter(10, time.Minute)
+	bucket := NewRateLimiter(rate.Every(6*time.Second), 10, time.Minute, time.Minute).GetLimiter("key")
+
+	// Every second for two minutes, clients send as many requests as allowed
+	start := time.Now().Truncate(time.Minute)
+	var slidingAllowed, bucketAllowed int
+	for second := range 120 {
+		now := start.Add(time.Duration(second) * time.Second)
+		for sliding.allowAt("key", now) {
+			slidingAllowed++
+		}
+		for bucket.AllowN(now, 1) {
+			bucketAllowed++
+		}
+	}
+	// The bucket refills on top of its initial burst; the window never
+	// lets more than its limit through per window
+	if slidingAllowed > 20 {
+		t.Fatalf("sliding window allowed %d requests in two windows, want at most 20", slidingAllowed)
+	}
+	if bucketAllowed <= 20 {
+		t.Fatalf("token bucket allowed %d requests, expected its burst on top of the rate", bucketAllowed)
+	}
+}
+
+func TestSlidingWindowMiddleware(t *testing.T) {
+	r := gin.New()
+	r.Use(RateLimitMiddleware(NewSlidingWindowLimiter(2, time.Hour)))
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != want {
+			t.Fatalf("request %d: got %d, want %d", i+1, w.Code, want)
+		}
+	}
+}
+
+func TestLimiterKey(t *testing.T) {
+	tests := []struct {
+		ip             string
+		v4Bits, v6Bits int
+		want           string
+	}{
+		{"2001:db8:1:2:aaaa::1", 32, 64, "2001:db8:1:2::/64"},
+		{"2001:db8:1:2:bbbb::2", 32, 64, "2001:db8:1:2::/64"},
+		{"2001:db8:1:3::1", 32, 64, "2001:db8:1:3::/64"},
+		{"2001:db8:1:3::1", 32, 48, "2001:db8:1::/48"},
+		{"203.0.113.7", 32, 64, "203.0.113.7/32"},
+		{"203.0.113.7", 24, 64, "203.0.113.0/24"},
+		{"::ffff:203.0.113.7", 32, 64, "203.0.113.7/32"},
+		{"not an ip", 32, 64, "not an ip"},
+	}
+	for _, tt := range tests {
+		if got := LimiterKey(tt.ip, tt.v4Bits, tt.v6Bits); got != tt.want {
+			t.Fatalf("LimiterKey(%q, %d, %d) = %q, want %q", tt.ip, tt.v4Bits, tt.v6Bits, got, tt.want)
+		}
+	}
+}
+
+func TestIPv6NetworkSharesLimiter(t *testing.T) {
+	r := gin.New()
+	r.Use(RateLimitMiddleware(NewRateLimiter(rate.Every(time.Hour), 1, time.Minute, time.Minute)))
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+	from := func(addr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if got := from("[2001:db8::1]:40000"); got != http.StatusOK {
+		t.Fatalf("first address: got %d", got)
+	}
+	// Rotating to another address in the same /64 does not escape the limit
+	if got := from("[2001:db8::ffff:2]:40001"); got != http.StatusTooManyRequests {
+		t.Fatalf("same /64: got %d, want 429", got)
+	}
+	if got := from("[2001:db8:0:1::1]:40002"); got != http.StatusOK {
+		t.Fatalf("another /64: got %d, want 200", got)
+	}
+}
@@ -0,0 +1,54 @@
+package middlewares
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReadOnlyMode is a switch that can be flipped at runtime to block mutations
+// while reads, streaming included, keep working.
+type ReadOnlyMode struct {
+	enabled atomic.Bool
+}
+
+// NewReadOnlyMode creates a switch, initially set to enabled.
+func NewReadOnlyMode(enabled bool) *ReadOnlyMode {
+	m := &ReadOnlyMode{}
+	m.enabled.Store(enabled)
+	return m
+}
+
+// Set turns read-only mode on or off
+func (m *ReadOnlyMode) Set(enabled bool) {
+	m.enabled.Store(enabled)
+}
+
+// Enabled reports whether read-only mode is on
+func (m *ReadOnlyMode) Enabled() bool {
+	return m.enabled.Load()
+}
+
+// ReadOnlyMiddleware answers 503 to requests that may change state, anything
+// but GET, HEAD and OPTIONS, on the given routes (by full path) while read-only
+// mode is on. Other routes and safe methods are passed through.
+func ReadOnlyMiddleware(m *ReadOnlyMode, routes ...string) gin.HandlerFunc {
+	guarded := make(map[string]bool, len(routes))
+	for _, path := range routes {
+		guarded[path] = true
+	}
+
+	return func(c *gin.Context) {
+		if !m.Enabled() || !guarded[c.FullPath()] {
+			c.Next()
+			return
+		}
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+		default:
+			AbortWithError(c, http.StatusServiceUnavailable, CodeUnavailable, "service is in read-only mode")
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadOnlyMiddleware(t *testing.T) {
+	readOnly := NewReadOnlyMode(false)
+	r := gin.New()
+	r.Use(ReadOnlyMiddleware(readOnly, "/video"))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/video", ok)
+	r.DELETE("/video", ok)
+	r.POST("/login", ok)
+	send := func(method, path string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w.Code
+	}
+
+	if got := send(http.MethodDelete, "/video"); got != http.StatusOK {
+		t.Fatalf("delete while writable: got %d", got)
+	}
+	readOnly.Set(true)
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodDelete, "/video", http.StatusServiceUnavailable},
+		{http.MethodGet, "/video", http.StatusOK},
+		{http.MethodPost, "/login", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := send(tt.method, tt.path); got != tt.want {
+			t.Fatalf("%s %s in read-only mode: got %d, want %d", tt.method, tt.path, got, tt.want)
+		}
+	}
+	readOnly.Set(false)
+	if got := send(http.MethodDelete, "/video"); got != http.StatusOK {
+		t.Fatalf("delete after read-only mode: got %d", got)
+	}
+}
@@ -0,0 +1,69 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRequestIDLength caps a request ID taken from the client
+const maxRequestIDLength = 64
+
+// validRequestID reports whether id is safe to reuse: at most
+// maxRequestIDLength letters, digits and hyphens, so it cannot forge log lines
+// or bloat them.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDMiddleware tags each request with an ID, reusing the X-Request-ID
+// header when the client or a proxy already set a valid one and generating one
+// otherwise.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if !validRequestID(id) {
+			id = ""
+			buf := make([]byte, 8)
+			if _, err := rand.Read(buf); err == nil {
+				id = hex.EncodeToString(buf)
+			}
+		}
+		c.Set("requestID", id)
+		c.Header("X-Request-ID", id)
+		c.Next()
+	}
+}
+
+// RecoveryMiddleware recovers from panics in later handlers, logs them with the
+// request ID and responds with a JSON 500 instead of Gin's plain-text page.
+// http.ErrAbortHandler is passed on to net/http, which then drops the
+// connection, for handlers that must abort a response already under way.
+func RecoveryMiddleware(logger *log.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if err := recover(); err != nil {
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				logger.Printf("[%s] panic recovered: %v\n%s", c.GetString("requestID"), err, debug.Stack())
+				AbortWithError(c, http.StatusInternalServerError, CodeInternal, "internal server error")
+			}
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,95 @@
+package middlewares
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		reused bool
+	}{
+		{"valid", "abc-123-DEF", true},
+		{"longest", strings.Repeat("a", maxRequestIDLength), true},
+		{"missing", "", false},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+		{"log injection", "abc\n[admin] login ok", false},
+		{"other characters", "abc_123", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(RequestIDMiddleware())
+			var seen string
+			r.GET("/", func(c *gin.Context) {
+				seen = c.GetString("requestID")
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Request-ID", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if got := w.Header().Get("X-Request-ID"); got != seen {
+				t.Fatalf("header %q, context %q", got, seen)
+			}
+			if tt.reused && seen != tt.header {
+				t.Fatalf("got %q, want the client's %q", seen, tt.header)
+			}
+			if !tt.reused && (seen == tt.header || !validRequestID(seen)) {
+				t.Fatalf("got %q, want a generated ID", seen)
+			}
+		})
+	}
+}
+
+func TestRecoveryLetsAbortsThrough(t *testing.T) {
+	var logs bytes.Buffer
+	r := gin.New()
+	r.Use(RecoveryMiddleware(log.New(&logs, "", 0)))
+	r.GET("/video", func(c *gin.Context) {
+		c.Header("Content-Length", "10")
+		c.Status(http.StatusPartialContent)
+		c.Writer.WriteString("01234")
+		c.Writer.Flush()
+		panic(http.ErrAbortHandler)
+	})
+	r.GET("/broken", func(c *gin.Context) { panic("broken") })
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	resp, err := http.Get(server.URL + "/video")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || !errors.Is(err, io.ErrUnexpectedEOF) || string(body) != "01234" {
+		t.Fatalf("got %d with %q and %v, want the connection dropped after the bytes sent", resp.StatusCode, body, err)
+	}
+	if logs.Len() != 0 {
+		t.Fatalf("abort logged as a panic: %s", logs.String())
+	}
+
+	// Other panics still become a 500
+	resp, err = http.Get(server.URL + "/broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError || !strings.Contains(logs.String(), "panic recovered: broken") {
+		t.Fatalf("got %d, logged %q", resp.StatusCode, logs.String())
+	}
+}
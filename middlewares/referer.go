@@ -0,0 +1,37 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RefererMiddleware rejects requests whose Origin, or failing that Referer,
+// is not one of the allowed origins (e.g. "https://app.example.com").
+// An empty allowlist disables the check.
+func RefererMiddleware(allowed []string) gin.HandlerFunc {
+	origins := make(map[string]bool, len(allowed))
+	for _, origin := range allowed {
+		origins[origin] = true
+	}
+
+	return func(c *gin.Context) {
+		if len(origins) == 0 {
+			c.Next()
+			return
+		}
+
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			if ref, err := url.Parse(c.GetHeader("Referer")); err == nil && ref.Host != "" {
+				origin = ref.Scheme + "://" + ref.Host
+			}
+		}
+		if !origins[origin] {
+			AbortWithError(c, http.StatusForbidden, CodeForbidden, "referer not allowed")
+			return
+		}
+		c.Next()
+	}
+}
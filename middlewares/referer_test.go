@@ -0,0 +1,46 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRefererMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		referer string
+		want    int
+	}{
+		{"allowed origin", []string{"https://app.example.com"}, "https://app.example.com", "", http.StatusOK},
+		{"allowed referer", []string{"https://app.example.com"}, "", "https://app.example.com/watch?v=1", http.StatusOK},
+		{"other origin", []string{"https://app.example.com"}, "https://evil.example.net", "", http.StatusForbidden},
+		{"origin wins over referer", []string{"https://app.example.com"}, "https://evil.example.net", "https://app.example.com/", http.StatusForbidden},
+		{"other scheme", []string{"https://app.example.com"}, "", "http://app.example.com/", http.StatusForbidden},
+		{"neither header", []string{"https://app.example.com"}, "", "", http.StatusForbidden},
+		{"check disabled", nil, "", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/video", RefererMiddleware(tt.allowed), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodGet, "/video", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.referer != "" {
+				req.Header.Set("Referer", tt.referer)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("got %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
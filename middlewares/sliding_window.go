@@ -0,0 +1,122 @@
+package middlewares
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// windowCounter holds the request counts of a key's current and previous window
+type windowCounter struct {
+	key         string
+	windowStart time.Time
+	current     int
+	previous    int
+}
+
+// SlidingWindowLimiter allows at most limit requests per key in any window,
+// using the weighted two-window approximation: the previous window's count is
+// scaled by how much of it still overlaps the sliding window. Unlike the token
+// bucket it never permits a burst above limit across a window boundary.
+type SlidingWindowLimiter struct {
+	// counters indexes the elements of recent, which holds *windowCounter
+	// values from most to least recently used
+	counters map[string]*list.Element
+	recent   *list.List
+	maxKeys  int
+	mu       sync.Mutex
+	limit    int
+	window   time.Duration
+}
+
+// NewSlidingWindowLimiter creates a limiter allowing limit requests per window.
+// Like RateLimiter it evicts the least recently used counters whenever more
+// than maxLimiterKeys clients are tracked.
+func NewSlidingWindowLimiter(limit int, window time.Duration) *SlidingWindowLimiter {
+	return &SlidingWindowLimiter{
+		counters: make(map[string]*list.Element),
+		recent:   list.New(),
+		maxKeys:  maxLimiterKeys,
+		limit:    limit,
+		window:   window,
+	}
+}
+
+// Allow records a request for key and reports whether it is within the limit
+func (sl *SlidingWindowLimiter) Allow(key string) bool {
+	return sl.allowAt(key, time.Now())
+}
+
+func (sl *SlidingWindowLimiter) allowAt(key string, now time.Time) bool {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	element, exists := sl.counters[key]
+	if exists {
+		sl.recent.MoveToFront(element)
+	} else {
+		element = sl.recent.PushFront(&windowCounter{key: key, windowStart: now.Truncate(sl.window)})
+		sl.counters[key] = element
+		// An evicted client starts over with no requests counted
+		for len(sl.counters) > sl.maxKeys {
+			sl.remove(sl.recent.Back())
+		}
+	}
+	counter := element.Value.(*windowCounter)
+
+	// Roll the windows forward; after two or more idle windows nothing carries over
+	if elapsedWindows := int(now.Sub(counter.windowStart) / sl.window); elapsedWindows > 0 {
+		if elapsedWindows == 1 {
+			counter.previous = counter.current
+		} else {
+			counter.previous = 0
+		}
+		counter.current = 0
+		counter.windowStart = counter.windowStart.Add(time.Duration(elapsedWindows) * sl.window)
+	}
+
+	overlap := 1 - float64(now.Sub(counter.windowStart))/float64(sl.window)
+	estimate := float64(counter.previous)*overlap + float64(counter.current)
+	if estimate+1 > float64(sl.limit) {
+		return false
+	}
+	counter.current++
+	return true
+}
+
+// CleanupExpiredLimiters periodically drops counters that no longer affect any
+// decision, until ctx is done
+func (sl *SlidingWindowLimiter) CleanupExpiredLimiters(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			sl.removeExpired(now)
+		}
+	}
+}
+
+// removeExpired deletes every counter whose windows have both ended by now
+func (sl *SlidingWindowLimiter) removeExpired(now time.Time) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	// Counters are ordered by use, and so by window, so the expired ones are all at the back
+	for element := sl.recent.Back(); element != nil; element = sl.recent.Back() {
+		if now.Sub(element.Value.(*windowCounter).windowStart) < 2*sl.window {
+			break
+		}
+		sl.remove(element)
+	}
+}
+
+// remove drops a counter; sl.mu must be held
+func (sl *SlidingWindowLimiter) remove(element *list.Element) {
+	sl.recent.Remove(element)
+	delete(sl.counters, element.Value.(*windowCounter).key)
+}
@@ -0,0 +1,49 @@
+package middlewares
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlidingWindowKeysAreCapped(t *testing.T) {
+	limiter := NewSlidingWindowLimiter(1, time.Hour)
+	limiter.maxKeys = 3
+	now := time.Now()
+	for _, key := range []string{"a", "b", "c"} {
+		limiter.allowAt(key, now)
+	}
+	// Using a again leaves b as the least recently used
+	limiter.allowAt("a", now)
+	limiter.allowAt("d", now)
+
+	if len(limiter.counters) != 3 || limiter.recent.Len() != 3 {
+		t.Fatalf("tracking %d keys in a list of %d, want 3", len(limiter.counters), limiter.recent.Len())
+	}
+	if _, ok := limiter.counters["b"]; ok {
+		t.Fatal("least recently used key not evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if limiter.allowAt(key, now) {
+			t.Fatalf("%s lost its count", key)
+		}
+	}
+	// An evicted client starts over
+	if !limiter.allowAt("b", now) {
+		t.Fatal("evicted key still limited")
+	}
+}
+
+func TestSlidingWindowRemovesExpired(t *testing.T) {
+	limiter := NewSlidingWindowLimiter(1, time.Minute)
+	now := time.Now()
+	limiter.allowAt("expired", now.Add(-3*time.Minute))
+	limiter.allowAt("recent", now)
+
+	limiter.removeExpired(now)
+	if _, ok := limiter.counters["expired"]; ok {
+		t.Fatal("expired counter kept")
+	}
+	if _, ok := limiter.counters["recent"]; !ok || limiter.recent.Len() != 1 {
+		t.Fatal("recent counter removed")
+	}
+}
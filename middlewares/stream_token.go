@@ -0,0 +1,61 @@
+package middlewares
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// streamTokenAudience marks tokens that grant access to a single video.
+// JwtMiddleware refuses them, so they cannot be used against the rest of the API.
+const streamTokenAudience = "video-stream"
+
+// StreamClaims defines the payload of a stream token
+type StreamClaims struct {
+	ObjectName string `json:"objectName"`
+	jwt.RegisteredClaims
+}
+
+// GenerateStreamToken creates a token that lets its bearer stream objectName,
+// and nothing else, for ttl.
+func GenerateStreamToken(objectName string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := &StreamClaims{
+		ObjectName: objectName,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{streamTokenAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "myapp",
+		},
+	}
+	return signingKeys.signToken(jwt.NewWithClaims(signingMethod, claims))
+}
+
+// StreamTokenMiddleware checks the stream token in the token query parameter
+// and only lets the request through for the object the token was issued for.
+func StreamTokenMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenStr := c.Query("token")
+		if tokenStr == "" {
+			abortWithProblem(c, http.StatusUnauthorized, CodeUnauthorized, "missing stream token")
+			return
+		}
+
+		claims := &StreamClaims{}
+		token, err := jwt.ParseWithClaims(tokenStr, claims, signingKey, jwt.WithoutClaimsValidation())
+		if err != nil || !token.Valid || !validTimes(&claims.RegisteredClaims, time.Now()) ||
+			!claims.VerifyAudience(streamTokenAudience, true) {
+			abortWithProblem(c, http.StatusUnauthorized, CodeUnauthorized, "invalid or expired stream token")
+			return
+		}
+		if claims.ObjectName == "" || claims.ObjectName != c.Query("objectName") {
+			abortWithProblem(c, http.StatusForbidden, CodeForbidden, "stream token is not valid for this video")
+			return
+		}
+
+		c.Next()
+	}
+}
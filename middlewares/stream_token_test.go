@@ -0,0 +1,67 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestStreamToken(t *testing.T) {
+	r := gin.New()
+	r.GET("/shared/video", StreamTokenMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	stream := func(token, objectName string) int {
+		query := url.Values{"token": {token}, "objectName": {objectName}}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/shared/video?"+query.Encode(), nil))
+		return w.Code
+	}
+
+	token, err := GenerateStreamToken("shared.mp4", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := signingKeys.signToken(jwt.NewWithClaims(signingMethod, &StreamClaims{
+		ObjectName: "shared.mp4",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{streamTokenAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	userToken, err := GenerateToken("user@example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		objectName string
+		want       int
+	}{
+		{"issued object", token, "shared.mp4", http.StatusOK},
+		{"other object", token, "other.mp4", http.StatusForbidden},
+		{"expired", expired, "shared.mp4", http.StatusUnauthorized},
+		{"user token", userToken, "shared.mp4", http.StatusUnauthorized},
+		{"missing", "", "shared.mp4", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stream(tt.token, tt.objectName); got != tt.want {
+				t.Fatalf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// Stream tokens are no good for the rest of the API
+	if got := authStatus(map[string]string{"Authorization": "Bearer " + token}); got != http.StatusUnauthorized {
+		t.Fatalf("stream token through JwtMiddleware: got %d, want 401", got)
+	}
+}
@@ -0,0 +1,191 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timeoutWriter buffers a handler's response so it can be replaced by a 504
+// if the deadline passes before the handler returns. The handler runs on its
+// own goroutine, so every method holds mu.
+type timeoutWriter struct {
+	gin.ResponseWriter
+	mu      sync.Mutex
+	header  http.Header
+	body    bytes.Buffer
+	status  int
+	written bool
+	// timedOut is set once the 504 is sent; later writes are discarded
+	timedOut bool
+	// finished is set when the handler returns, after which its response is sent
+	finished bool
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.written {
+		w.status = code
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.written = true
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.written = true
+	return w.body.Write(b)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.written = true
+	return w.body.WriteString(s)
+}
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.written
+}
+
+// Flush is a no-op; the response is only sent once the handler finishes.
+func (w *timeoutWriter) Flush() {}
+
+// timeOut marks the response as timed out, unless the handler already
+// returned, and reports whether it did so.
+func (w *timeoutWriter) timeOut() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.finished {
+		return false
+	}
+	w.timedOut = true
+	return true
+}
+
+// finish marks the handler as returned
+func (w *timeoutWriter) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.finished = true
+}
+
+// TimeoutMiddleware gives each request a context deadline and answers 504
+// Gateway Timeout as soon as it passes, discarding whatever the handler writes
+// afterwards. A handler that returned in time has its response sent even if
+// the deadline passed while it was being sent. The middleware still waits for
+// the handler before returning, since the gin.Context is reused afterwards, so
+// handlers should honor the request context. Routes in exempt, given as
+// "METHOD /path" like BodyLimitMiddleware, are long-lived, like streaming and
+// uploads, and are passed through untouched.
+func TimeoutMiddleware(timeout time.Duration, exempt ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(exempt))
+	for _, route := range exempt {
+		skip[route] = true
+	}
+
+	return func(c *gin.Context) {
+		if skip[routeKey(c)] {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		original := c.Writer
+		buffered := &timeoutWriter{
+			ResponseWriter: original,
+			header:         make(http.Header),
+			status:         http.StatusOK,
+		}
+		c.Writer = buffered
+
+		done := make(chan struct{})
+		var panicked any
+		go func() {
+			defer close(done)
+			// Panics are raised again below, where the recovery middleware sees them
+			defer func() { panicked = recover() }()
+			defer buffered.finish()
+			c.Next()
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			// A client that went away gets no answer
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) && buffered.timeOut() {
+				writeTimeout(original)
+			}
+			<-done
+		}
+		c.Writer = original
+		if panicked != nil {
+			panic(panicked)
+		}
+
+		if buffered.timedOut {
+			c.Abort()
+			return
+		}
+		for key, values := range buffered.header {
+			original.Header()[key] = values
+		}
+		original.WriteHeader(buffered.status)
+		if buffered.written {
+			original.WriteHeaderNow()
+			original.Write(buffered.body.Bytes())
+		}
+	}
+}
+
+// writeTimeout sends the 504 straight to w, while the handler may still be
+// using the gin.Context
+func writeTimeout(w gin.ResponseWriter) {
+	body, _ := json.Marshal(APIError{Code: CodeTimeout, Message: "request timed out"})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusGatewayTimeout)
+	w.Write(body)
+	w.Flush()
+}
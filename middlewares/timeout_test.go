@@ -0,0 +1,82 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func timeoutRouter(timeout time.Duration) *gin.Engine {
+	r := gin.New()
+	r.Use(TimeoutMiddleware(timeout, "GET /exempt"))
+	// slow ignores its deadline for a while before answering
+	slow := func(c *gin.Context) {
+		time.Sleep(50 * time.Millisecond)
+		c.String(http.StatusOK, "late")
+	}
+	r.GET("/slow", slow)
+	r.GET("/exempt", slow)
+	r.DELETE("/exempt", slow)
+	r.GET("/fast", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	// blocked only returns once its request is cancelled
+	r.GET("/blocked", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		c.String(http.StatusOK, "too late")
+	})
+	return r
+}
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/fast", http.StatusOK},
+		{http.MethodGet, "/slow", http.StatusGatewayTimeout},
+		{http.MethodGet, "/blocked", http.StatusGatewayTimeout},
+		{http.MethodGet, "/exempt", http.StatusOK},
+		// Exemptions name the method too
+		{http.MethodDelete, "/exempt", http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			timeoutRouter(10*time.Millisecond).ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.want {
+				t.Fatalf("got %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestTimeoutAnswersAtDeadline(t *testing.T) {
+	r := gin.New()
+	r.Use(TimeoutMiddleware(10 * time.Millisecond))
+	release := make(chan struct{})
+	r.GET("/stuck", func(c *gin.Context) {
+		<-release
+		c.String(http.StatusOK, "too late")
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+	defer close(release)
+
+	start := time.Now()
+	resp, err := http.Get(server.URL + "/stuck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Fatalf("got %d, want 504", resp.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("504 took %v; the handler held it back", elapsed)
+	}
+}
@@ -0,0 +1,69 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	var handlerSpan trace.SpanContext
+	r := gin.New()
+	r.Use(TracingMiddleware())
+	r.GET("/videos/:id", func(c *gin.Context) {
+		// Child spans started from the request context join the request's trace
+		_, child := otel.Tracer("test").Start(c.Request.Context(), "child")
+		handlerSpan = child.SpanContext()
+		child.End()
+		c.Status(http.StatusOK)
+	})
+	r.GET("/fail", func(c *gin.Context) { c.Status(http.StatusInternalServerError) })
+
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest(http.MethodGet, "/videos/42", nil)
+	req.Header.Set("traceparent", parent)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want the child and one per request", len(spans))
+	}
+	child, server, failed := spans[0], spans[1], spans[2]
+	if server.Name != "GET /videos/:id" || server.SpanKind != trace.SpanKindServer {
+		t.Fatalf("got span %q of kind %v", server.Name, server.SpanKind)
+	}
+	if got := server.SpanContext.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("request span has trace %s, want the propagated one", got)
+	}
+	if server.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("request span has parent %s", server.Parent.SpanID())
+	}
+	if child.Parent.SpanID() != server.SpanContext.SpanID() || handlerSpan.TraceID() != server.SpanContext.TraceID() {
+		t.Fatal("span started in the handler is not a child of the request span")
+	}
+	if failed.Status.Code != codes.Error {
+		t.Fatalf("500 response: got span status %v", failed.Status.Code)
+	}
+	if server.Status.Code == codes.Error {
+		t.Fatal("200 response marked as an error")
+	}
+}
@@ -0,0 +1,66 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// Report fields by their JSON names rather than Go struct field names
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "-" || name == "" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+// validationMessage turns a failed validation rule into a human-readable message
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	default:
+		return "is invalid"
+	}
+}
+
+// RespondBindError writes a 400 for a failed ShouldBind call. Validation
+// failures are reported per field, e.g.
+// {"code":"validation_failed","error":"validation failed","fields":{"email":"must be a valid email address"}};
+// anything else, such as malformed JSON, gets a generic message.
+func RespondBindError(c *gin.Context, err error) {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		RespondError(c, http.StatusBadRequest, CodeInvalidRequest, "invalid request body")
+		return
+	}
+
+	fields := make(map[string]string, len(verrs))
+	for _, fe := range verrs {
+		fields[fe.Field()] = validationMessage(fe)
+	}
+	c.JSON(http.StatusBadRequest, APIError{Code: CodeValidationFailed, Message: "validation failed", Fields: fields})
+}
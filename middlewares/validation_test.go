@@ -0,0 +1,55 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRespondBindError(t *testing.T) {
+	r := gin.New()
+	r.POST("/register", func(c *gin.Context) {
+		var req struct {
+			Username string `json:"username" binding:"required,max=5"`
+			Email    string `json:"email" binding:"required,email"`
+			Age      int    `json:"age" binding:"min=18"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			RespondBindError(c, err)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	post := func(body string) (int, APIError) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body)))
+		var apiErr APIError
+		json.Unmarshal(w.Body.Bytes(), &apiErr)
+		return w.Code, apiErr
+	}
+
+	status, apiErr := post(`{"username":"toolong","email":"nope","age":3}`)
+	want := map[string]string{
+		"username": "must be at most 5 characters",
+		"email":    "must be a valid email address",
+		"age":      "must be at least 18",
+	}
+	if status != http.StatusBadRequest || apiErr.Code != CodeValidationFailed || !maps.Equal(apiErr.Fields, want) {
+		t.Fatalf("got %d %+v", status, apiErr)
+	}
+
+	status, apiErr = post(`{"age":18}`)
+	if apiErr.Fields["username"] != "is required" || apiErr.Fields["email"] != "is required" {
+		t.Fatalf("missing fields: got %d %+v", status, apiErr)
+	}
+
+	status, apiErr = post(`{not json`)
+	if status != http.StatusBadRequest || apiErr.Code != CodeInvalidRequest || apiErr.Fields != nil {
+		t.Fatalf("malformed JSON: got %d %+v", status, apiErr)
+	}
+}
@@ -0,0 +1,122 @@
+//go:build integration
+
+package router
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"db"
+	. "middlewares"
+)
+
+func TestDeleteAccountRevokesTokens(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+
+	resp := server.request(t, http.MethodDelete, "/api/profile", user.token, map[string]string{"password": "wrong"})
+	decodeResponse(t, resp, http.StatusUnauthorized, nil)
+
+	resp = server.request(t, http.MethodDelete, "/api/profile", user.token, map[string]string{"password": user.password})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	resp = server.request(t, http.MethodGet, "/api/profile", user.token, nil)
+	decodeResponse(t, resp, http.StatusUnauthorized, nil)
+	resp = server.request(t, http.MethodPost, "/api/login", "", map[string]string{"email": user.email, "password": user.password})
+	decodeResponse(t, resp, http.StatusUnauthorized, nil)
+}
+
+func TestDeletedAccountTokensAreRejected(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+	resp := server.request(t, http.MethodDelete, "/api/profile", user.token, map[string]string{"password": user.password})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	// A token the revocation does not cover, as after a restart or from
+	// another instance
+	token, err := GenerateToken(user.email, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = server.upload(t, token, "a.mp4", []byte("video"), map[string]string{"objectName": uniqueName(t, "deleted") + ".mp4"})
+	decodeResponse(t, resp, http.StatusUnauthorized, nil)
+	resp = server.request(t, http.MethodGet, "/api/video/objects", token, nil)
+	decodeResponse(t, resp, http.StatusUnauthorized, nil)
+}
+
+func TestOverwriteKeepsUploader(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	owner := server.register(t)
+	objectName := uniqueName(t, "owned") + ".mp4"
+
+	for _, content := range []string{"first", "second"} {
+		resp := server.upload(t, owner.token, "a.mp4", []byte(content), map[string]string{"objectName": objectName})
+		decodeResponse(t, resp, http.StatusOK, nil)
+	}
+
+	video, err := testDB.Video.FindUnique(db.Video.ObjectName.Equals(objectName)).Exec(context.Background())
+	if err != nil {
+		t.Fatalf("looking up video: %v", err)
+	}
+	user, err := testDB.User.FindUnique(db.User.Email.Equals(owner.email)).Exec(context.Background())
+	if err != nil {
+		t.Fatalf("looking up user: %v", err)
+	}
+	if video.UploaderID != user.ID {
+		t.Fatalf("video belongs to %s, want %s", video.UploaderID, user.ID)
+	}
+}
+
+func TestDeletedAccountCanBeRestored(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	admin := server.registerAdmin(t)
+	user := server.register(t)
+	objectName := uniqueName(t, "kept") + ".mp4"
+	resp := server.upload(t, user.token, "a.mp4", []byte("kept video"), map[string]string{"objectName": objectName})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	resp = server.request(t, http.MethodDelete, "/api/profile", user.token, map[string]string{"password": user.password})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	// The row and the video are kept, only marked as deleted
+	ctx := context.Background()
+	stored, err := testDB.User.FindUnique(db.User.Email.Equals(user.email)).Exec(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, deleted := stored.DeletedAt(); !deleted {
+		t.Fatal("deleted account has no deletedAt")
+	}
+	if _, err := testDB.Video.FindUnique(db.Video.ObjectName.Equals(objectName)).Exec(ctx); err != nil {
+		t.Fatalf("video of the deleted account: %v", err)
+	}
+	// The email stays taken
+	resp = server.request(t, http.MethodPost, "/api/register", "", map[string]any{
+		"username": "Someone Else",
+		"password": "another password",
+		"email":    user.email,
+		"age":      30,
+	})
+	decodeResponse(t, resp, http.StatusConflict, nil)
+
+	credentials := map[string]string{"email": user.email, "password": user.password}
+	resp = server.request(t, http.MethodPost, "/api/login", "", credentials)
+	decodeResponse(t, resp, http.StatusUnauthorized, nil)
+
+	restore := map[string]string{"email": user.email}
+	resp = server.request(t, http.MethodPost, "/api/admin/users/restore", server.register(t).token, restore)
+	decodeResponse(t, resp, http.StatusForbidden, nil)
+	resp = server.request(t, http.MethodPost, "/api/admin/users/restore", admin.token, map[string]string{"email": "nobody-" + user.email})
+	decodeResponse(t, resp, http.StatusNotFound, nil)
+	resp = server.request(t, http.MethodPost, "/api/admin/users/restore", admin.token, restore)
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	resp = server.request(t, http.MethodPost, "/api/login", "", credentials)
+	var login struct {
+		Token string `json:"token"`
+	}
+	decodeResponse(t, resp, http.StatusOK, &login)
+	resp = server.request(t, http.MethodGet, "/api/video?objectName="+objectName, login.Token, nil)
+	decodeResponse(t, resp, http.StatusOK, nil)
+}
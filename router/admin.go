@@ -0,0 +1,167 @@
+package router
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"db"
+	. "middlewares"
+)
+
+// adminRole is the User.role value granting access to admin routes
+const adminRole = "admin"
+
+// adminOnly lets the request through only if the authenticated user is an active admin.
+// The role is read from the database so revoking it takes effect immediately.
+func adminOnly(database *db.PrismaClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := findActiveUser(c.Request.Context(), database, c.GetString("email"))
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			AbortWithError(c, http.StatusInternalServerError, CodeInternal, "could not verify role")
+			return
+		}
+		if err != nil || user.Role != adminRole {
+			AbortWithError(c, http.StatusForbidden, CodeForbidden, "admin access required")
+			return
+		}
+		c.Next()
+	}
+}
+
+// restoreUser clears the soft-delete marker of an account so it can log in again.
+func restoreUser(database *db.PrismaClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Email string `json:"email" binding:"required,email"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			RespondBindError(c, err)
+			return
+		}
+		email, err := NormalizeEmail(req.Email)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+
+		_, err = database.User.FindUnique(
+			db.User.Email.Equals(email),
+		).Update(
+			db.User.DeletedAt.SetOptional(nil),
+		).Exec(c.Request.Context())
+		if errors.Is(err, db.ErrNotFound) {
+			RespondError(c, http.StatusNotFound, CodeNotFound, "user not found")
+			return
+		}
+		if err != nil {
+			RespondError(c, http.StatusInternalServerError, CodeInternal, "could not restore user")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "user restored"})
+	}
+}
+
+// maintenanceStatus reports whether maintenance mode is on.
+func maintenanceStatus(maintenance *MaintenanceMode) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"enabled": maintenance.Enabled()})
+	}
+}
+
+// setMaintenance turns maintenance mode on or off.
+func setMaintenance(maintenance *MaintenanceMode) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Enabled *bool `json:"enabled" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			RespondBindError(c, err)
+			return
+		}
+		maintenance.Set(*req.Enabled)
+		log.Printf("Maintenance mode set to %v by %s\n", *req.Enabled, c.GetString("email"))
+		c.JSON(http.StatusOK, gin.H{"enabled": *req.Enabled})
+	}
+}
+
+// readOnlyStatus reports whether read-only mode is on.
+func readOnlyStatus(readOnly *ReadOnlyMode) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"enabled": readOnly.Enabled()})
+	}
+}
+
+// setReadOnly turns read-only mode on or off.
+func setReadOnly(readOnly *ReadOnlyMode) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Enabled *bool `json:"enabled" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			RespondBindError(c, err)
+			return
+		}
+		readOnly.Set(*req.Enabled)
+		log.Printf("Read-only mode set to %v by %s\n", *req.Enabled, c.GetString("email"))
+		c.JSON(http.StatusOK, gin.H{"enabled": *req.Enabled})
+	}
+}
+
+// setUploadQuota sets or, with a null quotaMB, clears a user's upload quota override.
+func setUploadQuota(database *db.PrismaClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Email   string `json:"email" binding:"required,email"`
+			QuotaMB *int   `json:"quotaMB" binding:"omitempty,min=0"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			RespondBindError(c, err)
+			return
+		}
+		email, err := NormalizeEmail(req.Email)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+
+		_, err = database.User.FindUnique(
+			db.User.Email.Equals(email),
+		).Update(
+			db.User.UploadQuotaMB.SetOptional(req.QuotaMB),
+		).Exec(c.Request.Context())
+		if errors.Is(err, db.ErrNotFound) {
+			RespondError(c, http.StatusNotFound, CodeNotFound, "user not found")
+			return
+		}
+		if err != nil {
+			RespondError(c, http.StatusInternalServerError, CodeInternal, "could not update quota")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"email": email, "quotaMB": req.QuotaMB})
+	}
+}
+
+// rotateSigningKey switches token signing to a fresh key on every instance.
+// Tokens signed with the old one keep working for grace.
+func rotateSigningKey(grace time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kid, err := RotateSigningKey(c.Request.Context(), grace)
+		if errors.Is(err, ErrRotationConflict) {
+			RespondError(c, http.StatusConflict, CodeConflict, "signing key was rotated concurrently, try again")
+			return
+		}
+		if err != nil {
+			RespondError(c, http.StatusInternalServerError, CodeInternal, "could not generate signing key")
+			return
+		}
+		log.Printf("JWT signing key rotated to %s by %s\n", kid, c.GetString("email"))
+		c.JSON(http.StatusOK, gin.H{
+			"kid":                kid,
+			"previousValidUntil": time.Now().Add(grace).UTC(),
+		})
+	}
+}
@@ -0,0 +1,141 @@
+//go:build integration
+
+package router
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRotateSigningKey(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	admin := server.registerAdmin(t)
+	user := server.register(t)
+
+	resp := server.request(t, http.MethodPost, "/api/admin/jwt/rotate", user.token, nil)
+	decodeResponse(t, resp, http.StatusForbidden, nil)
+
+	resp = server.request(t, http.MethodPost, "/api/admin/jwt/rotate", admin.token, nil)
+	var rotated struct {
+		Kid string `json:"kid"`
+	}
+	decodeResponse(t, resp, http.StatusOK, &rotated)
+	if rotated.Kid == "" {
+		t.Fatal("no kid in the response")
+	}
+
+	// Tokens signed with the previous key stay valid during the grace window
+	resp = server.request(t, http.MethodGet, "/api/profile", user.token, nil)
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	// A restarted instance keeps signing with the rotated key
+	restarted := newTestServer(t, testConfig(t))
+	fresh := restarted.register(t)
+	resp = server.request(t, http.MethodGet, "/api/profile", fresh.token, nil)
+	decodeResponse(t, resp, http.StatusOK, nil)
+}
+
+func TestMetricsRequireAdmin(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	admin := server.registerAdmin(t)
+	user := server.register(t)
+
+	resp := server.request(t, http.MethodGet, "/api/admin/metrics", "", nil)
+	decodeResponse(t, resp, http.StatusUnauthorized, nil)
+	resp = server.request(t, http.MethodGet, "/api/admin/metrics", user.token, nil)
+	decodeResponse(t, resp, http.StatusForbidden, nil)
+	resp = server.request(t, http.MethodGet, "/api/metrics", "", nil)
+	decodeResponse(t, resp, http.StatusNotFound, nil)
+
+	resp = server.request(t, http.MethodGet, "/api/admin/metrics", admin.token, nil)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "video_active_streams") {
+		t.Fatalf("got %d %q, want the metrics", resp.StatusCode, body)
+	}
+}
+
+func TestMaintenanceBlocksWrites(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	admin := server.registerAdmin(t)
+	user := server.register(t)
+	objectName := uniqueName(t, "before") + ".mp4"
+	resp := server.upload(t, user.token, "a.mp4", []byte("uploaded before"), map[string]string{"objectName": objectName})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	setMaintenance := func(token string, enabled bool) *http.Response {
+		return server.request(t, http.MethodPut, "/api/admin/maintenance", token, map[string]bool{"enabled": enabled})
+	}
+	decodeResponse(t, setMaintenance(user.token, true), http.StatusForbidden, nil)
+	decodeResponse(t, setMaintenance(admin.token, true), http.StatusOK, nil)
+	var status struct {
+		Enabled bool `json:"enabled"`
+	}
+	decodeResponse(t, server.request(t, http.MethodGet, "/api/admin/maintenance", admin.token, nil), http.StatusOK, &status)
+	if !status.Enabled {
+		t.Fatal("maintenance mode not reported as enabled")
+	}
+
+	resp = server.upload(t, user.token, "b.mp4", []byte("uploaded during"), nil)
+	if resp.Header.Get("Retry-After") != "60" {
+		t.Fatalf("got Retry-After %q, want 60", resp.Header.Get("Retry-After"))
+	}
+	decodeResponse(t, resp, http.StatusServiceUnavailable, nil)
+	resp = server.request(t, http.MethodPost, "/api/register", "", map[string]any{
+		"username": "Test User",
+		"password": "correct horse battery",
+		"email":    uniqueName(t, "user") + "@example.com",
+		"age":      30,
+	})
+	decodeResponse(t, resp, http.StatusServiceUnavailable, nil)
+	// Reads stay available
+	resp = server.request(t, http.MethodGet, "/api/video?objectName="+objectName, user.token, nil)
+	decodeResponse(t, resp, http.StatusOK, nil)
+	resp = server.request(t, http.MethodGet, "/api/profile", user.token, nil)
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	decodeResponse(t, setMaintenance(admin.token, false), http.StatusOK, nil)
+	resp = server.upload(t, user.token, "b.mp4", []byte("uploaded after"), nil)
+	decodeResponse(t, resp, http.StatusOK, nil)
+}
+
+func TestReadOnlyBlocksMutations(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	admin := server.registerAdmin(t)
+	user := server.register(t)
+	objectName := uniqueName(t, "kept") + ".mp4"
+	resp := server.upload(t, user.token, "a.mp4", []byte("kept video"), map[string]string{"objectName": objectName})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	setReadOnly := func(token string, enabled bool) *http.Response {
+		return server.request(t, http.MethodPut, "/api/admin/read-only", token, map[string]bool{"enabled": enabled})
+	}
+	decodeResponse(t, setReadOnly(user.token, true), http.StatusForbidden, nil)
+	decodeResponse(t, setReadOnly(admin.token, true), http.StatusOK, nil)
+	var status struct {
+		Enabled bool `json:"enabled"`
+	}
+	decodeResponse(t, server.request(t, http.MethodGet, "/api/admin/read-only", admin.token, nil), http.StatusOK, &status)
+	if !status.Enabled {
+		t.Fatal("read-only mode not reported as enabled")
+	}
+
+	decodeResponse(t, server.upload(t, user.token, "b.mp4", []byte("new video"), nil), http.StatusServiceUnavailable, nil)
+	resp = server.request(t, http.MethodDelete, "/api/video?objectName="+objectName, user.token, nil)
+	decodeResponse(t, resp, http.StatusServiceUnavailable, nil)
+	resp = server.request(t, http.MethodPut, "/api/profile", user.token, map[string]any{"age": 31})
+	decodeResponse(t, resp, http.StatusServiceUnavailable, nil)
+	// Streaming, profile reads and logins still work
+	resp = server.request(t, http.MethodGet, "/api/video?objectName="+objectName, user.token, nil)
+	decodeResponse(t, resp, http.StatusOK, nil)
+	resp = server.request(t, http.MethodGet, "/api/profile", user.token, nil)
+	decodeResponse(t, resp, http.StatusOK, nil)
+	resp = server.request(t, http.MethodPost, "/api/login", "", map[string]string{"email": user.email, "password": user.password})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	decodeResponse(t, setReadOnly(admin.token, false), http.StatusOK, nil)
+	resp = server.request(t, http.MethodDelete, "/api/video?objectName="+objectName, user.token, nil)
+	decodeResponse(t, resp, http.StatusOK, nil)
+}
@@ -0,0 +1,111 @@
+package router
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"db"
+	. "middlewares"
+)
+
+// Audit event types
+const (
+	AuditLogin           = "login"
+	AuditLoginFailed     = "login_failed"
+	AuditRegister        = "register"
+	AuditAccountDeleted  = "account_deleted"
+	AuditPasswordChanged = "password_changed"
+	AuditLogout          = "logout"
+)
+
+// auditQueueSize is how many events may wait to be written before new ones are dropped
+const auditQueueSize = 1024
+
+// maxAuditEmailLength caps the email recorded for failed logins, which is
+// whatever the client sent; no valid address is longer
+const maxAuditEmailLength = 254
+
+// auditEmail is how an email sent to login is recorded: normalized, or when it
+// is not a valid address, lowercased and cut to maxAuditEmailLength bytes.
+func auditEmail(email string) string {
+	if normalized, err := NormalizeEmail(email); err == nil {
+		return normalized
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	if len(email) > maxAuditEmailLength {
+		// Drop a rune cut in half
+		email = strings.ToValidUTF8(email[:maxAuditEmailLength], "")
+	}
+	return email
+}
+
+// AuditEvent records a security-relevant action on an account
+type AuditEvent struct {
+	Type  string
+	Email string
+	IP    string
+	Time  time.Time
+}
+
+// AuditLogger keeps the audit trail of auth events. Log must not block the request.
+type AuditLogger interface {
+	Log(event AuditEvent)
+}
+
+// dbAuditLogger writes events to the AuditEvent table from a background
+// goroutine, so auth requests never wait on the database for their audit record.
+type dbAuditLogger struct {
+	database *db.PrismaClient
+	events   chan AuditEvent
+}
+
+// NewDBAuditLogger starts an AuditLogger backed by the AuditEvent table.
+// When writes fall behind by more than auditQueueSize events, further events
+// are dropped and reported in the log.
+func NewDBAuditLogger(database *db.PrismaClient) AuditLogger {
+	logger := &dbAuditLogger{
+		database: database,
+		events:   make(chan AuditEvent, auditQueueSize),
+	}
+	go logger.run()
+	return logger
+}
+
+func (l *dbAuditLogger) Log(event AuditEvent) {
+	select {
+	case l.events <- event:
+	default:
+		log.Printf("Audit queue full, dropped %s event for %s\n", event.Type, event.Email)
+	}
+}
+
+// run writes queued events until the process exits
+func (l *dbAuditLogger) run() {
+	for event := range l.events {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := l.database.AuditEvent.CreateOne(
+			db.AuditEvent.Type.Set(event.Type),
+			db.AuditEvent.Email.Set(event.Email),
+			db.AuditEvent.IP.Set(event.IP),
+			db.AuditEvent.OccurredAt.Set(event.Time),
+		).Exec(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to write %s audit event for %s: %v\n", event.Type, event.Email, err)
+		}
+	}
+}
+
+// audit records an event of eventType for email from the request's client.
+func audit(c *gin.Context, logger AuditLogger, eventType, email string) {
+	logger.Log(AuditEvent{
+		Type:  eventType,
+		Email: email,
+		IP:    c.ClientIP(),
+		Time:  time.Now(),
+	})
+}
@@ -0,0 +1,96 @@
+//go:build integration
+
+package router
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// batchFile is one part of a batch upload
+type batchFile struct {
+	filename   string
+	content    string
+	contentMD5 string
+}
+
+// uploadBatch sends files as the "files" parts of a batch upload
+func (s *testServer) uploadBatch(t *testing.T, token string, files []batchFile) *http.Response {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for _, file := range files {
+		part := make(textproto.MIMEHeader)
+		part.Set("Content-Disposition", `form-data; name="files"; filename="`+file.filename+`"`)
+		part.Set("Content-Type", "video/mp4")
+		if file.contentMD5 != "" {
+			part.Set("Content-MD5", file.contentMD5)
+		}
+		w, err := form.CreatePart(part)
+		if err != nil {
+			t.Fatalf("building upload: %v", err)
+		}
+		w.Write([]byte(file.content))
+	}
+	form.Close()
+
+	req, err := http.NewRequest(http.MethodPost, s.URL+"/api/video/upload-batch", &body)
+	if err != nil {
+		t.Fatalf("building upload: %v", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return s.do(t, req, token)
+}
+
+// batchResult is the outcome of one file of a batch upload
+type batchResult struct {
+	File       string `json:"file"`
+	Success    bool   `json:"success"`
+	Status     int    `json:"status"`
+	ObjectName string `json:"objectName"`
+}
+
+func TestBatchUpload(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+
+	var batch struct {
+		Results []batchResult `json:"results"`
+	}
+	resp := server.uploadBatch(t, user.token, []batchFile{
+		{filename: "first.mp4", content: "first"},
+		{filename: "second.mp4", content: "second"},
+	})
+	decodeResponse(t, resp, http.StatusOK, &batch)
+	if len(batch.Results) != 2 {
+		t.Fatalf("got %d results, want 2", len(batch.Results))
+	}
+	for i, want := range []string{"first", "second"} {
+		result := batch.Results[i]
+		if !result.Success || !strings.HasSuffix(result.ObjectName, want+".mp4") {
+			t.Fatalf("result %d: %+v", i, result)
+		}
+		resp := server.request(t, http.MethodGet, "/api/video?objectName="+result.ObjectName, user.token, nil)
+		if streamed, _ := io.ReadAll(resp.Body); string(streamed) != want {
+			t.Fatalf("%s holds %q", result.ObjectName, streamed)
+		}
+	}
+
+	// One bad file does not stop the others
+	resp = server.uploadBatch(t, user.token, []batchFile{
+		{filename: "good.mp4", content: "good"},
+		{filename: "corrupt.mp4", content: "corrupt", contentMD5: "AAAAAAAAAAAAAAAAAAAAAA=="},
+	})
+	decodeResponse(t, resp, http.StatusMultiStatus, &batch)
+	if len(batch.Results) != 2 || !batch.Results[0].Success || batch.Results[1].Success || batch.Results[1].Status != http.StatusBadRequest {
+		t.Fatalf("got %+v", batch.Results)
+	}
+
+	resp = server.uploadBatch(t, user.token, nil)
+	decodeResponse(t, resp, http.StatusBadRequest, nil)
+}
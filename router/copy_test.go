@@ -0,0 +1,88 @@
+//go:build integration
+
+package router
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	. "middlewares"
+)
+
+func TestCopyVideo(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	owner, other := server.register(t), server.register(t)
+	source := uniqueName(t, "source") + ".mp4"
+	resp := server.upload(t, owner.token, "a.mp4", []byte("original"), map[string]string{"objectName": source})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	destination := uniqueName(t, "copy") + ".mp4"
+	resp = server.request(t, http.MethodPost, "/api/video/copy", owner.token, map[string]string{
+		"source":      source,
+		"destination": destination,
+	})
+	var copied struct {
+		ObjectName  string `json:"objectName"`
+		ContentType string `json:"contentType"`
+	}
+	decodeResponse(t, resp, http.StatusOK, &copied)
+	if copied.ObjectName != destination || copied.ContentType != "video/mp4" {
+		t.Fatalf("got %+v", copied)
+	}
+	resp = server.request(t, http.MethodGet, "/api/video?objectName="+destination, owner.token, nil)
+	if streamed, _ := io.ReadAll(resp.Body); string(streamed) != "original" {
+		t.Fatalf("copy holds %q", streamed)
+	}
+
+	tests := []struct {
+		name        string
+		token       string
+		source      string
+		destination string
+		want        int
+	}{
+		{"existing destination", owner.token, source, destination, http.StatusConflict},
+		{"another user's video", other.token, source, uniqueName(t, "stolen") + ".mp4", http.StatusNotFound},
+		{"missing source", owner.token, uniqueName(t, "missing") + ".mp4", uniqueName(t, "copy") + ".mp4", http.StatusNotFound},
+		{"invalid destination", owner.token, source, "../escape.mp4", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := server.request(t, http.MethodPost, "/api/video/copy", tt.token, map[string]string{
+				"source":      tt.source,
+				"destination": tt.destination,
+			})
+			decodeResponse(t, resp, tt.want, nil)
+		})
+	}
+}
+
+func TestVideoRequestsReportInvalidFields(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+	tests := []struct {
+		method string
+		path   string
+		field  string
+	}{
+		{http.MethodPost, "/api/video/copy", "destination"},
+		{http.MethodPut, "/api/video/rename", "to"},
+		{http.MethodPut, "/api/video/visibility", "public"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			// Each body leaves out one required field
+			resp := server.request(t, tt.method, tt.path, user.token, map[string]string{
+				"source":     "a.mp4",
+				"from":       "a.mp4",
+				"objectName": "a.mp4",
+			})
+			var body APIError
+			decodeResponse(t, resp, http.StatusBadRequest, &body)
+			if body.Code != CodeValidationFailed || body.Fields[tt.field] == "" {
+				t.Fatalf("got %+v, want %s reported", body, tt.field)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+//go:build integration
+
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStartsWithoutMinIO(t *testing.T) {
+	cfg := testConfig(t)
+	// Nothing listens there, so the video service never becomes ready
+	cfg.MinIO.Endpoint = "127.0.0.1:1"
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	server := &testServer{Server: httptest.NewServer(SetupRouter(ctx, testDB, cfg))}
+	t.Cleanup(server.Close)
+
+	// Routes that only need the database keep working
+	user := server.register(t)
+	resp := server.request(t, http.MethodGet, "/api/profile", user.token, nil)
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	for _, path := range []string{"/api/video?objectName=a.mp4", "/api/video/objects", "/api/video/info?objectName=a.mp4"} {
+		resp := server.request(t, http.MethodGet, path, user.token, nil)
+		decodeResponse(t, resp, http.StatusServiceUnavailable, nil)
+		if resp.Header.Get("Retry-After") == "" {
+			t.Fatalf("%s: no Retry-After", path)
+		}
+	}
+	resp = server.upload(t, user.token, "a.mp4", []byte("video"), nil)
+	decodeResponse(t, resp, http.StatusServiceUnavailable, nil)
+}
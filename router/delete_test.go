@@ -0,0 +1,59 @@
+//go:build integration
+
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"db"
+	. "services"
+)
+
+func TestFailedDeleteKeepsTheVideo(t *testing.T) {
+	// MinIO behind a proxy that refuses to delete anything
+	target := &url.URL{Scheme: "http", Host: testMinioCfg.Endpoint}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	refusing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>Access Denied.</Message></Error>`))
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	t.Cleanup(refusing.Close)
+
+	cfg := testConfig(t)
+	minioCfg := testMinioCfg
+	minioCfg.Endpoint = strings.TrimPrefix(refusing.URL, "http://")
+	client, err := NewMinioClient(minioCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	httpServer := httptest.NewServer(SetupRouterWithStreaming(ctx, testDB, cfg, NewStreamingWithClient(testDB, cfg, client)))
+	t.Cleanup(httpServer.Close)
+	server := &testServer{Server: httpServer}
+
+	user := server.register(t)
+	objectName := uniqueName(t, "kept") + ".mp4"
+	resp := server.upload(t, user.token, "a.mp4", []byte("video"), map[string]string{"objectName": objectName})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	resp = server.request(t, http.MethodDelete, "/api/video?objectName="+objectName, user.token, nil)
+	decodeResponse(t, resp, http.StatusInternalServerError, nil)
+
+	// The object is still there, and so is its record
+	if _, err := testDB.Video.FindUnique(db.Video.ObjectName.Equals(objectName)).Exec(context.Background()); err != nil {
+		t.Fatalf("record of the video that was not deleted: %v", err)
+	}
+	resp = server.request(t, http.MethodGet, "/api/video?objectName="+objectName, user.token, nil)
+	decodeResponse(t, resp, http.StatusOK, nil)
+}
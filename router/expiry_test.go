@@ -0,0 +1,65 @@
+//go:build integration
+
+package router
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestExpiredUploadsAreRemoved(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+	objectName := uniqueName(t, "ephemeral") + ".mp4"
+
+	resp := server.upload(t, user.token, "a.mp4", []byte("short-lived"), map[string]string{
+		"objectName": objectName,
+		"expiresIn":  "1",
+	})
+	var uploaded struct {
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+	decodeResponse(t, resp, http.StatusOK, &uploaded)
+	if uploaded.ExpiresAt.IsZero() {
+		t.Fatal("response has no expiresAt")
+	}
+
+	// Nothing has expired yet
+	if _, err := server.streaming.RemoveExpired(context.Background(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	resp = server.request(t, http.MethodGet, "/api/video?objectName="+objectName, user.token, nil)
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	if _, err := server.streaming.RemoveExpired(context.Background(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	resp = server.request(t, http.MethodGet, "/api/video?objectName="+objectName, user.token, nil)
+	decodeResponse(t, resp, http.StatusNotFound, nil)
+}
+
+func TestReuploadedVideoSurvivesSweep(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+	objectName := uniqueName(t, "kept") + ".mp4"
+
+	resp := server.upload(t, user.token, "a.mp4", []byte("first"), map[string]string{
+		"objectName": objectName,
+		"expiresIn":  "1",
+	})
+	decodeResponse(t, resp, http.StatusOK, nil)
+	// Overwriting without expiresIn keeps the video for good
+	resp = server.upload(t, user.token, "a.mp4", []byte("second"), map[string]string{"objectName": objectName})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	if _, err := server.streaming.RemoveExpired(context.Background(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	resp = server.request(t, http.MethodGet, "/api/video?objectName="+objectName, user.token, nil)
+	if body, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusOK || string(body) != "second" {
+		t.Fatalf("got %d %q, want the second upload", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,75 @@
+//go:build integration
+
+package router
+
+import (
+	"maps"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestVideoInfo(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+	objectName := uniqueName(t, "described") + ".mp4"
+	resp := server.upload(t, user.token, "a.mp4", []byte("twelve bytes"), map[string]string{"objectName": objectName})
+	var uploaded struct {
+		ETag string `json:"etag"`
+	}
+	decodeResponse(t, resp, http.StatusOK, &uploaded)
+
+	resp = server.request(t, http.MethodGet, "/api/video/info?objectName="+objectName, user.token, nil)
+	var info struct {
+		ObjectName  string `json:"objectName"`
+		Size        int64  `json:"size"`
+		ContentType string `json:"contentType"`
+		ETag        string `json:"etag"`
+	}
+	decodeResponse(t, resp, http.StatusOK, &info)
+	if info.ObjectName != objectName || info.Size != 12 || info.ContentType != "video/mp4" || info.ETag != uploaded.ETag {
+		t.Fatalf("got %+v", info)
+	}
+	// Info never carries the content
+	if resp.Header.Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Fatalf("got Content-Type %q", resp.Header.Get("Content-Type"))
+	}
+
+	resp = server.request(t, http.MethodGet, "/api/video/info?objectName="+uniqueName(t, "missing")+".mp4", user.token, nil)
+	decodeResponse(t, resp, http.StatusNotFound, nil)
+	resp = server.request(t, http.MethodGet, "/api/video/info", user.token, nil)
+	decodeResponse(t, resp, http.StatusBadRequest, nil)
+}
+
+func TestUploadMetadataRoundTrips(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+	objectName := uniqueName(t, "titled") + ".mp4"
+	metadata := map[string]string{
+		"title":       "Café tour",
+		"description": "Walking through the old town",
+		"duration":    "12.5",
+	}
+	fields := maps.Clone(metadata)
+	fields["objectName"] = objectName
+	decodeResponse(t, server.upload(t, user.token, "a.mp4", []byte("video"), fields), http.StatusOK, nil)
+
+	var info struct {
+		Metadata map[string]string `json:"metadata"`
+	}
+	resp := server.request(t, http.MethodGet, "/api/video/info?objectName="+objectName, user.token, nil)
+	decodeResponse(t, resp, http.StatusOK, &info)
+	if !maps.Equal(info.Metadata, metadata) {
+		t.Fatalf("got metadata %v, want %v", info.Metadata, metadata)
+	}
+
+	// Oversized metadata is rejected before anything is stored
+	rejected := uniqueName(t, "rejected") + ".mp4"
+	resp = server.upload(t, user.token, "a.mp4", []byte("video"), map[string]string{
+		"objectName": rejected,
+		"title":      strings.Repeat("t", 257),
+	})
+	decodeResponse(t, resp, http.StatusBadRequest, nil)
+	resp = server.request(t, http.MethodGet, "/api/video/info?objectName="+rejected, user.token, nil)
+	decodeResponse(t, resp, http.StatusNotFound, nil)
+}
@@ -0,0 +1,326 @@
+//go:build integration
+
+// The integration tests run the API against throwaway Postgres and MinIO
+// containers, so they need Docker:
+//
+//	go test -tags integration ./router/...
+package router
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/testcontainers/testcontainers-go"
+	tcminio "github.com/testcontainers/testcontainers-go/modules/minio"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	"config"
+	"db"
+	. "services"
+)
+
+// Shared by every test; each test registers its own users so they do not
+// see each other's data
+var (
+	testDB         *db.PrismaClient
+	testMinio      *minio.Client
+	testMinioCfg   config.MinIOConfig
+	testBucketName = "videos"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(runWithContainers(m))
+}
+
+// runWithContainers starts Postgres and MinIO, pushes the schema and runs the tests.
+func runWithContainers(m *testing.M) int {
+	ctx := context.Background()
+
+	pg, err := postgres.Run(ctx, "postgres:16-alpine",
+		postgres.WithDatabase("app"),
+		postgres.WithUsername("app"),
+		postgres.WithPassword("app"),
+		testcontainers.WithWaitStrategy(
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(time.Minute),
+		),
+	)
+	if err != nil {
+		log.Printf("Failed to start Postgres: %v", err)
+		return 1
+	}
+	defer pg.Terminate(ctx)
+	databaseURL, err := pg.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		log.Printf("Failed to get the Postgres URL: %v", err)
+		return 1
+	}
+
+	push := exec.Command("go", "run", "github.com/steebchen/prisma-client-go",
+		"db", "push", "--schema", "../schema.prisma", "--skip-generate")
+	push.Env = append(os.Environ(), "DATABASE_URL="+databaseURL)
+	push.Stdout, push.Stderr = os.Stderr, os.Stderr
+	if err := push.Run(); err != nil {
+		log.Printf("Failed to push the schema: %v", err)
+		return 1
+	}
+
+	testDB = db.NewClient(db.WithDatasourceURL(databaseURL))
+	if err := testDB.Connect(); err != nil {
+		log.Printf("Failed to connect to Postgres: %v", err)
+		return 1
+	}
+	defer testDB.Disconnect()
+
+	mc, err := tcminio.Run(ctx, "minio/minio:RELEASE.2024-01-16T16-07-38Z",
+		tcminio.WithUsername("minioadmin"),
+		tcminio.WithPassword("minioadmin"),
+	)
+	if err != nil {
+		log.Printf("Failed to start MinIO: %v", err)
+		return 1
+	}
+	defer mc.Terminate(ctx)
+	endpoint, err := mc.ConnectionString(ctx)
+	if err != nil {
+		log.Printf("Failed to get the MinIO endpoint: %v", err)
+		return 1
+	}
+	testMinioCfg = config.MinIOConfig{
+		Endpoint:      endpoint,
+		AccessKey:     "minioadmin",
+		SecretKey:     "minioadmin",
+		RetryAttempts: 1,
+	}
+	testMinio, err = NewMinioClient(testMinioCfg)
+	if err != nil {
+		log.Printf("Failed to create the MinIO client: %v", err)
+		return 1
+	}
+	if err := testMinio.MakeBucket(ctx, testBucketName, minio.MakeBucketOptions{}); err != nil {
+		log.Printf("Failed to create the bucket: %v", err)
+		return 1
+	}
+
+	return m.Run()
+}
+
+// testConfig loads the configuration the way main does, pointed at the
+// containers and with rate limiting off. Tests adjust it before newTestServer.
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	t.Setenv("MINIO_ENDPOINT", testMinioCfg.Endpoint)
+	t.Setenv("MINIO_ACCESS_KEY", testMinioCfg.AccessKey)
+	t.Setenv("MINIO_SECRET_KEY", testMinioCfg.SecretKey)
+	t.Setenv("JWT_SECRET", "integration-test-secret")
+	t.Setenv("RATE_LIMIT_ENABLED", "false")
+	t.Setenv("GIN_MODE", "test")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+	return cfg
+}
+
+// testServer is the API served over HTTP as SetupRouterWithStreaming builds it
+type testServer struct {
+	*httptest.Server
+	streaming *Streaming
+}
+
+// newTestServer serves the API described by cfg until the test ends.
+func newTestServer(t *testing.T, cfg *config.Config) *testServer {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	streaming := NewStreamingWithClient(testDB, cfg, testMinio)
+	server := httptest.NewServer(SetupRouterWithStreaming(ctx, testDB, cfg, streaming))
+	t.Cleanup(server.Close)
+	return &testServer{Server: server, streaming: streaming}
+}
+
+// request sends body as JSON, unless it is nil, with token as the bearer token
+// unless it is empty.
+func (s *testServer) request(t *testing.T, method, path, token string, body any) *http.Response {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("encoding request: %v", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, s.URL+path, reader)
+	if err != nil {
+		t.Fatalf("building request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return s.do(t, req, token)
+}
+
+// do sends req with token as the bearer token unless it is empty.
+func (s *testServer) do(t *testing.T, req *http.Request, token string) *http.Response {
+	t.Helper()
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", req.Method, req.URL.Path, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// upload sends content as the file of a single upload, along with fields.
+func (s *testServer) upload(t *testing.T, token, filename string, content []byte, fields map[string]string) *http.Response {
+	t.Helper()
+	return s.do(t, s.uploadRequest(t, filename, content, fields), token)
+}
+
+// uploadRequest builds the request upload sends, for tests that add headers to it
+func (s *testServer) uploadRequest(t *testing.T, filename string, content []byte, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	part := make(textproto.MIMEHeader)
+	part.Set("Content-Disposition", `form-data; name="file"; filename="`+filename+`"`)
+	part.Set("Content-Type", "video/mp4")
+	file, err := form.CreatePart(part)
+	if err != nil {
+		t.Fatalf("building upload: %v", err)
+	}
+	file.Write(content)
+	form.Close()
+
+	req, err := http.NewRequest(http.MethodPost, s.URL+"/api/video/upload", &body)
+	if err != nil {
+		t.Fatalf("building upload: %v", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+// testUser is an account registered for a single test
+type testUser struct {
+	email    string
+	password string
+	token    string
+}
+
+// register creates a new account with a unique email and returns its token.
+func (s *testServer) register(t *testing.T) testUser {
+	t.Helper()
+	user := testUser{email: uniqueName(t, "user") + "@example.com", password: "correct horse battery"}
+	resp := s.request(t, http.MethodPost, "/api/register", "", map[string]any{
+		"username": "Test User",
+		"password": user.password,
+		"email":    user.email,
+		"age":      30,
+	})
+	var body struct {
+		Token string `json:"token"`
+	}
+	decodeResponse(t, resp, http.StatusOK, &body)
+	user.token = body.Token
+	return user
+}
+
+// registerAdmin registers an account and grants it the admin role.
+func (s *testServer) registerAdmin(t *testing.T) testUser {
+	t.Helper()
+	user := s.register(t)
+	_, err := testDB.User.FindUnique(
+		db.User.Email.Equals(user.email),
+	).Update(
+		db.User.Role.Set(adminRole),
+	).Exec(context.Background())
+	if err != nil {
+		t.Fatalf("granting admin: %v", err)
+	}
+	return user
+}
+
+// uniqueName returns prefix followed by random hex, for names that must not
+// collide across tests sharing the containers.
+func uniqueName(t *testing.T, prefix string) string {
+	t.Helper()
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		t.Fatal(err)
+	}
+	return prefix + "-" + hex.EncodeToString(suffix)
+}
+
+// decodeResponse checks the status of resp and decodes its JSON body into v
+// unless v is nil.
+func decodeResponse(t *testing.T, resp *http.Response, status int, v any) {
+	t.Helper()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	if resp.StatusCode != status {
+		t.Fatalf("%s %s: got status %d, want %d: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, status, body)
+	}
+	if v != nil {
+		if err := json.Unmarshal(body, v); err != nil {
+			t.Fatalf("decoding %s: %v", body, err)
+		}
+	}
+}
+
+func TestUploadThenStream(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	resp := server.upload(t, user.token, "clip.mp4", content, map[string]string{"objectName": uniqueName(t, "clip") + ".mp4"})
+	var uploaded struct {
+		ObjectName string `json:"objectName"`
+		Size       int64  `json:"size"`
+	}
+	decodeResponse(t, resp, http.StatusOK, &uploaded)
+	if uploaded.Size != int64(len(content)) {
+		t.Fatalf("uploaded %d bytes, want %d", uploaded.Size, len(content))
+	}
+
+	resp = server.request(t, http.MethodGet, "/api/video?objectName="+uploaded.ObjectName, user.token, nil)
+	streamed, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(streamed, content) {
+		t.Fatalf("stream: status %d, %d bytes, want 200 and the uploaded %d bytes", resp.StatusCode, len(streamed), len(content))
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/video?objectName="+uploaded.ObjectName, nil)
+	req.Header.Set("Range", "bytes=10-19")
+	resp = server.do(t, req, user.token)
+	streamed, _ = io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusPartialContent || !bytes.Equal(streamed, content[10:20]) {
+		t.Fatalf("range: status %d, body %q, want 206 and %q", resp.StatusCode, streamed, content[10:20])
+	}
+	if got := resp.Header.Get("Content-Range"); got != "bytes 10-19/10000" {
+		t.Fatalf("Content-Range %q", got)
+	}
+}
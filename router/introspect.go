@@ -0,0 +1,63 @@
+package router
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	. "middlewares"
+)
+
+// introspectToken answers OAuth 2.0 token introspection (RFC 7662), letting
+// other services check our tokens without holding the signing secret. Callers
+// authenticate with HTTP Basic as clientID and clientSecret and post the token
+// in the token field. Tokens that are invalid, expired or revoked are reported
+// only as {"active": false}.
+func introspectToken(clientID, clientSecret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, secret, ok := c.Request.BasicAuth()
+		// Both are compared in full so the time taken reveals neither
+		idMatches := subtle.ConstantTimeCompare([]byte(id), []byte(clientID))
+		secretMatches := subtle.ConstantTimeCompare([]byte(secret), []byte(clientSecret))
+		if !ok || idMatches&secretMatches != 1 {
+			c.Header("WWW-Authenticate", `Basic realm="introspection"`)
+			RespondError(c, http.StatusUnauthorized, CodeUnauthorized, "invalid client credentials")
+			return
+		}
+
+		var req struct {
+			Token string `form:"token" json:"token" binding:"required"`
+		}
+		if err := c.ShouldBind(&req); err != nil {
+			RespondBindError(c, err)
+			return
+		}
+
+		claims, err := ValidateToken(req.Token)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"active": false})
+			return
+		}
+		resp := gin.H{
+			"active":     true,
+			"token_type": "Bearer",
+			"sub":        claims.Email,
+			"email":      claims.Email,
+			"iss":        claims.Issuer,
+		}
+		if claims.Name != "" {
+			resp["name"] = claims.Name
+		}
+		if len(claims.Audience) > 0 {
+			resp["aud"] = claims.Audience
+		}
+		if claims.ExpiresAt != nil {
+			resp["exp"] = claims.ExpiresAt.Unix()
+		}
+		if claims.IssuedAt != nil {
+			resp["iat"] = claims.IssuedAt.Unix()
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,89 @@
+//go:build integration
+
+package router
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestIntrospectToken(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Auth.IntrospectClientID = "videos"
+	cfg.Auth.IntrospectClientSecret = "service secret"
+	server := newTestServer(t, cfg)
+	user := server.register(t)
+
+	introspect := func(clientSecret, token string) *http.Response {
+		t.Helper()
+		form := url.Values{"token": {token}}
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/api/token/introspect", strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth("videos", clientSecret)
+		return server.do(t, req, "")
+	}
+	// Tokens without a kid are verified with JWT_SECRET
+	sign := func(secret string, expiresAt time.Time) string {
+		t.Helper()
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"email": user.email,
+			"iat":   expiresAt.Add(-time.Hour).Unix(),
+			"exp":   expiresAt.Unix(),
+		}).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	var active struct {
+		Active bool   `json:"active"`
+		Sub    string `json:"sub"`
+		Email  string `json:"email"`
+		Name   string `json:"name"`
+		Iss    string `json:"iss"`
+		Exp    int64  `json:"exp"`
+	}
+	decodeResponse(t, introspect("service secret", user.token), http.StatusOK, &active)
+	if !active.Active || active.Sub != user.email || active.Email != user.email || active.Name != "Test User" || active.Iss == "" {
+		t.Fatalf("active token: got %+v", active)
+	}
+	if until := time.Until(time.Unix(active.Exp, 0)); until <= 0 || until > 25*time.Hour {
+		t.Fatalf("active token: exp %d is not within the token lifetime", active.Exp)
+	}
+
+	for name, token := range map[string]string{
+		"expired":        sign("integration-test-secret", time.Now().Add(-time.Hour)),
+		"invalid":        "not.a.token",
+		"another secret": sign("another secret", time.Now().Add(time.Hour)),
+	} {
+		var resp map[string]any
+		decodeResponse(t, introspect("service secret", token), http.StatusOK, &resp)
+		if len(resp) != 1 || resp["active"] != false {
+			t.Fatalf("%s token: got %v, want only active false", name, resp)
+		}
+	}
+
+	resp := introspect("wrong secret", user.token)
+	decodeResponse(t, resp, http.StatusUnauthorized, nil)
+	if resp.Header.Get("WWW-Authenticate") == "" {
+		t.Fatal("rejected client not challenged")
+	}
+	decodeResponse(t, introspect("service secret", ""), http.StatusBadRequest, nil)
+}
+
+func TestIntrospectionOffWithoutCredential(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+
+	resp := server.request(t, http.MethodPost, "/api/token/introspect", "", map[string]string{"token": user.token})
+	decodeResponse(t, resp, http.StatusNotFound, nil)
+}
@@ -0,0 +1,52 @@
+package router
+
+import (
+	"context"
+	"encoding/base64"
+
+	"db"
+	. "middlewares"
+)
+
+// dbKeyStore keeps rotated JWT signing keys in the SigningKey table, which
+// every instance reads.
+type dbKeyStore struct {
+	database *db.PrismaClient
+}
+
+func (s dbKeyStore) SigningKeys(ctx context.Context) ([]StoredSigningKey, error) {
+	rows, err := s.database.SigningKey.FindMany().OrderBy(
+		db.SigningKey.CreatedAt.Order(db.SORT_ORDER_ASC),
+	).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]StoredSigningKey, 0, len(rows))
+	for _, row := range rows {
+		secret, err := base64.StdEncoding.DecodeString(row.Secret)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, StoredSigningKey{
+			ID:                 row.ID,
+			Secret:             secret,
+			PreviousID:         row.PreviousID,
+			PreviousValidUntil: row.PreviousValidUntil,
+		})
+	}
+	return keys, nil
+}
+
+func (s dbKeyStore) AddSigningKey(ctx context.Context, key StoredSigningKey) error {
+	_, err := s.database.SigningKey.CreateOne(
+		db.SigningKey.ID.Set(key.ID),
+		db.SigningKey.Secret.Set(base64.StdEncoding.EncodeToString(key.Secret)),
+		db.SigningKey.PreviousID.Set(key.PreviousID),
+		db.SigningKey.PreviousValidUntil.Set(key.PreviousValidUntil),
+	).Exec(ctx)
+	// previousId is unique, so only one rotation can replace a given key
+	if _, ok := db.IsErrUniqueConstraint(err); ok {
+		return ErrRotationConflict
+	}
+	return err
+}
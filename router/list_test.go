@@ -0,0 +1,182 @@
+//go:build integration
+
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"db"
+)
+
+func TestListVideosTotals(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user, other := server.register(t), server.register(t)
+	name := uniqueName(t, "counted")
+	for _, suffix := range []string{"-a.mp4", "-b.mp4", "-c.mp4"} {
+		resp := server.upload(t, user.token, "a.mp4", []byte("video"), map[string]string{"objectName": name + suffix})
+		decodeResponse(t, resp, http.StatusOK, nil)
+	}
+	resp := server.upload(t, other.token, "b.mp4", []byte("video"), map[string]string{"objectName": name + "-d.mp4"})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	tests := []struct {
+		query      url.Values
+		total      int
+		totalPages int
+		items      int
+	}{
+		{url.Values{"q": {name}, "pageSize": {"2"}}, 4, 2, 2},
+		{url.Values{"q": {name}, "uploader": {user.email}, "pageSize": {"2"}, "page": {"2"}}, 3, 2, 1},
+		{url.Values{"q": {name}, "uploader": {other.email}}, 1, 1, 1},
+		{url.Values{"q": {name}, "contentType": {"text/plain"}}, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query.Encode(), func(t *testing.T) {
+			var page struct {
+				Items      []any `json:"items"`
+				Total      int   `json:"total"`
+				TotalPages int   `json:"totalPages"`
+			}
+			resp := server.request(t, http.MethodGet, "/api/video/list?"+tt.query.Encode(), user.token, nil)
+			decodeResponse(t, resp, http.StatusOK, &page)
+			if page.Total != tt.total || page.TotalPages != tt.totalPages || len(page.Items) != tt.items {
+				t.Fatalf("got total %d, %d pages, %d items; want %d, %d, %d",
+					page.Total, page.TotalPages, len(page.Items), tt.total, tt.totalPages, tt.items)
+			}
+		})
+	}
+}
+
+func TestListVideosSearchAndSort(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+	name := uniqueName(t, "sorted")
+	sizes := map[string]int{"-small.mp4": 1, "-large.mp4": 100, "-medium.mp4": 10}
+	for suffix, size := range sizes {
+		resp := server.upload(t, user.token, "a.mp4", []byte(strings.Repeat("v", size)), map[string]string{"objectName": name + suffix})
+		decodeResponse(t, resp, http.StatusOK, nil)
+	}
+
+	list := func(query url.Values) []string {
+		t.Helper()
+		var page struct {
+			Items []struct {
+				ObjectName string `json:"objectName"`
+			} `json:"items"`
+		}
+		resp := server.request(t, http.MethodGet, "/api/video/list?"+query.Encode(), user.token, nil)
+		decodeResponse(t, resp, http.StatusOK, &page)
+		names := make([]string, len(page.Items))
+		for i, item := range page.Items {
+			names[i] = strings.TrimPrefix(item.ObjectName, name)
+		}
+		return names
+	}
+
+	got := list(url.Values{"q": {name}, "sort": {"size"}, "order": {"asc"}})
+	if want := []string{"-small.mp4", "-medium.mp4", "-large.mp4"}; !slices.Equal(got, want) {
+		t.Fatalf("ascending by size: got %v, want %v", got, want)
+	}
+	got = list(url.Values{"q": {name}, "sort": {"size"}, "order": {"desc"}})
+	if want := []string{"-large.mp4", "-medium.mp4", "-small.mp4"}; !slices.Equal(got, want) {
+		t.Fatalf("descending by size: got %v, want %v", got, want)
+	}
+	// q matches anywhere in the name
+	if got := list(url.Values{"q": {"-medium"}, "uploader": {user.email}}); !slices.Equal(got, []string{"-medium.mp4"}) {
+		t.Fatalf("searching a substring: got %v", got)
+	}
+
+	for _, query := range []string{"sort=name", "order=sideways"} {
+		resp := server.request(t, http.MethodGet, "/api/video/list?"+query, user.token, nil)
+		decodeResponse(t, resp, http.StatusBadRequest, nil)
+	}
+}
+
+func TestListVideosIncludesETags(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+	name := uniqueName(t, "tagged")
+	etags := make(map[string]string)
+	for _, suffix := range []string{"-recorded.mp4", "-legacy.mp4"} {
+		resp := server.upload(t, user.token, "a.mp4", []byte("video"+suffix), map[string]string{"objectName": name + suffix})
+		var uploaded struct {
+			ETag string `json:"etag"`
+		}
+		decodeResponse(t, resp, http.StatusOK, &uploaded)
+		if uploaded.ETag == "" {
+			t.Fatal("upload returned no ETag")
+		}
+		etags[name+suffix] = uploaded.ETag
+	}
+	// Videos recorded before ETags were stored get theirs from MinIO
+	_, err := testDB.Video.FindUnique(
+		db.Video.ObjectName.Equals(name + "-legacy.mp4"),
+	).Update(
+		db.Video.Etag.Set(""),
+	).Exec(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var page struct {
+		Items []struct {
+			ObjectName string `json:"objectName"`
+			ETag       string `json:"etag"`
+		} `json:"items"`
+	}
+	resp := server.request(t, http.MethodGet, "/api/video/list?q="+name, user.token, nil)
+	decodeResponse(t, resp, http.StatusOK, &page)
+	if len(page.Items) != 2 {
+		t.Fatalf("got %d items, want 2", len(page.Items))
+	}
+	for _, item := range page.Items {
+		if item.ETag != etags[item.ObjectName] {
+			t.Fatalf("%s: got ETag %q, want %q", item.ObjectName, item.ETag, etags[item.ObjectName])
+		}
+	}
+}
+
+func TestListVideosNotModified(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+	name := uniqueName(t, "polled")
+	upload := func(suffix string) {
+		t.Helper()
+		resp := server.upload(t, user.token, "a.mp4", []byte("video"), map[string]string{"objectName": name + suffix})
+		decodeResponse(t, resp, http.StatusOK, nil)
+	}
+	list := func(ifNoneMatch string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/api/video/list?q="+name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		return server.do(t, req, user.token)
+	}
+	upload("-a.mp4")
+
+	resp := list("")
+	etag := resp.Header.Get("ETag")
+	decodeResponse(t, resp, http.StatusOK, nil)
+	if etag == "" || resp.Header.Get("Last-Modified") == "" {
+		t.Fatalf("got ETag %q and Last-Modified %q", etag, resp.Header.Get("Last-Modified"))
+	}
+	resp = list(etag)
+	decodeResponse(t, resp, http.StatusNotModified, nil)
+
+	// A new video changes the listing
+	upload("-b.mp4")
+	resp = list(etag)
+	decodeResponse(t, resp, http.StatusOK, nil)
+	if resp.Header.Get("ETag") == etag {
+		t.Fatal("listing kept its ETag after an upload")
+	}
+}
@@ -0,0 +1,210 @@
+//go:build integration
+
+package router
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"db"
+	. "middlewares"
+)
+
+func TestLoginLimitCountsOnlyFailures(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.LoginPerEmail = 1
+	server := newTestServer(t, cfg)
+	user := server.register(t)
+
+	login := func(password string) *http.Response {
+		return server.request(t, http.MethodPost, "/api/login", "", map[string]string{
+			"email":    user.email,
+			"password": password,
+		})
+	}
+	// Successful logins leave the allowance untouched
+	decodeResponse(t, login(user.password), http.StatusOK, nil)
+	decodeResponse(t, login(user.password), http.StatusOK, nil)
+
+	decodeResponse(t, login("wrong password"), http.StatusUnauthorized, nil)
+	decodeResponse(t, login(user.password), http.StatusTooManyRequests, nil)
+}
+
+func TestLoginErrorsFollowProblemJSON(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.LoginPerEmail = 1
+	cfg.Server.ProblemJSON = true
+	server := newTestServer(t, cfg)
+	user := server.register(t)
+
+	// The failed login uses up the account's only attempt
+	for _, want := range []Problem{
+		{Status: http.StatusUnauthorized, Code: CodeUnauthorized},
+		{Status: http.StatusTooManyRequests, Code: CodeRateLimited},
+	} {
+		resp := server.request(t, http.MethodPost, "/api/login", "", map[string]string{
+			"email":    user.email,
+			"password": "wrong password",
+		})
+		if ct := resp.Header.Get("Content-Type"); ct != "application/problem+json" {
+			t.Fatalf("%d answered with Content-Type %q", resp.StatusCode, ct)
+		}
+		var problem Problem
+		decodeResponse(t, resp, want.Status, &problem)
+		if problem.Status != want.Status || problem.Code != want.Code {
+			t.Fatalf("got %+v, want %+v", problem, want)
+		}
+	}
+}
+
+func TestMixedCaseEmailsStillLogIn(t *testing.T) {
+	// An account stored before emails were lowercased
+	email := "Mixed." + uniqueName(t, "Case") + "@Example.com"
+	hash, err := HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = testDB.User.CreateOne(
+		db.User.Name.Set("Old User"),
+		db.User.Password.Set(hash),
+		db.User.Email.Set(email),
+		db.User.Age.Set(30),
+	).Exec(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := newTestServer(t, testConfig(t))
+	resp := server.request(t, http.MethodPost, "/api/login", "", map[string]string{
+		"email":    email,
+		"password": "correct horse battery",
+	})
+	var login struct {
+		Token string `json:"token"`
+	}
+	decodeResponse(t, resp, http.StatusOK, &login)
+	resp = server.request(t, http.MethodGet, "/api/profile", login.Token, nil)
+	decodeResponse(t, resp, http.StatusOK, nil)
+}
+
+func TestLoginRehashesOutdatedPassword(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Auth.BcryptCost = 4
+	user := newTestServer(t, cfg).register(t)
+
+	cfg = testConfig(t)
+	cfg.Auth.BcryptCost = 5
+	server := newTestServer(t, cfg)
+	stored := func() string {
+		t.Helper()
+		found, err := testDB.User.FindUnique(db.User.Email.Equals(user.email)).Exec(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return found.Password
+	}
+	if !NeedsRehash(stored()) {
+		t.Fatal("hash made at cost 4 does not need rehashing at cost 5")
+	}
+
+	resp := server.request(t, http.MethodPost, "/api/login", "", map[string]string{
+		"email":    user.email,
+		"password": user.password,
+	})
+	decodeResponse(t, resp, http.StatusOK, nil)
+	hash := stored()
+	if NeedsRehash(hash) || !CheckPassword(hash, user.password) {
+		t.Fatal("password not rehashed at the configured cost on login")
+	}
+}
+
+func TestIncludeProfile(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := map[string]any{
+		"username": "Profile User",
+		"password": "correct horse battery",
+		"email":    uniqueName(t, "user") + "@example.com",
+		"age":      42,
+	}
+	// post sends user to path and returns the profile in the response, if any
+	post := func(path string) (map[string]any, bool) {
+		t.Helper()
+		var body map[string]any
+		decodeResponse(t, server.request(t, http.MethodPost, path, "", user), http.StatusOK, &body)
+		if token, _ := body["token"].(string); token == "" {
+			t.Fatalf("%s: no token in %v", path, body)
+		}
+		profile, ok := body["profile"].(map[string]any)
+		return profile, ok
+	}
+	check := func(path string, profile map[string]any) {
+		t.Helper()
+		if profile["email"] != user["email"] || profile["name"] != "Profile User" || profile["age"] != float64(42) {
+			t.Fatalf("%s: got profile %v", path, profile)
+		}
+		if _, ok := profile["password"]; ok {
+			t.Fatalf("%s: profile includes the password hash", path)
+		}
+	}
+
+	profile, ok := post("/api/register?include=profile")
+	if !ok {
+		t.Fatal("register with include=profile returned no profile")
+	}
+	check("register", profile)
+	profile, ok = post("/api/login?include=profile")
+	if !ok {
+		t.Fatal("login with include=profile returned no profile")
+	}
+	check("login", profile)
+	if _, ok := post("/api/login"); ok {
+		t.Fatal("login without include returned a profile")
+	}
+
+	user["email"] = uniqueName(t, "user") + "@example.com"
+	if _, ok := post("/api/register"); ok {
+		t.Fatal("register without include returned a profile")
+	}
+}
+
+func TestTokensCarryTheName(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+
+	nameIn := func(token string) string {
+		t.Helper()
+		claims, err := ValidateToken(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return claims.Name
+	}
+	if name := nameIn(user.token); name != "Test User" {
+		t.Fatalf("registration token names %q, want Test User", name)
+	}
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	resp := server.request(t, http.MethodPost, "/api/login", "", map[string]string{
+		"email":    user.email,
+		"password": user.password,
+	})
+	decodeResponse(t, resp, http.StatusOK, &login)
+	if name := nameIn(login.Token); name != "Test User" {
+		t.Fatalf("login token names %q, want Test User", name)
+	}
+
+	// Renaming hands out a token with the new name
+	var updated struct {
+		Token string `json:"token"`
+	}
+	resp = server.request(t, http.MethodPut, "/api/profile", user.token, map[string]string{"username": "Renamed"})
+	decodeResponse(t, resp, http.StatusOK, &updated)
+	if name := nameIn(updated.Token); name != "Renamed" {
+		t.Fatalf("token after renaming names %q, want Renamed", name)
+	}
+}
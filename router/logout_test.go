@@ -0,0 +1,74 @@
+//go:build integration
+
+package router
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"db"
+)
+
+// auditEvents waits for the background logger to record an event of
+// eventType for email and returns the events found
+func auditEvents(t *testing.T, eventType, email string) []db.AuditEventModel {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		events, err := testDB.AuditEvent.FindMany(
+			db.AuditEvent.Type.Equals(eventType),
+			db.AuditEvent.Email.Equals(email),
+		).Exec(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) > 0 || time.Now().After(deadline) {
+			return events
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestLogoutRevokesTokens(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+	// Tokens issued in the same second as a revocation stay valid
+	time.Sleep(time.Second)
+
+	resp := server.request(t, http.MethodPost, "/api/logout", user.token, nil)
+	decodeResponse(t, resp, http.StatusOK, nil)
+	cleared := false
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "token" && cookie.MaxAge < 0 {
+			cleared = true
+		}
+	}
+	if !cleared {
+		t.Fatal("logout did not clear the token cookie")
+	}
+
+	resp = server.request(t, http.MethodGet, "/api/profile", user.token, nil)
+	decodeResponse(t, resp, http.StatusUnauthorized, nil)
+	if len(auditEvents(t, AuditLogout, user.email)) == 0 {
+		t.Fatal("logout was not audited")
+	}
+}
+
+func TestFailedLoginAuditsBoundedEmail(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	sent := "  " + strings.Repeat("X", 1000) + "@Example.com"
+
+	resp := server.request(t, http.MethodPost, "/api/login", "", map[string]string{
+		"email":    sent,
+		"password": "wrong password",
+	})
+	decodeResponse(t, resp, http.StatusUnauthorized, nil)
+
+	recorded := strings.Repeat("x", maxAuditEmailLength)
+	if len(auditEvents(t, AuditLoginFailed, recorded)) == 0 {
+		t.Fatalf("failed login not recorded as %d lowercased bytes", maxAuditEmailLength)
+	}
+}
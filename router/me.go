@@ -0,0 +1,52 @@
+package router
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"db"
+	. "middlewares"
+	. "services"
+)
+
+// me returns everything a client needs to bootstrap in one call: the profile,
+// role, storage quota and when the current token expires. Quota is null when
+// it cannot be computed, and its limit is null when uploads are unlimited.
+func me(database *db.PrismaClient, streaming *Streaming) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := findActiveUser(c.Request.Context(), database, c.GetString("email"))
+		if errors.Is(err, db.ErrNotFound) {
+			RespondError(c, http.StatusNotFound, CodeNotFound, "user not found")
+			return
+		}
+		if err != nil {
+			RespondError(c, http.StatusInternalServerError, CodeInternal, "could not load profile")
+			return
+		}
+
+		resp := gin.H{
+			"profile": profileJSON(user),
+			"role":    user.Role,
+			"quota":   nil,
+		}
+		if expiresAt, ok := c.Get("tokenExpiresAt"); ok {
+			resp["tokenExpiresAt"] = expiresAt
+		}
+
+		used, limit, err := streaming.QuotaUsage(c.Request.Context(), user)
+		if err != nil {
+			log.Printf("Failed to compute usage for %s: %v\n", user.Email, err)
+		} else {
+			quota := gin.H{"usedBytes": used, "limitBytes": nil}
+			if limit > 0 {
+				quota["limitBytes"] = limit
+			}
+			resp["quota"] = quota
+		}
+
+		c.JSON(http.StatusOK, resp)
+	}
+}
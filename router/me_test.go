@@ -0,0 +1,71 @@
+//go:build integration
+
+package router
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// meResponse is the body of GET /api/me
+type meResponse struct {
+	Profile struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+		Age   int    `json:"age"`
+	} `json:"profile"`
+	Role  string `json:"role"`
+	Quota *struct {
+		UsedBytes  int64  `json:"usedBytes"`
+		LimitBytes *int64 `json:"limitBytes"`
+	} `json:"quota"`
+	TokenExpiresAt time.Time `json:"tokenExpiresAt"`
+}
+
+func TestMe(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+	resp := server.upload(t, user.token, "a.mp4", []byte("video"), map[string]string{"objectName": uniqueName(t, "me") + ".mp4"})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	var me meResponse
+	decodeResponse(t, server.request(t, http.MethodGet, "/api/me", user.token, nil), http.StatusOK, &me)
+	if me.Profile.Email != user.email || me.Profile.Name != "Test User" || me.Profile.Age != 30 {
+		t.Fatalf("got profile %+v, want the registered one", me.Profile)
+	}
+	if me.Role != "user" {
+		t.Fatalf("got role %q, want user", me.Role)
+	}
+	if me.Quota == nil {
+		t.Fatal("quota missing")
+	}
+	if me.Quota.UsedBytes != int64(len("video")) {
+		t.Fatalf("got %d bytes used, want %d", me.Quota.UsedBytes, len("video"))
+	}
+	if me.Quota.LimitBytes != nil {
+		t.Fatalf("got a limit of %d bytes, want none without a quota", *me.Quota.LimitBytes)
+	}
+	if until := time.Until(me.TokenExpiresAt); until <= 0 || until > 25*time.Hour {
+		t.Fatalf("token expires at %v, want within the token lifetime", me.TokenExpiresAt)
+	}
+
+	resp = server.request(t, http.MethodGet, "/api/me", "", nil)
+	decodeResponse(t, resp, http.StatusUnauthorized, nil)
+}
+
+func TestMeReportsQuotaLimit(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Upload.QuotaMB = 2
+	server := newTestServer(t, cfg)
+	user := server.register(t)
+
+	var me meResponse
+	decodeResponse(t, server.request(t, http.MethodGet, "/api/me", user.token, nil), http.StatusOK, &me)
+	if me.Quota == nil || me.Quota.LimitBytes == nil {
+		t.Fatalf("got quota %+v, want a limit", me.Quota)
+	}
+	if *me.Quota.LimitBytes != 2<<20 || me.Quota.UsedBytes != 0 {
+		t.Fatalf("got %d of %d bytes, want 0 of %d", me.Quota.UsedBytes, *me.Quota.LimitBytes, 2<<20)
+	}
+}
@@ -0,0 +1,27 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	. "services"
+)
+
+// metricsHandler serves gauges in the Prometheus text format for scraping.
+func metricsHandler(streaming *Streaming) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.String(http.StatusOK, "# HELP video_active_streams Video streams currently being served.\n"+
+			"# TYPE video_active_streams gauge\n"+
+			fmt.Sprintf("video_active_streams %d\n", streaming.ActiveStreams()))
+	}
+}
+
+// streamsStatus reports the active stream count to admins.
+func streamsStatus(streaming *Streaming) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"activeStreams": streaming.ActiveStreams()})
+	}
+}
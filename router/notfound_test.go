@@ -0,0 +1,32 @@
+//go:build integration
+
+package router
+
+import (
+	"net/http"
+	"testing"
+
+	. "middlewares"
+)
+
+func TestUnmatchedRoutesAnswerJSON(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	tests := []struct {
+		method, path string
+		status       int
+		code         string
+	}{
+		{http.MethodGet, "/api/nothing-here", http.StatusNotFound, CodeNotFound},
+		{http.MethodDelete, "/api/version", http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			resp := server.request(t, tt.method, tt.path, "", nil)
+			var body APIError
+			decodeResponse(t, resp, tt.status, &body)
+			if body.Code != tt.code || body.Message == "" {
+				t.Fatalf("got %+v", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+//go:build integration
+
+package router
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestObjectListingsOnlyShowOwnObjects(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	owner, other := server.register(t), server.register(t)
+	prefix := uniqueName(t, "listed") + "/"
+
+	resp := server.upload(t, owner.token, "a.mp4", []byte("owner's video"), map[string]string{"objectName": prefix + "owner.mp4"})
+	decodeResponse(t, resp, http.StatusOK, nil)
+	resp = server.upload(t, other.token, "b.mp4", []byte("other video"), map[string]string{"objectName": prefix + "other.mp4"})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	type object struct {
+		ObjectName string `json:"objectName"`
+	}
+	var page struct {
+		Items []object `json:"items"`
+	}
+	resp = server.request(t, http.MethodGet, "/api/video/objects?prefix="+prefix, other.token, nil)
+	decodeResponse(t, resp, http.StatusOK, &page)
+	if len(page.Items) != 1 || page.Items[0].ObjectName != prefix+"other.mp4" {
+		t.Fatalf("paged listing: got %v, want only the caller's object", page.Items)
+	}
+
+	var all []object
+	resp = server.request(t, http.MethodGet, "/api/video/objects/all?prefix="+prefix, other.token, nil)
+	decodeResponse(t, resp, http.StatusOK, &all)
+	if len(all) != 1 || all[0].ObjectName != prefix+"other.mp4" {
+		t.Fatalf("streamed listing: got %v, want only the caller's object", all)
+	}
+}
+
+func TestUserKeyPrefixes(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Upload.UserKeyPrefix = true
+	server := newTestServer(t, cfg)
+	first, second := server.register(t), server.register(t)
+	name := uniqueName(t, "clip") + ".mp4"
+
+	// Both users may pick the same name; each gets a key under their own prefix
+	keys := make(map[string]string)
+	for _, user := range []testUser{first, second} {
+		resp := server.upload(t, user.token, "clip.mp4", []byte("video of "+user.email), map[string]string{"objectName": name})
+		var uploaded struct {
+			ObjectName string `json:"objectName"`
+		}
+		decodeResponse(t, resp, http.StatusOK, &uploaded)
+		if !strings.HasPrefix(uploaded.ObjectName, "users/") || !strings.HasSuffix(uploaded.ObjectName, "/"+name) {
+			t.Fatalf("stored as %q, want it under a users/ prefix", uploaded.ObjectName)
+		}
+		keys[user.email] = uploaded.ObjectName
+	}
+	if keys[first.email] == keys[second.email] {
+		t.Fatal("both users' videos share a key")
+	}
+
+	resp := server.request(t, http.MethodGet, "/api/video?objectName="+keys[first.email], first.token, nil)
+	if streamed, _ := io.ReadAll(resp.Body); string(streamed) != "video of "+first.email {
+		t.Fatalf("own video holds %q", streamed)
+	}
+	// Keys under another user's prefix are out of reach, as if missing
+	for _, path := range []string{"/api/video?objectName=", "/api/video/info?objectName="} {
+		resp = server.request(t, http.MethodGet, path+keys[first.email], second.token, nil)
+		decodeResponse(t, resp, http.StatusNotFound, nil)
+	}
+
+	var page struct {
+		Items []struct {
+			ObjectName string `json:"objectName"`
+		} `json:"items"`
+	}
+	resp = server.request(t, http.MethodGet, "/api/video/objects", second.token, nil)
+	decodeResponse(t, resp, http.StatusOK, &page)
+	if len(page.Items) != 1 || page.Items[0].ObjectName != keys[second.email] {
+		t.Fatalf("listing: got %v, want only the caller's video", page.Items)
+	}
+}
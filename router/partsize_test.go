@@ -0,0 +1,48 @@
+//go:build integration
+
+package router
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestUploadPartSize(t *testing.T) {
+	// Under MinIO's default 16 MiB part size this is a single PUT
+	content := bytes.Repeat([]byte("v"), 11<<20)
+	tests := []struct {
+		name     string
+		partSize uint64
+		// etagSuffix is how a multipart upload's ETag ends, with its part count
+		etagSuffix string
+	}{
+		{"default", 0, ""},
+		{"5 MiB parts", 5 << 20, "-3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Upload.PartSize = tt.partSize
+			server := newTestServer(t, cfg)
+			user := server.register(t)
+			objectName := uniqueName(t, "parts") + ".mp4"
+
+			resp := server.upload(t, user.token, "a.mp4", content, map[string]string{"objectName": objectName})
+			decodeResponse(t, resp, http.StatusOK, nil)
+
+			info, err := testMinio.StatObject(context.Background(), testBucketName, objectName, minio.StatObjectOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			multipart := strings.Contains(info.ETag, "-")
+			if tt.etagSuffix == "" && multipart || tt.etagSuffix != "" && !strings.HasSuffix(info.ETag, tt.etagSuffix) {
+				t.Fatalf("stored with ETag %q, want suffix %q", info.ETag, tt.etagSuffix)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"db"
+	. "middlewares"
+	. "services"
+)
+
+// changePassword replaces the authenticated user's password after checking the
+// current one. The new password may not match any of the last historySize
+// passwords, the current one included; zero turns the check off. Every token
+// issued so far is revoked, so the user logs in again with the new password.
+func changePassword(database *db.PrismaClient, auditLog AuditLogger, historySize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			CurrentPassword string `json:"currentPassword" binding:"required"`
+			NewPassword     string `json:"newPassword" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			RespondBindError(c, err)
+			return
+		}
+
+		ctx := c.Request.Context()
+		user, err := findActiveUser(ctx, database, c.GetString("email"))
+		if errors.Is(err, db.ErrNotFound) {
+			RespondError(c, http.StatusNotFound, CodeNotFound, "user not found")
+			return
+		}
+		if err != nil {
+			RespondError(c, http.StatusInternalServerError, CodeInternal, "could not change password")
+			return
+		}
+		if !CheckPassword(user.Password, req.CurrentPassword) {
+			RespondError(c, http.StatusUnauthorized, CodeUnauthorized, "invalid credentials")
+			return
+		}
+
+		reused, err := passwordReused(ctx, database, user, req.NewPassword, historySize)
+		if err != nil {
+			log.Printf("Failed to read password history for %s: %v\n", user.Email, err)
+			RespondError(c, http.StatusInternalServerError, CodeInternal, "could not change password")
+			return
+		}
+		if reused {
+			RespondError(c, http.StatusBadRequest, CodeInvalidRequest, "password was used recently")
+			return
+		}
+
+		hash, err := HashPassword(req.NewPassword)
+		if err != nil {
+			RespondError(c, http.StatusInternalServerError, CodeInternal, "could not secure password")
+			return
+		}
+		// The old hash moves to the history, which is trimmed, in the same
+		// transaction as the update. The trim is a statement of its own rather
+		// than a delete of rows read beforehand, so it also covers entries a
+		// concurrent change added meanwhile.
+		keep := historySize - 1
+		err = WithTransaction(ctx, database, func(tx *Tx) error {
+			if keep > 0 {
+				tx.Add(database.PasswordHistory.CreateOne(
+					db.PasswordHistory.Hash.Set(user.Password),
+					db.PasswordHistory.User.Link(db.User.ID.Equals(user.ID)),
+				).Tx())
+			}
+			tx.Add(database.Prisma.ExecuteRaw(
+				`DELETE FROM "PasswordHistory" WHERE "userId" = $1 AND "id" NOT IN (
+					SELECT "id" FROM "PasswordHistory" WHERE "userId" = $1 ORDER BY "createdAt" DESC LIMIT $2
+				)`,
+				user.ID, max(keep, 0),
+			).Tx())
+			tx.Add(database.User.FindUnique(
+				db.User.ID.Equals(user.ID),
+			).Update(
+				db.User.Password.Set(hash),
+			).Tx())
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to change password for %s: %v\n", user.Email, err)
+			RespondError(c, http.StatusInternalServerError, CodeInternal, "could not change password")
+			return
+		}
+
+		RevokeTokens(user.Email)
+		audit(c, auditLog, AuditPasswordChanged, user.Email)
+		c.JSON(http.StatusOK, gin.H{"status": "password changed"})
+	}
+}
+
+// passwordReused reports whether password matches the user's current password
+// or one of the historySize-1 before it.
+func passwordReused(ctx context.Context, database *db.PrismaClient, user *db.UserModel, password string, historySize int) (bool, error) {
+	if historySize <= 0 {
+		return false, nil
+	}
+	if CheckPassword(user.Password, password) {
+		return true, nil
+	}
+	if historySize == 1 {
+		return false, nil
+	}
+	previous, err := database.PasswordHistory.FindMany(
+		db.PasswordHistory.UserID.Equals(user.ID),
+	).OrderBy(
+		db.PasswordHistory.CreatedAt.Order(db.SORT_ORDER_DESC),
+	).Take(historySize - 1).Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range previous {
+		if CheckPassword(entry.Hash, password) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,44 @@
+//go:build integration
+
+package router
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestChangePassword(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+	changeTo := func(token, current, password string) *http.Response {
+		return server.request(t, http.MethodPut, "/api/profile/password", token, map[string]string{
+			"currentPassword": current,
+			"newPassword":     password,
+		})
+	}
+
+	decodeResponse(t, changeTo(user.token, "wrong password", "new password!!"), http.StatusUnauthorized, nil)
+	// The current password counts as recently used
+	decodeResponse(t, changeTo(user.token, user.password, user.password), http.StatusBadRequest, nil)
+	decodeResponse(t, changeTo(user.token, user.password, "new password!!"), http.StatusOK, nil)
+	// Tokens issued before the change are revoked, however recent
+	decodeResponse(t, server.request(t, http.MethodGet, "/api/me", user.token, nil), http.StatusUnauthorized, nil)
+
+	resp := server.request(t, http.MethodPost, "/api/login", "", map[string]string{"email": user.email, "password": user.password})
+	decodeResponse(t, resp, http.StatusUnauthorized, nil)
+	resp = server.request(t, http.MethodPost, "/api/login", "", map[string]string{"email": user.email, "password": "new password!!"})
+	decodeResponse(t, resp, http.StatusOK, nil)
+}
+
+func TestPasswordHistoryDisabled(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Auth.PasswordHistory = 0
+	server := newTestServer(t, cfg)
+	user := server.register(t)
+
+	resp := server.request(t, http.MethodPut, "/api/profile/password", user.token, map[string]string{
+		"currentPassword": user.password,
+		"newPassword":     user.password,
+	})
+	decodeResponse(t, resp, http.StatusOK, nil)
+}
@@ -0,0 +1,26 @@
+package router
+
+import (
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+
+	. "middlewares"
+)
+
+// mountPprof serves the net/http/pprof handlers under group, e.g.
+// /api/admin/debug/pprof/heap. pprof.Index only resolves named profiles under
+// /debug/pprof/, so those are served through pprof.Handler instead.
+func mountPprof(group *gin.RouterGroup) {
+	// Profiles come gzipped already
+	group.Use(NoCompression())
+	group.GET("/", gin.WrapF(pprof.Index))
+	group.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	group.GET("/profile", gin.WrapF(pprof.Profile))
+	group.GET("/symbol", gin.WrapF(pprof.Symbol))
+	group.POST("/symbol", gin.WrapF(pprof.Symbol))
+	group.GET("/trace", gin.WrapF(pprof.Trace))
+	group.GET("/:name", func(c *gin.Context) {
+		pprof.Handler(c.Param("name")).ServeHTTP(c.Writer, c.Request)
+	})
+}
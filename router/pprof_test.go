@@ -0,0 +1,55 @@
+//go:build integration
+
+package router
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPprofRequiresAdmin(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Server.PprofEnabled = true
+	server := newTestServer(t, cfg)
+	user, admin := server.register(t), server.registerAdmin(t)
+
+	decodeResponse(t, server.request(t, http.MethodGet, "/api/admin/debug/pprof/heap", "", nil), http.StatusUnauthorized, nil)
+	decodeResponse(t, server.request(t, http.MethodGet, "/api/admin/debug/pprof/heap", user.token, nil), http.StatusForbidden, nil)
+
+	read := func(path string) []byte {
+		t.Helper()
+		resp := server.request(t, http.MethodGet, path, admin.token, nil)
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", path, resp.StatusCode, body)
+		}
+		// The client undoes a Content-Encoding the server added
+		if resp.Uncompressed {
+			t.Fatalf("%s: compressed by the server", path)
+		}
+		return body
+	}
+	// Binary profiles are gzipped protobuf already
+	if heap := read("/api/admin/debug/pprof/heap"); !bytes.HasPrefix(heap, []byte{0x1f, 0x8b}) {
+		t.Fatalf("heap profile is not gzipped: %q", heap[:min(len(heap), 16)])
+	}
+	if goroutines := read("/api/admin/debug/pprof/goroutine?debug=1"); !strings.Contains(string(goroutines), "goroutine profile:") {
+		t.Fatalf("got goroutine profile %q", goroutines[:min(len(goroutines), 64)])
+	}
+	if index := read("/api/admin/debug/pprof/"); !strings.Contains(string(index), "heap") {
+		t.Fatal("index does not list the heap profile")
+	}
+}
+
+func TestPprofOffByDefault(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	admin := server.registerAdmin(t)
+
+	decodeResponse(t, server.request(t, http.MethodGet, "/api/admin/debug/pprof/heap", admin.token, nil), http.StatusNotFound, nil)
+}
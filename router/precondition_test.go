@@ -0,0 +1,53 @@
+//go:build integration
+
+package router
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"db"
+)
+
+func TestDeleteIfMatch(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+	objectName := uniqueName(t, "guarded") + ".mp4"
+
+	var uploaded struct {
+		ETag string `json:"etag"`
+	}
+	resp := server.upload(t, user.token, "a.mp4", []byte("guarded video"), map[string]string{"objectName": objectName})
+	decodeResponse(t, resp, http.StatusOK, &uploaded)
+
+	deleteIfMatch := func(etag string) *http.Response {
+		req, err := http.NewRequest(http.MethodDelete, server.URL+"/api/video?objectName="+objectName, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("If-Match", `"`+etag+`"`)
+		return server.do(t, req, user.token)
+	}
+	setRecordedETag := func(etag string) {
+		_, err := testDB.Video.FindUnique(db.Video.ObjectName.Equals(objectName)).Update(
+			db.Video.Etag.Set(etag),
+		).Exec(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	decodeResponse(t, deleteIfMatch("stale"), http.StatusPreconditionFailed, nil)
+
+	// An overwrite recorded after the ETag check still stops the delete
+	setRecordedETag("overwritten")
+	decodeResponse(t, deleteIfMatch(uploaded.ETag), http.StatusPreconditionFailed, nil)
+	resp = server.request(t, http.MethodGet, "/api/video?objectName="+objectName, user.token, nil)
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	setRecordedETag(uploaded.ETag)
+	decodeResponse(t, deleteIfMatch(uploaded.ETag), http.StatusOK, nil)
+	resp = server.request(t, http.MethodGet, "/api/video?objectName="+objectName, user.token, nil)
+	decodeResponse(t, resp, http.StatusNotFound, nil)
+}
@@ -0,0 +1,55 @@
+//go:build integration
+
+package router
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUpdateProfile(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+	other := server.register(t)
+
+	resp := server.request(t, http.MethodPut, "/api/profile", user.token, map[string]any{})
+	decodeResponse(t, resp, http.StatusBadRequest, nil)
+	resp = server.request(t, http.MethodPut, "/api/profile", user.token, map[string]any{"email": other.email})
+	decodeResponse(t, resp, http.StatusConflict, nil)
+
+	// Only the age changes, so the token stays valid
+	resp = server.request(t, http.MethodPut, "/api/profile", user.token, map[string]any{"age": 41})
+	var updated struct {
+		Token string `json:"token"`
+	}
+	decodeResponse(t, resp, http.StatusOK, &updated)
+	if updated.Token != "" {
+		t.Fatal("new token issued although neither email nor name changed")
+	}
+
+	newEmail := uniqueName(t, "renamed") + "@Example.com"
+	resp = server.request(t, http.MethodPut, "/api/profile", user.token, map[string]any{
+		"username": "Renamed",
+		"email":    newEmail,
+	})
+	decodeResponse(t, resp, http.StatusOK, &updated)
+	if updated.Token == "" {
+		t.Fatal("no new token after changing the email")
+	}
+
+	resp = server.request(t, http.MethodGet, "/api/profile", updated.Token, nil)
+	var profile struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+		Age   int    `json:"age"`
+	}
+	decodeResponse(t, resp, http.StatusOK, &profile)
+	if profile.Name != "Renamed" || profile.Age != 41 {
+		t.Fatalf("got %+v", profile)
+	}
+	// Stored normalized, like at registration
+	if profile.Email != strings.ToLower(newEmail) {
+		t.Fatalf("got email %q, want it lowercased", profile.Email)
+	}
+}
@@ -0,0 +1,44 @@
+//go:build integration
+
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestClientIPBehindTrustedProxy(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		want    string
+	}{
+		// The test client connects from localhost, standing in for the proxy
+		{"trusted", []string{"127.0.0.1", "::1"}, "203.0.113.7"},
+		{"untrusted", []string{"10.0.0.0/8"}, "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Server.TrustedProxies = tt.proxies
+			server := newTestServer(t, cfg)
+			user := server.register(t)
+
+			creds, _ := json.Marshal(map[string]string{"email": user.email, "password": user.password})
+			req, err := http.NewRequest(http.MethodPost, server.URL+"/api/login", bytes.NewReader(creds))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+			decodeResponse(t, server.do(t, req, ""), http.StatusOK, nil)
+
+			events := auditEvents(t, AuditLogin, user.email)
+			if len(events) != 1 || events[0].IP != tt.want {
+				t.Fatalf("got %+v, want one login from %s", events, tt.want)
+			}
+		})
+	}
+}
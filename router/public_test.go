@@ -0,0 +1,48 @@
+//go:build integration
+
+package router
+
+import (
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestPublicVideos(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	owner := server.register(t)
+	public := uniqueName(t, "public") + ".mp4"
+	private := uniqueName(t, "private") + ".mp4"
+	resp := server.upload(t, owner.token, "a.mp4", []byte("public video"), map[string]string{"objectName": public, "public": "true"})
+	decodeResponse(t, resp, http.StatusOK, nil)
+	resp = server.upload(t, owner.token, "b.mp4", []byte("private video"), map[string]string{"objectName": private})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	// stream fetches objectName from the public route without a token
+	stream := func(objectName string) *http.Response {
+		return server.request(t, http.MethodGet, "/api/public/video?objectName="+objectName, "", nil)
+	}
+	resp = stream(public)
+	if streamed, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusOK || string(streamed) != "public video" {
+		t.Fatalf("public video: got %d %q", resp.StatusCode, streamed)
+	}
+	decodeResponse(t, stream(private), http.StatusNotFound, nil)
+	decodeResponse(t, stream(uniqueName(t, "missing")+".mp4"), http.StatusNotFound, nil)
+	// The authenticated route still wants a token, even for public videos
+	resp = server.request(t, http.MethodGet, "/api/video?objectName="+public, "", nil)
+	decodeResponse(t, resp, http.StatusUnauthorized, nil)
+
+	// Only the owner changes the visibility
+	visibility := func(token, objectName string, public bool) *http.Response {
+		return server.request(t, http.MethodPut, "/api/video/visibility", token, map[string]any{
+			"objectName": objectName,
+			"public":     public,
+		})
+	}
+	decodeResponse(t, visibility(server.register(t).token, private, true), http.StatusNotFound, nil)
+	decodeResponse(t, stream(private), http.StatusNotFound, nil)
+	decodeResponse(t, visibility(owner.token, private, true), http.StatusOK, nil)
+	decodeResponse(t, stream(private), http.StatusOK, nil)
+	decodeResponse(t, visibility(owner.token, public, false), http.StatusOK, nil)
+	decodeResponse(t, stream(public), http.StatusNotFound, nil)
+}
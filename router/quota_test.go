@@ -0,0 +1,83 @@
+//go:build integration
+
+package router
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"db"
+)
+
+func TestConcurrentUploadsShareQuota(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+	_, err := testDB.User.FindUnique(db.User.Email.Equals(user.email)).Update(
+		db.User.UploadQuotaMB.Set(1),
+	).Exec(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each upload fits the quota on its own, but not together
+	content := bytes.Repeat([]byte("v"), 600<<10)
+	statuses := make([]int, 2)
+	var wg sync.WaitGroup
+	for i := range statuses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := server.upload(t, user.token, "a.mp4", content, map[string]string{"objectName": uniqueName(t, "quota") + ".mp4"})
+			statuses[i] = resp.StatusCode
+		}()
+	}
+	wg.Wait()
+
+	accepted := 0
+	for _, status := range statuses {
+		if status == http.StatusOK {
+			accepted++
+		} else if status != http.StatusRequestEntityTooLarge {
+			t.Fatalf("unexpected status %d", status)
+		}
+	}
+	if accepted != 1 {
+		t.Fatalf("%d uploads accepted, want exactly 1", accepted)
+	}
+
+	var me struct {
+		Quota struct {
+			UsedBytes int64 `json:"usedBytes"`
+		} `json:"quota"`
+	}
+	resp := server.request(t, http.MethodGet, "/api/me", user.token, nil)
+	decodeResponse(t, resp, http.StatusOK, &me)
+	if me.Quota.UsedBytes != int64(len(content)) {
+		t.Fatalf("usage %d bytes, want %d", me.Quota.UsedBytes, len(content))
+	}
+}
+
+func TestCopyCountsAgainstQuota(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+	_, err := testDB.User.FindUnique(db.User.Email.Equals(user.email)).Update(
+		db.User.UploadQuotaMB.Set(1),
+	).Exec(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := uniqueName(t, "quota") + ".mp4"
+	resp := server.upload(t, user.token, "a.mp4", bytes.Repeat([]byte("v"), 600<<10), map[string]string{"objectName": source})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	// A second copy would take the user past 1 MB
+	resp = server.request(t, http.MethodPost, "/api/video/copy", user.token, map[string]string{
+		"source":      source,
+		"destination": uniqueName(t, "copy") + ".mp4",
+	})
+	decodeResponse(t, resp, http.StatusRequestEntityTooLarge, nil)
+}
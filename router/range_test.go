@@ -0,0 +1,40 @@
+//go:build integration
+
+package router
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRangeHeaderVariants(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+	objectName := uniqueName(t, "ranged") + ".mp4"
+	resp := server.upload(t, user.token, "a.mp4", []byte("0123456789"), map[string]string{"objectName": objectName})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	tests := []struct {
+		rangeHeader  string
+		want         int
+		contentRange string
+	}{
+		{"bytes= 2-5", http.StatusPartialContent, "bytes 2-5/10"},
+		{"bytes = 2 - 5", http.StatusPartialContent, "bytes 2-5/10"},
+		{"bytes=\t-3", http.StatusPartialContent, "bytes 7-9/10"},
+		{"items=0-5", http.StatusBadRequest, ""},
+		{"bytes=20-", http.StatusRequestedRangeNotSatisfiable, "bytes */10"},
+		{"bytes=five-", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rangeHeader, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/video?objectName="+objectName, nil)
+			req.Header.Set("Range", tt.rangeHeader)
+			resp := server.do(t, req, user.token)
+			if got := resp.Header.Get("Content-Range"); got != tt.contentRange {
+				t.Fatalf("got Content-Range %q, want %q", got, tt.contentRange)
+			}
+			decodeResponse(t, resp, tt.want, nil)
+		})
+	}
+}
@@ -0,0 +1,34 @@
+//go:build integration
+
+package router
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRateLimitCanBeDisabled(t *testing.T) {
+	// count sends 20 requests in a row and counts the limited ones
+	count := func(server *testServer) int {
+		limited := 0
+		for range 20 {
+			resp := server.request(t, http.MethodGet, "/api/version", "", nil)
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusTooManyRequests {
+				limited++
+			}
+		}
+		return limited
+	}
+
+	cfg := testConfig(t)
+	cfg.RateLimit.Enabled = false
+	if limited := count(newTestServer(t, cfg)); limited != 0 {
+		t.Fatalf("%d requests limited with rate limiting disabled", limited)
+	}
+	cfg = testConfig(t)
+	cfg.RateLimit.Enabled = true
+	if limited := count(newTestServer(t, cfg)); limited == 0 {
+		t.Fatal("no request limited with rate limiting enabled")
+	}
+}
@@ -0,0 +1,39 @@
+//go:build integration
+
+package router
+
+import (
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestRenameVideo(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	owner, other := server.register(t), server.register(t)
+	from := uniqueName(t, "before") + ".mp4"
+	resp := server.upload(t, owner.token, "a.mp4", []byte("renamed video"), map[string]string{"objectName": from})
+	decodeResponse(t, resp, http.StatusOK, nil)
+	taken := uniqueName(t, "taken") + ".mp4"
+	resp = server.upload(t, owner.token, "b.mp4", []byte("other video"), map[string]string{"objectName": taken})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	resp = server.request(t, http.MethodPut, "/api/video/rename", owner.token, map[string]string{"from": from, "to": taken})
+	decodeResponse(t, resp, http.StatusConflict, nil)
+	resp = server.request(t, http.MethodPut, "/api/video/rename", other.token, map[string]string{"from": from, "to": uniqueName(t, "stolen") + ".mp4"})
+	decodeResponse(t, resp, http.StatusNotFound, nil)
+
+	to := uniqueName(t, "after") + ".mp4"
+	resp = server.request(t, http.MethodPut, "/api/video/rename", owner.token, map[string]string{"from": from, "to": to})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	// Only the new name is left
+	resp = server.request(t, http.MethodGet, "/api/video?objectName="+from, owner.token, nil)
+	decodeResponse(t, resp, http.StatusNotFound, nil)
+	resp = server.request(t, http.MethodGet, "/api/video?objectName="+to, owner.token, nil)
+	if streamed, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusOK || string(streamed) != "renamed video" {
+		t.Fatalf("got %d %q under the new name", resp.StatusCode, streamed)
+	}
+	resp = server.request(t, http.MethodGet, "/api/video/info?objectName="+to, owner.token, nil)
+	decodeResponse(t, resp, http.StatusOK, nil)
+}
@@ -0,0 +1,80 @@
+//go:build integration
+
+package router
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFullAndRangedStreamsBehaveAlike(t *testing.T) {
+	cfg := testConfig(t)
+	// Slow enough that a stream is still running when its client goes away
+	cfg.Stream.BytesPerSecond = 512 << 10
+	server := newTestServer(t, cfg)
+	user := server.register(t)
+	// Larger than one buffer, so ranges are read through ReadBuffer too
+	content := make([]byte, 3<<20)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	objectName := uniqueName(t, "long") + ".mp4"
+	resp := server.upload(t, user.token, "long.mp4", content, map[string]string{"objectName": objectName})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	// get requests the video with rangeHeader, if any, under ctx
+	get := func(ctx context.Context, rangeHeader string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/video?objectName="+objectName, nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		return server.do(t, req, user.token)
+	}
+
+	// A client that drops the full download resumes it with a range
+	ctx, cancel := context.WithCancel(context.Background())
+	resp = get(ctx, "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Accept-Ranges") != "bytes" ||
+		resp.Header.Get("Content-Length") != strconv.Itoa(len(content)) {
+		t.Fatalf("full stream: got %d with headers %v", resp.StatusCode, resp.Header)
+	}
+	received := make([]byte, 100<<10)
+	if _, err := io.ReadFull(resp.Body, received); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	resp.Body.Close()
+	resp = get(context.Background(), "bytes="+strconv.Itoa(len(received))+"-")
+	rest, err := io.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusPartialContent || resp.Header.Get("Accept-Ranges") != "bytes" {
+		t.Fatalf("resuming: got %d, %v", resp.StatusCode, err)
+	}
+	if !bytes.Equal(append(received, rest...), content) {
+		t.Fatal("resumed download differs from the upload")
+	}
+
+	// Both paths stop reading once their client is gone
+	for _, rangeHeader := range []string{"", "bytes=0-"} {
+		ctx, cancel := context.WithCancel(context.Background())
+		resp := get(ctx, rangeHeader)
+		io.ReadFull(resp.Body, make([]byte, 1024))
+		if server.streaming.ActiveStreams() != 1 {
+			t.Fatalf("Range %q: %d active streams, want 1", rangeHeader, server.streaming.ActiveStreams())
+		}
+		cancel()
+		resp.Body.Close()
+		deadline := time.Now().Add(2 * time.Second)
+		for server.streaming.ActiveStreams() != 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("Range %q: stream kept running after the client went away", rangeHeader)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
@@ -1,44 +1,227 @@
 package router
 
 import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/time/rate"
 
+	"config"
 	"db"
 	. "middlewares"
 	. "services"
 )
 
-// SetupRouter initializes Gin engine with all routes and rate limiting.
-func SetupRouter(database *db.PrismaClient) *gin.Engine {
-	r := gin.Default()
+// SetupRouter initializes Gin engine with all routes and rate limiting, as cfg
+// describes. Background work it starts, like limiter cleanup and the expiry
+// sweeper, stops when ctx is done.
+func SetupRouter(ctx context.Context, database *db.PrismaClient, cfg *config.Config) *gin.Engine {
+	return SetupRouterWithStreaming(ctx, database, cfg, NewStreaming(ctx, database, cfg))
+}
+
+// SetupRouterWithStreaming is SetupRouter with the video service supplied by
+// the caller, so tests can wire the routes to their own MinIO and database.
+func SetupRouterWithStreaming(ctx context.Context, database *db.PrismaClient, cfg *config.Config, streaming *Streaming) *gin.Engine {
+	Configure(cfg)
+	// Rotated signing keys live in the database so restarts and other
+	// instances use them too
+	if err := UseKeyStore(ctx, dbKeyStore{database}); err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+	go RefreshSigningKeys(ctx, 30*time.Second)
+	// Lookups compare normalized emails, so older mixed-case ones are migrated
+	if err := lowercaseStoredEmails(ctx, database); err != nil {
+		log.Fatalf("Failed to lowercase stored emails: %v", err)
+	}
+	r := gin.New()
+
+	// Only honor X-Forwarded-For from known proxies so ClientIP reflects the real client
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	r.Use(TracingMiddleware())
+	r.Use(RequestIDMiddleware(), RecoveryMiddleware(log.Default()))
+	r.Use(LoggingMiddleware(NewAccessLogger(cfg.AccessLog), SlowRequestThresholds{
+		Default:      cfg.Server.SlowRequest,
+		Stream:       cfg.Server.SlowStreamRequest,
+		StreamRoutes: []string{"/api/video", "/api/public/video", "/api/shared/video"},
+	}))
+	// Cross-origin access is off unless origins are configured. Public and shared
+	// videos have a policy of their own, so they can be embedded more widely
+	// than the API is exposed.
+	corsGroups := make(map[string]CORSConfig)
+	if len(cfg.Server.CORSAllowedOrigins) > 0 {
+		corsGroups["/api"] = CORSConfig{
+			AllowedOrigins:   cfg.Server.CORSAllowedOrigins,
+			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowedHeaders:   []string{TokenHeaderName(), "Content-Type", "Range", "If-Match", "Idempotency-Key"},
+			MaxAge:           cfg.Server.CORSMaxAge,
+			AllowCredentials: cfg.Server.CORSAllowCredentials,
+		}
+	}
+	if len(cfg.Server.CORSPublicAllowedOrigins) > 0 {
+		publicCORS := CORSConfig{
+			AllowedOrigins: cfg.Server.CORSPublicAllowedOrigins,
+			AllowedMethods: []string{"GET", "HEAD", "OPTIONS"},
+			AllowedHeaders: []string{"Range"},
+			MaxAge:         cfg.Server.CORSMaxAge,
+		}
+		corsGroups["/api/public"] = publicCORS
+		corsGroups["/api/shared"] = publicCORS
+	}
+	for prefix, corsConfig := range corsGroups {
+		if err := corsConfig.Validate(); err != nil {
+			log.Fatalf("Invalid CORS configuration for %s: %v", prefix, err)
+		}
+	}
+	if len(corsGroups) > 0 {
+		r.Use(CORSGroups(corsGroups))
+	}
+	// Off by default so local development over plain HTTP keeps working
+	if cfg.Server.ForceHTTPS {
+		httpsConfig := HTTPSConfig{
+			HSTSMaxAge:     365 * 24 * time.Hour,
+			TrustedProxies: cfg.Server.TrustedProxies,
+			CanonicalHost:  cfg.Server.CanonicalHost,
+		}
+		if err := httpsConfig.Validate(); err != nil {
+			log.Fatalf("Invalid HTTPS configuration: %v", err)
+		}
+		r.Use(HTTPSMiddleware(httpsConfig))
+	}
+	// RATE_LIMIT_ENABLED=false turns rate limiting off for load tests and local development
+	var authRateLimit []gin.HandlerFunc
+	// loginLimiter throttles failed logins per account, on top of the per-client auth limit
+	var loginLimiter *RateLimiter
+	if cfg.RateLimit.Enabled {
+		// Create rate limiters
+		generalLimiter := NewRateLimiter(rate.Every(time.Second), 10, 5*time.Minute, 5*time.Minute) // 10 requests per second
+		go generalLimiter.CleanupExpiredLimiters(ctx)
 
-	r.Use(LoggingMiddleware())
-	// Create rate limiters
-	generalLimiter := NewRateLimiter(rate.Every(time.Second), 10) // 10 requests per second
-	authLimiter := NewRateLimiter(rate.Every(time.Minute), 5)     // 5 requests per minute for auth
+		// 5 requests per minute for auth; the sliding window forbids bursts across minute boundaries
+		var authLimiter Limiter
+		if cfg.RateLimit.AuthLimiter == "sliding" {
+			slidingLimiter := NewSlidingWindowLimiter(5, time.Minute)
+			go slidingLimiter.CleanupExpiredLimiters(ctx, 5*time.Minute)
+			authLimiter = slidingLimiter
+		} else {
+			tokenLimiter := NewRateLimiter(rate.Every(time.Minute), 5, 5*time.Minute, 5*time.Minute)
+			go tokenLimiter.CleanupExpiredLimiters(ctx)
+			authLimiter = tokenLimiter
+		}
 
-	// Start cleanup goroutine for expired limiters
-	go generalLimiter.CleanupExpiredLimiters()
-	go authLimiter.CleanupExpiredLimiters()
+		// Apply general rate limiting to all routes
+		r.Use(RateLimitMiddleware(generalLimiter))
+		authRateLimit = append(authRateLimit, StrictRateLimitMiddleware(authLimiter))
+
+		// Each network gets LOGIN_ATTEMPTS_PER_EMAIL failed logins per account,
+		// refilled one per minute. Keying on the network too means guessing at an
+		// account cannot lock its owner out from elsewhere.
+		if cfg.RateLimit.LoginPerEmail > 0 {
+			emailLimiter := NewRateLimiter(rate.Every(time.Minute), cfg.RateLimit.LoginPerEmail, 5*time.Minute, 15*time.Minute)
+			go emailLimiter.CleanupExpiredLimiters(ctx)
+			loginLimiter = emailLimiter
+		}
+	}
+	// Compress API responses; video streams are already compressed and must keep their byte ranges.
+	// GZIP_LEVEL=0 turns compression off.
+	if cfg.Server.GzipLevel != gzip.NoCompression {
+		r.Use(GzipMiddleware(cfg.Server.GzipLevel, cfg.Server.GzipMinSize,
+			"/api/video",
+			"/api/video/upload/progress",
+			"/api/public/video",
+			"/api/shared/video",
+		))
+	}
+	// Cap request bodies; uploads are limited by their handlers
+	r.Use(BodyLimitMiddleware(cfg.Server.MaxJSONBodyBytes,
+		"POST /api/video/upload",
+		"POST /api/video/upload-batch",
+	))
+	// Bound request time, except for streaming and uploads which are long-lived by design
+	r.Use(TimeoutMiddleware(cfg.Server.RequestTimeout,
+		"GET /api/video",
+		"POST /api/video/upload",
+		"POST /api/video/upload-batch",
+		"GET /api/video/upload/progress",
+		"GET /api/video/objects/all",
+		"GET /api/public/video",
+		"GET /api/shared/video",
+		// CPU profiles and traces run for as long as their seconds parameter asks
+		"GET /api/admin/debug/pprof/profile",
+		"GET /api/admin/debug/pprof/trace",
+	))
+	// Maintenance mode pauses write routes during deploys, toggled through the admin API
+	maintenance := NewMaintenanceMode(cfg.Server.MaintenanceMode, 60*time.Second)
+	writes := MaintenanceMiddleware(maintenance)
+	// Let retried copies and shares replay the original response
+	idempotent := IdempotencyMiddleware(NewIdempotencyStore(10*time.Minute, 10000))
+
+	// Read-only mode blocks uploads, registration and other mutations for
+	// longer windows while reads and streaming stay up
+	readOnly := NewReadOnlyMode(cfg.Server.ReadOnlyMode)
+	r.Use(ReadOnlyMiddleware(readOnly,
+		"/api/register",
+		"/api/profile",
+		"/api/profile/password",
+		"/api/video",
+		"/api/video/upload",
+		"/api/video/upload-batch",
+		"/api/video/copy",
+		"/api/video/rename",
+		"/api/video/visibility",
+		"/api/video/tags",
+		"/api/video/share",
+	))
+
+	// Ephemeral uploads are deleted once their expiresIn has passed
+	go streaming.SweepExpiredUploads(ctx, cfg.Upload.ExpirySweepInterval)
+
+	// Logins, failed logins and account changes are written to the AuditEvent table
+	auditLog := NewDBAuditLogger(database)
+
+	// MinIO may still be connecting; storage-backed routes report 503 until it is
+	storage := streaming.RequireStorage()
+	// With USER_KEY_PREFIX, users only reach objects under their own prefix
+	userScope := streaming.RequireUserScope()
+
+	// Playback middleware, shared by the authenticated and public stream routes.
+	// Hotlink protection only applies to playback
+	refererCheck := RefererMiddleware(cfg.Server.VideoAllowedReferers)
+	streamLimit := ConcurrencyLimitMiddleware(NewConcurrencyLimiter(cfg.Stream.MaxPerUser))
+	// MSE-based players read the range headers from cross-origin responses
+	rangeHeaders := ExposeHeaders("Content-Range", "Accept-Ranges", "Content-Length")
 
-	// Apply general rate limiting to all routes
-	r.Use(RateLimitMiddleware(generalLimiter))
-	streaming := NewStreaming()
 	// Public routes
 	pub := r.Group("/api")
 	{
+		pub.GET("/version", versionHandler)
+		// Introspection is only offered once a service credential is configured
+		if cfg.Auth.IntrospectClientSecret != "" {
+			pub.POST("/token/introspect", introspectToken(cfg.Auth.IntrospectClientID, cfg.Auth.IntrospectClientSecret))
+		}
+
+		// Videos marked public stream without a token; private ones answer 404
+		pub.GET("/public/video", rangeHeaders, refererCheck, storage, streamLimit, func(c *gin.Context) {
+			streaming.PublicStream(c)
+		})
+
+		// Share links carry a stream token valid for a single video only
+		pub.GET("/shared/video", StreamTokenMiddleware(), rangeHeaders, refererCheck, storage, streamLimit, func(c *gin.Context) {
+			streaming.Stream(c.Writer, c.Request)
+		})
+
 		// Apply stricter rate limiting to authentication endpoints
 		authRoutes := pub.Group("/")
-		authRoutes.Use(StrictRateLimitMiddleware(authLimiter))
-		pub.POST("/video/upload", func(c *gin.Context) {
-			streaming.UploadVideo(c)
-		})
+		authRoutes.Use(authRateLimit...)
 		{
-			authRoutes.POST("/register", func(c *gin.Context) {
+			authRoutes.POST("/register", writes, func(c *gin.Context) {
 				var req struct {
 					Username string `json:"username" binding:"required"`
 					Password string `json:"password" binding:"required"`
@@ -46,29 +229,52 @@ func SetupRouter(database *db.PrismaClient) *gin.Engine {
 					Age      int    `json:"age" binding:"required,min=0"`
 				}
 				if err := c.ShouldBindJSON(&req); err != nil {
-					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					RespondBindError(c, err)
+					return
+				}
+
+				email, err := NormalizeEmail(req.Email)
+				if err != nil {
+					RespondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 					return
 				}
 
 				hash, err := HashPassword(req.Password)
 				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "could not secure password"})
+					RespondError(c, http.StatusInternalServerError, CodeInternal, "could not secure password")
 					return
 				}
 
-				database.User.CreateOne(
+				user, err := database.User.CreateOne(
 					db.User.Name.Set(req.Username),
 					db.User.Password.Set(hash),
-					db.User.Email.Set(req.Email),
+					db.User.Email.Set(email),
 					db.User.Age.Set(req.Age),
 				).Exec(c.Request.Context())
+				if _, ok := db.IsErrUniqueConstraint(err); ok {
+					RespondError(c, http.StatusConflict, CodeConflict, "email already in use")
+					return
+				}
+				if err != nil {
+					RespondError(c, http.StatusInternalServerError, CodeInternal, "could not create user")
+					return
+				}
+				audit(c, auditLog, AuditRegister, user.Email)
 
-				token, err := GenerateToken(req.Email)
+				token, err := GenerateToken(user.Email, user.Name)
 				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate token"})
+					RespondError(c, http.StatusInternalServerError, CodeInternal, "could not generate token")
 					return
 				}
-				c.JSON(http.StatusOK, gin.H{"status": "registration successful", "token": token})
+				if c.Query("cookie") == "true" {
+					SetTokenCookie(c, token)
+				}
+				resp := gin.H{"status": "registration successful", "token": token}
+				// Saves clients a follow-up GET /profile
+				if c.Query("include") == "profile" {
+					resp["profile"] = profileJSON(user)
+				}
+				c.JSON(http.StatusOK, resp)
 			})
 
 			authRoutes.POST("/login", func(c *gin.Context) {
@@ -77,66 +283,290 @@ func SetupRouter(database *db.PrismaClient) *gin.Engine {
 					Password string `json:"password" binding:"required"`
 				}
 				if err := c.ShouldBindJSON(&creds); err != nil {
-					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					RespondBindError(c, err)
 					return
 				}
 
-				user, err := database.User.FindUnique(
-					db.User.Email.Equals(creds.Email),
-				).Exec(c.Request.Context())
+				// Emails are stored normalized; anything that fails normalization cannot match
+				email, _ := NormalizeEmail(creds.Email)
+				// What failures are counted and recorded under, bounded whatever was sent
+				identifier := auditEmail(creds.Email)
+				throttleKey := identifier + " " + RateLimitKey(c)
+				if loginLimiter != nil && loginLimiter.Exhausted(throttleKey) {
+					c.Header("Retry-After", "60")
+					RespondProblem(c, http.StatusTooManyRequests, CodeRateLimited, "too many login attempts for this account, retry after 60s")
+					return
+				}
+				user, err := findActiveUser(c.Request.Context(), database, email)
 				if err != nil || !CheckPassword(user.Password, creds.Password) {
-					c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+					// Only failures count, so the owner logging in does not use up attempts
+					if loginLimiter != nil {
+						loginLimiter.Allow(throttleKey)
+					}
+					audit(c, auditLog, AuditLoginFailed, identifier)
+					RespondProblem(c, http.StatusUnauthorized, CodeUnauthorized, "invalid credentials")
 					return
 				}
 
-				token, err := GenerateToken(user.Email)
+				// Upgrade hashes made at an outdated cost while the plaintext is at hand
+				if NeedsRehash(user.Password) {
+					if hash, err := HashPassword(creds.Password); err == nil {
+						_, err = database.User.FindUnique(
+							db.User.ID.Equals(user.ID),
+						).Update(
+							db.User.Password.Set(hash),
+						).Exec(c.Request.Context())
+						if err != nil {
+							log.Printf("Failed to rehash password for %s: %v\n", user.Email, err)
+						}
+					}
+				}
+
+				token, err := GenerateToken(user.Email, user.Name)
 				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate token"})
+					RespondError(c, http.StatusInternalServerError, CodeInternal, "could not generate token")
 					return
 				}
-				c.JSON(http.StatusOK, gin.H{"token": token})
+				audit(c, auditLog, AuditLogin, user.Email)
+				if c.Query("cookie") == "true" {
+					SetTokenCookie(c, token)
+				}
+				resp := gin.H{"token": token}
+				if c.Query("include") == "profile" {
+					resp["profile"] = profileJSON(user)
+				}
+				c.JSON(http.StatusOK, resp)
 			})
 		}
 	}
 
 	// Protected routes
 	prot := r.Group("/api")
-	prot.Use(JwtMiddleware())
+	prot.Use(JwtMiddleware(), activeOnly(database))
+	// Scoped tokens only reach the routes of their audience
+	account := prot.Group("/", RequireAudience(AudienceAccount))
+	videos := prot.Group("/", RequireAudience(AudienceVideos))
 	{
-		prot.GET("/profile", func(c *gin.Context) {
-			email := c.GetString("email")
-			c.JSON(http.StatusOK, gin.H{"message": "Welcome, " + email})
+		account.GET("/profile", func(c *gin.Context) {
+			user, err := findActiveUser(c.Request.Context(), database, c.GetString("email"))
+			if errors.Is(err, db.ErrNotFound) {
+				RespondError(c, http.StatusNotFound, CodeNotFound, "user not found")
+				return
+			}
+			if err != nil {
+				RespondError(c, http.StatusInternalServerError, CodeInternal, "could not load profile")
+				return
+			}
+			c.JSON(http.StatusOK, profileJSON(user))
 		})
-		prot.PUT("/profile", func(c *gin.Context) {
+		account.GET("/me", me(database, streaming))
+		account.PUT("/profile", writes, func(c *gin.Context) {
+			// All fields are optional; only the ones present are updated
 			var req struct {
-				Username string `json:"username" binding:"required"`
-				Email    string `json:"email" binding:"required,email"`
-				Age      int    `json:"age" binding:"required,min=0"`
+				Username *string `json:"username" binding:"omitempty,min=1"`
+				Email    *string `json:"email" binding:"omitempty,email"`
+				Age      *int    `json:"age" binding:"omitempty,min=0"`
 			}
 			if err := c.ShouldBindJSON(&req); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				RespondBindError(c, err)
+				return
+			}
+
+			var params []db.UserSetParam
+			if req.Username != nil {
+				params = append(params, db.User.Name.Set(*req.Username))
+			}
+			if req.Email != nil {
+				normalized, err := NormalizeEmail(*req.Email)
+				if err != nil {
+					RespondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+					return
+				}
+				params = append(params, db.User.Email.Set(normalized))
+			}
+			if req.Age != nil {
+				params = append(params, db.User.Age.Set(*req.Age))
+			}
+			if len(params) == 0 {
+				RespondError(c, http.StatusBadRequest, CodeInvalidRequest, "no fields to update")
 				return
 			}
+
 			email := c.GetString("email")
-			_, err := database.User.UpsertOne(
-				db.User.Email.Equals(email),
+			current, err := findActiveUser(c.Request.Context(), database, email)
+			if errors.Is(err, db.ErrNotFound) {
+				RespondError(c, http.StatusNotFound, CodeNotFound, "user not found")
+				return
+			}
+			if err != nil {
+				RespondError(c, http.StatusInternalServerError, CodeInternal, "could not update profile")
+				return
+			}
+			user, err := database.User.FindUnique(
+				db.User.ID.Equals(current.ID),
+			).Update(params...).Exec(c.Request.Context())
+			if _, ok := db.IsErrUniqueConstraint(err); ok {
+				RespondError(c, http.StatusConflict, CodeConflict, "email already in use")
+				return
+			}
+			if err != nil {
+				RespondError(c, http.StatusInternalServerError, CodeInternal, "could not update profile")
+				return
+			}
+
+			resp := gin.H{"status": "profile updated"}
+			// The token carries the email and name, so a new one is needed once either changes
+			if user.Email != email || user.Name != current.Name {
+				token, err := GenerateToken(user.Email, user.Name)
+				if err != nil {
+					RespondError(c, http.StatusInternalServerError, CodeInternal, "could not generate token")
+					return
+				}
+				resp["token"] = token
+				if HasTokenCookie(c) {
+					SetTokenCookie(c, token)
+				}
+			}
+			c.JSON(http.StatusOK, resp)
+		})
+
+		account.PUT("/profile/password", writes, changePassword(database, auditLog, cfg.Auth.PasswordHistory))
+		account.DELETE("/profile", writes, func(c *gin.Context) {
+			var req struct {
+				Password string `json:"password" binding:"required"`
+			}
+			if err := c.ShouldBindJSON(&req); err != nil {
+				RespondBindError(c, err)
+				return
+			}
+
+			ctx := c.Request.Context()
+			user, err := findActiveUser(ctx, database, c.GetString("email"))
+			if errors.Is(err, db.ErrNotFound) {
+				RespondError(c, http.StatusNotFound, CodeNotFound, "user not found")
+				return
+			}
+			if err != nil {
+				RespondError(c, http.StatusInternalServerError, CodeInternal, "could not delete account")
+				return
+			}
+			if !CheckPassword(user.Password, req.Password) {
+				RespondError(c, http.StatusUnauthorized, CodeUnauthorized, "invalid credentials")
+				return
+			}
+
+			// Soft delete keeps the row and its videos so an admin can restore the account
+			_, err = database.User.FindUnique(
+				db.User.ID.Equals(user.ID),
 			).Update(
-				db.User.Name.Set(req.Username),
-				db.User.Email.Set(req.Email),
-				db.User.Age.Set(req.Age),
-			).Exec(c.Request.Context())
+				db.User.DeletedAt.Set(time.Now()),
+			).Exec(ctx)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update profile"})
+				RespondError(c, http.StatusInternalServerError, CodeInternal, "could not delete account")
 				return
 			}
-			c.JSON(http.StatusOK, gin.H{"status": "profile updated"})
+
+			RevokeTokens(user.Email)
+			audit(c, auditLog, AuditAccountDeleted, user.Email)
+			c.JSON(http.StatusOK, gin.H{"status": "account deleted"})
 		})
 
-		prot.GET("/video", func(c *gin.Context) {
+		// Tokens are not tracked one by one, so logging out ends every session
+		account.POST("/logout", func(c *gin.Context) {
+			email := c.GetString("email")
+			RevokeTokens(email)
+			ClearTokenCookie(c)
+			audit(c, auditLog, AuditLogout, email)
+			c.JSON(http.StatusOK, gin.H{"status": "logged out"})
+		})
+
+		videos.POST("/video/upload", writes, storage, func(c *gin.Context) {
+			streaming.UploadVideo(c)
+		})
+
+		videos.GET("/video/upload/progress", func(c *gin.Context) {
+			streaming.UploadProgress(c)
+		})
+
+		videos.POST("/video/upload-batch", writes, storage, func(c *gin.Context) {
+			streaming.UploadVideoBatch(c)
+		})
+
+		videos.POST("/video/copy", writes, idempotent, storage, func(c *gin.Context) {
+			streaming.CopyVideo(c)
+		})
+
+		videos.PUT("/video/rename", writes, storage, func(c *gin.Context) {
+			streaming.RenameVideo(c)
+		})
+
+		videos.DELETE("/video", writes, storage, func(c *gin.Context) {
+			streaming.RemoveVideo(c)
+		})
+
+		videos.GET("/video/info", storage, userScope, func(c *gin.Context) {
+			streaming.VideoInfo(c)
+		})
+
+		videos.GET("/video/list", func(c *gin.Context) {
+			streaming.ListVideos(c)
+		})
+
+		// Cursor-paged listing straight from MinIO, for buckets too large for page numbers
+		videos.GET("/video/objects", storage, func(c *gin.Context) {
+			streaming.ListObjects(c)
+		})
+		videos.GET("/video/objects/all", storage, func(c *gin.Context) {
+			streaming.StreamObjects(c)
+		})
+
+		videos.GET("/video/tags", storage, userScope, func(c *gin.Context) {
+			streaming.GetTags(c)
+		})
+		videos.PUT("/video/tags", writes, storage, func(c *gin.Context) {
+			streaming.SetTags(c)
+		})
+
+		videos.PUT("/video/visibility", writes, func(c *gin.Context) {
+			streaming.SetVisibility(c)
+		})
+
+		videos.POST("/video/share", idempotent, shareVideo(database))
+
+		videos.GET("/video", rangeHeaders, refererCheck, storage, userScope, streamLimit, func(c *gin.Context) {
 			streaming.Stream(c.Writer, c.Request)
 		})
 
+		prot.POST("/token", issueScopedToken())
+	}
+
+	// Admin routes
+	admin := r.Group("/api/admin")
+	admin.Use(JwtMiddleware(), RequireAudience(AudienceAdmin), adminOnly(database))
+	{
+		admin.POST("/users/restore", restoreUser(database))
+		admin.PUT("/users/quota", setUploadQuota(database))
+		admin.GET("/maintenance", maintenanceStatus(maintenance))
+		admin.PUT("/maintenance", setMaintenance(maintenance))
+		admin.GET("/read-only", readOnlyStatus(readOnly))
+		admin.PUT("/read-only", setReadOnly(readOnly))
+		admin.GET("/streams", streamsStatus(streaming))
+		admin.GET("/metrics", metricsHandler(streaming))
+		admin.POST("/jwt/rotate", rotateSigningKey(cfg.Auth.KeyRotationGrace))
+		// Profiling is off unless PPROF_ENABLED is set, since profiles expose internals
+		if cfg.Server.PprofEnabled {
+			mountPprof(admin.Group("/debug/pprof"))
+		}
 	}
 
+	// Answer unmatched routes in JSON like the rest of the API
+	r.HandleMethodNotAllowed = true
+	r.NoRoute(func(c *gin.Context) {
+		RespondError(c, http.StatusNotFound, CodeNotFound, "not found")
+	})
+	r.NoMethod(func(c *gin.Context) {
+		RespondError(c, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method not allowed")
+	})
+
 	return r
 }
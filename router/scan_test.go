@@ -0,0 +1,57 @@
+//go:build integration
+
+package router
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// signatureScanner flags content containing signature
+type signatureScanner struct {
+	signature []byte
+	err       error
+}
+
+func (s signatureScanner) Scan(r io.Reader) (bool, error) {
+	if s.err != nil {
+		return false, s.err
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Contains(content, s.signature), nil
+}
+
+func TestUploadsAreScanned(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	server.streaming.Scanner = signatureScanner{signature: []byte("EICAR")}
+	user := server.register(t)
+
+	infected := uniqueName(t, "infected") + ".mp4"
+	resp := server.upload(t, user.token, "a.mp4", []byte("prefix EICAR suffix"), map[string]string{"objectName": infected})
+	decodeResponse(t, resp, http.StatusUnprocessableEntity, nil)
+	if _, err := testMinio.StatObject(context.Background(), testBucketName, infected, minio.StatObjectOptions{}); err == nil {
+		t.Fatal("infected upload was stored")
+	}
+
+	// The scanner reads the file, which must still be stored whole afterwards
+	clean := uniqueName(t, "clean") + ".mp4"
+	resp = server.upload(t, user.token, "a.mp4", []byte("clean video"), map[string]string{"objectName": clean})
+	decodeResponse(t, resp, http.StatusOK, nil)
+	resp = server.request(t, http.MethodGet, "/api/video?objectName="+clean, user.token, nil)
+	if streamed, _ := io.ReadAll(resp.Body); string(streamed) != "clean video" {
+		t.Fatalf("stored %q after scanning", streamed)
+	}
+
+	server.streaming.Scanner = signatureScanner{err: errors.New("scanner unreachable")}
+	resp = server.upload(t, user.token, "a.mp4", []byte("clean video"), map[string]string{"objectName": uniqueName(t, "unscanned") + ".mp4"})
+	decodeResponse(t, resp, http.StatusInternalServerError, nil)
+}
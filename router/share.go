@@ -0,0 +1,65 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"db"
+	. "middlewares"
+)
+
+const (
+	// defaultShareTTL is how long a share link lasts when no ttl is requested
+	defaultShareTTL = time.Hour
+	// maxShareTTL caps how long a share link can last
+	maxShareTTL = 24 * time.Hour
+)
+
+// shareVideo issues a stream token for one of the authenticated user's videos,
+// so it can be played from /api/shared/video without the user's JWT.
+func shareVideo(database *db.PrismaClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			ObjectName string `json:"objectName" binding:"required"`
+			// TTLSeconds defaults to an hour and is capped at a day
+			TTLSeconds int `json:"ttlSeconds" binding:"omitempty,min=1"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			RespondBindError(c, err)
+			return
+		}
+		ttl := defaultShareTTL
+		if req.TTLSeconds > 0 {
+			ttl = time.Duration(req.TTLSeconds) * time.Second
+		}
+		if ttl > maxShareTTL {
+			ttl = maxShareTTL
+		}
+
+		_, err := database.Video.FindFirst(
+			db.Video.ObjectName.Equals(req.ObjectName),
+			db.Video.Uploader.Where(db.User.Email.Equals(c.GetString("email"))),
+		).Exec(c.Request.Context())
+		if errors.Is(err, db.ErrNotFound) {
+			RespondError(c, http.StatusNotFound, CodeNotFound, "video not found")
+			return
+		}
+		if err != nil {
+			RespondError(c, http.StatusInternalServerError, CodeInternal, "could not share video")
+			return
+		}
+
+		token, err := GenerateStreamToken(req.ObjectName, ttl)
+		if err != nil {
+			RespondError(c, http.StatusInternalServerError, CodeInternal, "could not share video")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"token":     token,
+			"expiresAt": time.Now().Add(ttl),
+		})
+	}
+}
@@ -0,0 +1,39 @@
+//go:build integration
+
+package router
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTagsOfAnotherUsersVideo(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	owner, other := server.register(t), server.register(t)
+	objectName := uniqueName(t, "tagged") + ".mp4"
+
+	resp := server.upload(t, owner.token, "a.mp4", []byte("tagged video"), map[string]string{"objectName": objectName})
+	decodeResponse(t, resp, http.StatusOK, nil)
+	resp = server.request(t, http.MethodPut, "/api/video/tags", owner.token, map[string]any{
+		"objectName": objectName,
+		"tags":       map[string]string{"status": "private"},
+	})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	var tagged struct {
+		Tags map[string]string `json:"tags"`
+	}
+	resp = server.request(t, http.MethodGet, "/api/video/tags?objectName="+objectName, owner.token, nil)
+	decodeResponse(t, resp, http.StatusOK, &tagged)
+	if tagged.Tags["status"] != "private" {
+		t.Fatalf("owner read tags %v", tagged.Tags)
+	}
+
+	resp = server.request(t, http.MethodGet, "/api/video/tags?objectName="+objectName, other.token, nil)
+	decodeResponse(t, resp, http.StatusNotFound, nil)
+	resp = server.request(t, http.MethodPut, "/api/video/tags", other.token, map[string]any{
+		"objectName": objectName,
+		"tags":       map[string]string{"status": "public"},
+	})
+	decodeResponse(t, resp, http.StatusNotFound, nil)
+}
@@ -0,0 +1,43 @@
+package router
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	. "middlewares"
+)
+
+// scopedAudiences are the audiences a scoped token can be issued for
+var scopedAudiences = []string{AudienceVideos, AudienceAccount}
+
+// issueScopedToken issues a token limited to one part of the API, e.g. for a
+// player that should stream and upload videos but not change the account.
+// Only unscoped tokens may issue them, so a scoped token cannot widen itself.
+func issueScopedToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Audience string `json:"audience" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			RespondBindError(c, err)
+			return
+		}
+		if !slices.Contains(scopedAudiences, req.Audience) {
+			RespondError(c, http.StatusBadRequest, CodeInvalidRequest, "audience must be videos or account")
+			return
+		}
+		if len(c.GetStringSlice("audience")) > 0 {
+			RespondError(c, http.StatusForbidden, CodeForbidden, "scoped tokens cannot issue tokens")
+			return
+		}
+
+		token, err := GenerateToken(c.GetString("email"), c.GetString("name"), req.Audience)
+		if err != nil {
+			RespondError(c, http.StatusInternalServerError, CodeInternal, "could not generate token")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"token": token, "audience": req.Audience})
+	}
+}
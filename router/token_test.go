@@ -0,0 +1,31 @@
+//go:build integration
+
+package router
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestScopedTokens(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+
+	var issued struct {
+		Token string `json:"token"`
+	}
+	resp := server.request(t, http.MethodPost, "/api/token", user.token, map[string]string{"audience": "videos"})
+	decodeResponse(t, resp, http.StatusOK, &issued)
+
+	resp = server.request(t, http.MethodGet, "/api/video/list", issued.Token, nil)
+	decodeResponse(t, resp, http.StatusOK, nil)
+	resp = server.request(t, http.MethodGet, "/api/profile", issued.Token, nil)
+	decodeResponse(t, resp, http.StatusForbidden, nil)
+	resp = server.request(t, http.MethodPost, "/api/token", issued.Token, map[string]string{"audience": "account"})
+	decodeResponse(t, resp, http.StatusForbidden, nil)
+
+	resp = server.request(t, http.MethodPost, "/api/token", user.token, map[string]string{"audience": "admin"})
+	decodeResponse(t, resp, http.StatusBadRequest, nil)
+	resp = server.request(t, http.MethodGet, "/api/profile", user.token, nil)
+	decodeResponse(t, resp, http.StatusOK, nil)
+}
@@ -0,0 +1,85 @@
+//go:build integration
+
+package router
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"db"
+	. "services"
+)
+
+func TestTransactionRollsBackOnFailure(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user, other := server.register(t), server.register(t)
+	ctx := context.Background()
+
+	err := WithTransaction(ctx, testDB, func(tx *Tx) error {
+		tx.Add(testDB.User.FindUnique(db.User.Email.Equals(user.email)).Update(
+			db.User.Name.Set("Renamed"),
+		).Tx())
+		// Fails on the unique email, after the first write
+		tx.Add(testDB.User.FindUnique(db.User.Email.Equals(other.email)).Update(
+			db.User.Email.Set(user.email),
+		).Tx())
+		return nil
+	})
+	if err == nil {
+		t.Fatal("transaction with a failing write succeeded")
+	}
+
+	stored, err := testDB.User.FindUnique(db.User.Email.Equals(user.email)).Exec(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Name == "Renamed" {
+		t.Fatal("first write kept after the second failed")
+	}
+}
+
+func TestPasswordHistoryIsTrimmed(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Auth.PasswordHistory = 3
+	server := newTestServer(t, cfg)
+	user := server.register(t)
+
+	token := user.token
+	current := user.password
+	for _, next := range []string{"second password!", "third password!!", "fourth password!"} {
+		resp := server.request(t, http.MethodPut, "/api/profile/password", token, map[string]string{
+			"currentPassword": current,
+			"newPassword":     next,
+		})
+		decodeResponse(t, resp, http.StatusOK, nil)
+		current = next
+		var login struct {
+			Token string `json:"token"`
+		}
+		resp = server.request(t, http.MethodPost, "/api/login", "", map[string]string{"email": user.email, "password": current})
+		decodeResponse(t, resp, http.StatusOK, &login)
+		token = login.Token
+	}
+
+	stored, err := testDB.User.FindUnique(db.User.Email.Equals(user.email)).Exec(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := testDB.PasswordHistory.FindMany(db.PasswordHistory.UserID.Equals(stored.ID)).Exec(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The current password plus the two before it
+	if len(history) != 2 {
+		t.Fatalf("%d history entries, want 2", len(history))
+	}
+	changeTo := func(password string) *http.Response {
+		return server.request(t, http.MethodPut, "/api/profile/password", token, map[string]string{
+			"currentPassword": current,
+			"newPassword":     password,
+		})
+	}
+	decodeResponse(t, changeTo("second password!"), http.StatusBadRequest, nil)
+	decodeResponse(t, changeTo(user.password), http.StatusOK, nil)
+}
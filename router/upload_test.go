@@ -0,0 +1,176 @@
+//go:build integration
+
+package router
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"testing"
+	"time"
+)
+
+func TestUploadCannotReplaceAnotherUsersVideo(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	owner, other := server.register(t), server.register(t)
+	objectName := uniqueName(t, "taken") + ".mp4"
+	original := []byte("original video")
+
+	resp := server.upload(t, owner.token, "a.mp4", original, map[string]string{"objectName": objectName})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	resp = server.upload(t, other.token, "b.mp4", []byte("replacement"), map[string]string{"objectName": objectName})
+	decodeResponse(t, resp, http.StatusConflict, nil)
+
+	// The object and its ownership are untouched
+	resp = server.request(t, http.MethodGet, "/api/video?objectName="+objectName, owner.token, nil)
+	streamed, _ := io.ReadAll(resp.Body)
+	if !bytes.Equal(streamed, original) {
+		t.Fatalf("object now holds %q, want %q", streamed, original)
+	}
+	resp = server.request(t, http.MethodDelete, "/api/video?objectName="+objectName, other.token, nil)
+	decodeResponse(t, resp, http.StatusNotFound, nil)
+}
+
+func TestUploadReplacesOwnVideo(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	owner := server.register(t)
+	objectName := uniqueName(t, "mine") + ".mp4"
+
+	resp := server.upload(t, owner.token, "a.mp4", []byte("first"), map[string]string{"objectName": objectName})
+	decodeResponse(t, resp, http.StatusOK, nil)
+	resp = server.upload(t, owner.token, "a.mp4", []byte("second"), map[string]string{"objectName": objectName})
+	decodeResponse(t, resp, http.StatusOK, nil)
+
+	resp = server.request(t, http.MethodGet, "/api/video?objectName="+objectName, owner.token, nil)
+	if streamed, _ := io.ReadAll(resp.Body); string(streamed) != "second" {
+		t.Fatalf("object holds %q, want the second upload", streamed)
+	}
+}
+
+func TestUploadVerifiesContentMD5(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	user := server.register(t)
+	content := []byte("archival video")
+	sum := md5.Sum(content)
+	checksum := base64.StdEncoding.EncodeToString(sum[:])
+
+	tests := []struct {
+		name       string
+		contentMD5 string
+		want       int
+	}{
+		{"matching", checksum, http.StatusOK},
+		{"corrupted", base64.StdEncoding.EncodeToString(make([]byte, md5.Size)), http.StatusBadRequest},
+		{"malformed", "not base64", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objectName := uniqueName(t, "archived") + ".mp4"
+			req := server.uploadRequest(t, "a.mp4", content, map[string]string{"objectName": objectName})
+			req.Header.Set("Content-MD5", tt.contentMD5)
+			decodeResponse(t, server.do(t, req, user.token), tt.want, nil)
+
+			// Nothing is stored when the checksum does not match
+			want := http.StatusOK
+			if tt.want != http.StatusOK {
+				want = http.StatusNotFound
+			}
+			resp := server.request(t, http.MethodGet, "/api/video?objectName="+objectName, user.token, nil)
+			decodeResponse(t, resp, want, nil)
+		})
+	}
+}
+
+func TestReplacedVideoIsNotServedFromCache(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Stream.StatCacheTTL = time.Hour
+	server := newTestServer(t, cfg)
+	owner := server.register(t)
+	objectName := uniqueName(t, "cached") + ".mp4"
+	stream := func() string {
+		t.Helper()
+		resp := server.request(t, http.MethodGet, "/api/video?objectName="+objectName, owner.token, nil)
+		streamed, _ := io.ReadAll(resp.Body)
+		return string(streamed)
+	}
+
+	resp := server.upload(t, owner.token, "a.mp4", []byte("short"), map[string]string{"objectName": objectName})
+	decodeResponse(t, resp, http.StatusOK, nil)
+	if got := stream(); got != "short" {
+		t.Fatalf("got %q", got)
+	}
+	// A different size too, so stale info would cut the stream short
+	resp = server.upload(t, owner.token, "a.mp4", []byte("a longer replacement"), map[string]string{"objectName": objectName})
+	decodeResponse(t, resp, http.StatusOK, nil)
+	if got := stream(); got != "a longer replacement" {
+		t.Fatalf("after replacing: got %q", got)
+	}
+}
+
+// uploadTyped uploads content declared as contentType and returns the status
+func (s *testServer) uploadTyped(t *testing.T, token, contentType, content string) int {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("objectName", uniqueName(t, "typed")+".video")
+	part := make(textproto.MIMEHeader)
+	part.Set("Content-Disposition", `form-data; name="file"; filename="clip.video"`)
+	part.Set("Content-Type", contentType)
+	file, err := form.CreatePart(part)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(file, content)
+	form.Close()
+
+	req, err := http.NewRequest(http.MethodPost, s.URL+"/api/video/upload", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp := s.do(t, req, token)
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode
+}
+
+func TestUploadAllowedTypes(t *testing.T) {
+	const (
+		mp4  = "\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"
+		webm = "\x1a\x45\xdf\xa3 webm"
+		// Too unusual for its type to be recognized
+		opaque = "\x00\x01\x02\x03"
+	)
+	tests := []struct {
+		name        string
+		allowed     []string
+		contentType string
+		content     string
+		status      int
+	}{
+		{"allowed", []string{"video/mp4", "video/webm"}, "video/mp4", mp4, http.StatusOK},
+		{"allowed with parameters", []string{"video/mp4", "video/webm"}, "video/webm; codecs=vp9", webm, http.StatusOK},
+		{"disallowed", []string{"video/mp4", "video/webm"}, "image/png", opaque, http.StatusUnsupportedMediaType},
+		{"content of another type", []string{"video/mp4", "video/webm"}, "video/mp4", "<html><body>", http.StatusUnsupportedMediaType},
+		{"unrecognized content", []string{"video/mp4"}, "video/mp4", opaque, http.StatusOK},
+		{"wildcard", []string{"video/*"}, "video/quicktime", opaque, http.StatusOK},
+		{"wildcard sniffed", []string{"video/*"}, "video/webm", webm, http.StatusOK},
+		{"outside the wildcard", []string{"video/*"}, "audio/mpeg", opaque, http.StatusUnsupportedMediaType},
+		{"no allowlist", nil, "application/pdf", "%PDF-1.4", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Upload.AllowedTypes = tt.allowed
+			server := newTestServer(t, cfg)
+			user := server.register(t)
+			if got := server.uploadTyped(t, user.token, tt.contentType, tt.content); got != tt.status {
+				t.Fatalf("got %d, want %d", got, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"db"
+	. "middlewares"
+)
+
+// findActiveUser looks up a user by email, ignoring soft-deleted accounts.
+// It returns db.ErrNotFound when no active user matches.
+func findActiveUser(ctx context.Context, database *db.PrismaClient, email string) (*db.UserModel, error) {
+	ctx, span := otel.Tracer("router").Start(ctx, "prisma.User.FindFirst", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	user, err := database.User.FindFirst(
+		db.User.Email.Equals(email),
+		db.User.DeletedAt.IsNull(),
+	).Exec(ctx)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return user, err
+}
+
+// lowercaseStoredEmails lowercases the emails of accounts registered before
+// emails were normalized, which lookups would otherwise no longer find. Two
+// accounts differing only in case would collide, so those are left alone and
+// logged for an admin to merge.
+func lowercaseStoredEmails(ctx context.Context, database *db.PrismaClient) error {
+	result, err := database.Prisma.ExecuteRaw(
+		`UPDATE "User" u SET "email" = lower(u."email")
+		WHERE u."email" <> lower(u."email")
+		AND (SELECT COUNT(*) FROM "User" o WHERE lower(o."email") = lower(u."email")) = 1`,
+	).Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if result.Count > 0 {
+		log.Printf("Lowercased the emails of %d accounts\n", result.Count)
+	}
+
+	var colliding []struct {
+		Email string `json:"email"`
+	}
+	err = database.Prisma.QueryRaw(`SELECT "email" FROM "User" WHERE "email" <> lower("email")`).Exec(ctx, &colliding)
+	if err != nil {
+		return err
+	}
+	for _, user := range colliding {
+		log.Printf("Account %s differs from another only in case and cannot log in until merged\n", user.Email)
+	}
+	return nil
+}
+
+// activeOnly rejects tokens of soft-deleted accounts. Revocations only live in
+// memory, so after a restart or on another instance a deleted user's token
+// would otherwise still be accepted until it expires.
+func activeOnly(database *db.PrismaClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, err := findActiveUser(c.Request.Context(), database, c.GetString("email"))
+		if errors.Is(err, db.ErrNotFound) {
+			RespondProblem(c, http.StatusUnauthorized, CodeUnauthorized, "account has been deleted")
+			c.Abort()
+			return
+		}
+		if err != nil {
+			AbortWithError(c, http.StatusInternalServerError, CodeInternal, "could not verify account")
+			return
+		}
+		c.Next()
+	}
+}
+
+// profileJSON is the public view of a user; it never includes the password hash.
+func profileJSON(user *db.UserModel) gin.H {
+	return gin.H{
+		"id":        user.ID,
+		"name":      user.Name,
+		"email":     user.Email,
+		"age":       user.Age,
+		"createdAt": user.CreatedAt,
+	}
+}
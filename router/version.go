@@ -0,0 +1,27 @@
+package router
+
+import (
+	"net/http"
+	"runtime"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Build information, injected at build time with e.g.
+//
+//	go build -ldflags "-X router.Version=1.2.0 -X router.Commit=$(git rev-parse HEAD) -X router.BuildTime=$(date -u +%FT%TZ)"
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+// versionHandler reports which build is running.
+func versionHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"version":   Version,
+		"commit":    Commit,
+		"buildTime": BuildTime,
+		"goVersion": runtime.Version(),
+	})
+}
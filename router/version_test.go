@@ -0,0 +1,28 @@
+//go:build integration
+
+package router
+
+import (
+	"net/http"
+	"runtime"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	server := newTestServer(t, testConfig(t))
+	defer func(version, commit string) { Version, Commit = version, commit }(Version, Commit)
+	Version, Commit = "1.2.3", "abc123"
+
+	// No token needed
+	resp := server.request(t, http.MethodGet, "/api/version", "", nil)
+	var build struct {
+		Version   string `json:"version"`
+		Commit    string `json:"commit"`
+		BuildTime string `json:"buildTime"`
+		GoVersion string `json:"goVersion"`
+	}
+	decodeResponse(t, resp, http.StatusOK, &build)
+	if build.Version != "1.2.3" || build.Commit != "abc123" || build.BuildTime == "" || build.GoVersion != runtime.Version() {
+		t.Fatalf("got %+v", build)
+	}
+}
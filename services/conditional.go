@@ -0,0 +1,53 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"middlewares"
+)
+
+// respondJSONCached sends response as JSON with an ETag hashed from the body,
+// answering 304 with no body when If-None-Match already names it, so polling
+// clients only download a listing when it changed. lastModified, the newest
+// item in the response, is sent as Last-Modified when set. If-Modified-Since
+// is not honored: removing an item changes the body without moving that time.
+func respondJSONCached(c *gin.Context, response any, lastModified time.Time) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not encode response")
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	c.Header("ETag", etag)
+	// Clients must revalidate, so a changed listing is never served stale
+	c.Header("Cache-Control", "private, no-cache")
+	if !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if noneMatch(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// noneMatch reports whether an If-None-Match header value names etag. The
+// comparison is weak, as RFC 9110 requires for If-None-Match.
+func noneMatch(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
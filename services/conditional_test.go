@@ -0,0 +1,63 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRespondJSONCached(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	respond := func(response any, ifNoneMatch string) *httptest.ResponseRecorder {
+		r := gin.New()
+		r.GET("/api/video/list", func(c *gin.Context) { respondJSONCached(c, response, modified) })
+		req := httptest.NewRequest(http.MethodGet, "/api/video/list", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	listing := gin.H{"items": []string{"a.mp4", "b.mp4"}}
+
+	w := respond(listing, "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || w.Body.String() != `{"items":["a.mp4","b.mp4"]}` {
+		t.Fatalf("got %d with ETag %q and body %s", w.Code, etag, w.Body)
+	}
+	if got := w.Header().Get("Last-Modified"); got != "Wed, 01 May 2024 10:00:00 GMT" {
+		t.Fatalf("got Last-Modified %q", got)
+	}
+
+	tests := []struct {
+		name        string
+		response    any
+		ifNoneMatch string
+		status      int
+	}{
+		{"unchanged", listing, etag, http.StatusNotModified},
+		{"weak validator", listing, "W/" + etag, http.StatusNotModified},
+		{"one of several", listing, `"stale", ` + etag, http.StatusNotModified},
+		{"any", listing, "*", http.StatusNotModified},
+		{"stale", listing, `"stale"`, http.StatusOK},
+		{"changed", gin.H{"items": []string{"a.mp4"}}, etag, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := respond(tt.response, tt.ifNoneMatch)
+			if w.Code != tt.status {
+				t.Fatalf("got %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusNotModified && (w.Body.Len() != 0 || w.Header().Get("ETag") != etag) {
+				t.Fatalf("304 with %d bytes and ETag %q", w.Body.Len(), w.Header().Get("ETag"))
+			}
+			if tt.name == "changed" && w.Header().Get("ETag") == etag {
+				t.Fatal("changed listing kept its ETag")
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minio/minio-go/v7"
+
+	"middlewares"
+)
+
+const (
+	initialConnectDelay = time.Second
+	maxConnectDelay     = 30 * time.Second
+)
+
+// errStorageUnavailable is returned when MinIO has not been reached yet
+var errStorageUnavailable = errors.New("video storage unavailable")
+
+// ensureBucket creates the videos bucket in the configured region if it does not exist yet.
+func ensureBucket(ctx context.Context, client *minio.Client, region string) error {
+	exists, err := client.BucketExists(ctx, bucketName)
+	if err != nil || exists {
+		return err
+	}
+	err = client.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{Region: region})
+	if err != nil {
+		return fmt.Errorf("creating bucket %s: %w", bucketName, err)
+	}
+	log.Printf("Created bucket %s\n", bucketName)
+	return nil
+}
+
+// connect retries creating and checking the MinIO client with exponential
+// backoff until it succeeds, then marks the service as ready. It gives up
+// once ctx is done.
+func (streaming *Streaming) connect(ctx context.Context) {
+	delay := initialConnectDelay
+	for {
+		client, err := NewMinioClient(streaming.minioConfig)
+		if err == nil {
+			checkCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			err = ensureBucket(checkCtx, client, streaming.minioConfig.Region)
+			cancel()
+		}
+		if err == nil {
+			streaming.Client = client
+			streaming.ready.Store(true)
+			log.Println("Connected to MinIO")
+			return
+		}
+
+		log.Printf("MinIO unavailable, retrying in %v: %v\n", delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		delay = min(delay*2, maxConnectDelay)
+	}
+}
+
+// Ready reports whether the MinIO connection has been established.
+func (streaming *Streaming) Ready() bool {
+	return streaming.ready.Load()
+}
+
+// RequireStorage answers 503 on routes that need MinIO until it is reachable.
+func (streaming *Streaming) RequireStorage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !streaming.Ready() {
+			c.Header("Retry-After", "30")
+			middlewares.AbortWithError(c, http.StatusServiceUnavailable, middlewares.CodeUnavailable, errStorageUnavailable.Error())
+			return
+		}
+		c.Next()
+	}
+}
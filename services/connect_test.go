@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"config"
+)
+
+func TestRequireStorage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	streaming := &Streaming{}
+	r := gin.New()
+	r.GET("/video", streaming.RequireStorage(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/video", nil))
+		return w
+	}
+
+	if w := get(); w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "30" {
+		t.Fatalf("before MinIO is reached: got %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	streaming.ready.Store(true)
+	if w := get(); w.Code != http.StatusOK {
+		t.Fatalf("once MinIO is reached: got %d", w.Code)
+	}
+}
+
+func TestBucketCreatedInConfiguredRegion(t *testing.T) {
+	var created, scope string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			w.WriteHeader(http.StatusNotFound)
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			created = string(body)
+			// Credential=<key>/<date>/<region>/s3/aws4_request
+			_, credential, _ := strings.Cut(r.Header.Get("Authorization"), "Credential=")
+			scope = strings.Split(credential, "/")[2]
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewMinioClient(config.MinIOConfig{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		AccessKey: "access",
+		SecretKey: "secret",
+		Region:    "eu-central-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ensureBucket(context.Background(), client, "eu-central-1"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(created, "<LocationConstraint>eu-central-1</LocationConstraint>") {
+		t.Fatalf("bucket created with %q, want it in eu-central-1", created)
+	}
+	if scope != "eu-central-1" {
+		t.Fatalf("request signed for region %q", scope)
+	}
+}
+
+func TestConnectStopsWithContext(t *testing.T) {
+	// Nothing listens on port 1, so every attempt fails
+	streaming := &Streaming{minioConfig: config.MinIOConfig{Endpoint: "127.0.0.1:1", AccessKey: "access", SecretKey: "secret"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		streaming.connect(ctx)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("connect kept retrying after its context was cancelled")
+	}
+	if streaming.Ready() {
+		t.Fatal("ready without a connection")
+	}
+}
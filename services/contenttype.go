@@ -0,0 +1,97 @@
+package services
+
+import (
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// defaultContentTypes maps video file extensions to the type players expect
+var defaultContentTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".m4v":  "video/x-m4v",
+	".webm": "video/webm",
+	".mov":  "video/quicktime",
+	".mkv":  "video/x-matroska",
+	".ogv":  "video/ogg",
+	".avi":  "video/x-msvideo",
+	".ts":   "video/mp2t",
+	".m3u8": "application/vnd.apple.mpegurl",
+}
+
+// contentTypesWith returns defaultContentTypes with overrides applied. Keys
+// are normalized to a lower-case extension with its leading dot.
+func contentTypesWith(overrides map[string]string) map[string]string {
+	types := maps.Clone(defaultContentTypes)
+	for ext, contentType := range overrides {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		types[ext] = contentType
+	}
+	return types
+}
+
+// isGenericContentType reports whether stored says nothing about the format,
+// as with objects uploaded before content types were recorded.
+func isGenericContentType(stored string) bool {
+	switch strings.ToLower(strings.TrimSpace(stored)) {
+	case "", "application/octet-stream", "binary/octet-stream":
+		return true
+	}
+	return false
+}
+
+// contentType is the type to serve objectName as: stored unless it is
+// generic, in which case it is inferred from the extension. ok is false when
+// the type is generic and the extension unknown.
+func (streaming *Streaming) contentType(objectName, stored string) (contentType string, ok bool) {
+	if !isGenericContentType(stored) {
+		return stored, true
+	}
+	if inferred, found := streaming.contentTypes[strings.ToLower(path.Ext(objectName))]; found {
+		return inferred, true
+	}
+	return stored, false
+}
+
+// contentTypeAllowed reports whether contentType matches an entry of allowed,
+// which may be an exact type such as video/mp4 or a wildcard such as video/*.
+// Parameters like codecs are ignored. An empty allowlist allows everything.
+func contentTypeAllowed(allowed []string, contentType string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(pattern)
+		if pattern == "*/*" || pattern == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// sniffContentType detects the type of file from its first bytes, the way
+// browsers do, and rewinds it.
+func sniffContentType(file io.ReadSeeker) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(head[:n]), nil
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"config"
+)
+
+func TestContentType(t *testing.T) {
+	streaming := &Streaming{contentTypes: contentTypesWith(map[string]string{"MKV": "video/webm", ".flv": "video/x-flv"})}
+	tests := []struct {
+		objectName, stored string
+		want               string
+		ok                 bool
+	}{
+		{"clip.mp4", "application/octet-stream", "video/mp4", true},
+		{"clip.webm", "application/octet-stream", "video/webm", true},
+		{"clip.mov", "binary/octet-stream", "video/quicktime", true},
+		{"stream.m3u8", "", "application/vnd.apple.mpegurl", true},
+		{"CLIP.MP4", "Application/Octet-Stream", "video/mp4", true},
+		// Overrides replace and add to the defaults
+		{"clip.mkv", "application/octet-stream", "video/webm", true},
+		{"clip.flv", "application/octet-stream", "video/x-flv", true},
+		// Specific stored types are kept whatever the extension
+		{"clip.mp4", "video/webm", "video/webm", true},
+		{"clip.unknown", "application/octet-stream", "application/octet-stream", false},
+		{"no-extension", "application/octet-stream", "application/octet-stream", false},
+	}
+	for _, tt := range tests {
+		got, ok := streaming.contentType(tt.objectName, tt.stored)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s stored as %q: got %q, %v; want %q, %v", tt.objectName, tt.stored, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestStreamInfersContentType(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Upload.MaxConcurrent = 1
+	streaming := NewStreamingWithClient(nil, cfg, fakeMinIO(t, map[string]string{
+		"legacy/clip.webm":    "webm",
+		"legacy/clip.unknown": "unknown",
+		"clip.webm":           "stored as mp4",
+	}, nil))
+
+	tests := []struct {
+		objectName string
+		want       string
+		// info is the type info reports, with no fallback for unknown extensions
+		info string
+	}{
+		{"legacy/clip.webm", "video/webm", "video/webm"},
+		// Unknown extensions are streamed as MP4, as everything once was
+		{"legacy/clip.unknown", "video/mp4", "application/octet-stream"},
+		{"clip.webm", "video/mp4", "video/mp4"},
+	}
+	r := gin.New()
+	r.GET("/api/video/info", streaming.VideoInfo)
+	for _, tt := range tests {
+		for _, rangeHeader := range []string{"", "bytes=0-1"} {
+			req := httptest.NewRequest(http.MethodGet, "/api/video?objectName="+tt.objectName, nil)
+			if rangeHeader != "" {
+				req.Header.Set("Range", rangeHeader)
+			}
+			w := httptest.NewRecorder()
+			streaming.Stream(w, req)
+			if got := w.Header().Get("Content-Type"); got != tt.want {
+				t.Errorf("%s with Range %q: got Content-Type %q, want %q", tt.objectName, rangeHeader, got, tt.want)
+			}
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/video/info?objectName="+tt.objectName, nil))
+		var info struct {
+			ContentType string `json:"contentType"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil || info.ContentType != tt.info {
+			t.Errorf("info of %s: got %s, want content type %q", tt.objectName, w.Body, tt.info)
+		}
+	}
+}
+
+func TestContentTypeAllowed(t *testing.T) {
+	tests := []struct {
+		allowed     []string
+		contentType string
+		want        bool
+	}{
+		{nil, "text/html", true},
+		{[]string{"video/mp4", "video/webm"}, "video/mp4", true},
+		{[]string{"video/mp4", "video/webm"}, "video/webm; codecs=vp9", true},
+		{[]string{"video/mp4", "video/webm"}, "Video/MP4", true},
+		{[]string{"video/mp4", "video/webm"}, "video/quicktime", false},
+		{[]string{"video/mp4"}, "video/mp4x", false},
+		{[]string{"video/*"}, "video/quicktime", true},
+		{[]string{"Video/*"}, "video/x-matroska", true},
+		{[]string{"video/*"}, "audio/mpeg", false},
+		{[]string{"video/*"}, "videos/mp4", false},
+		{[]string{"*/*"}, "application/pdf", true},
+		{[]string{"video/*"}, "not a type", false},
+	}
+	for _, tt := range tests {
+		if got := contentTypeAllowed(tt.allowed, tt.contentType); got != tt.want {
+			t.Errorf("%q allowed by %v: got %v, want %v", tt.contentType, tt.allowed, got, tt.want)
+		}
+	}
+}
+
+func TestSniffContentType(t *testing.T) {
+	mp4 := "\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{mp4, "video/mp4"},
+		{"\x1a\x45\xdf\xa3 webm", "video/webm"},
+		{"<html><body>", "text/html; charset=utf-8"},
+		{"\x00\x01\x02\x03", "application/octet-stream"},
+		{"", "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		file := strings.NewReader(tt.content)
+		got, err := sniffContentType(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.content, got, tt.want)
+		}
+		// The file is rewound for the upload
+		if rest, _ := io.ReadAll(file); string(rest) != tt.content {
+			t.Errorf("%q: %d bytes left to read after sniffing", tt.content, len(rest))
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minio/minio-go/v7"
+	"go.opentelemetry.io/otel/attribute"
+
+	"db"
+	"middlewares"
+)
+
+// CopyVideo duplicates one of the authenticated user's videos under a new name
+// with a server-side copy, keeping its content type.
+func (streaming *Streaming) CopyVideo(c *gin.Context) {
+	var req struct {
+		Source      string `json:"source" binding:"required"`
+		Destination string `json:"destination" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middlewares.RespondBindError(c, err)
+		return
+	}
+	if err := validateObjectName(req.Destination); err != nil {
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, err.Error())
+		return
+	}
+	req.Destination = streaming.scopedKey(c, req.Destination)
+
+	source, err := streaming.ownedVideo(c, req.Source)
+	if errors.Is(err, db.ErrNotFound) {
+		middlewares.RespondError(c, http.StatusNotFound, middlewares.CodeNotFound, "video not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to look up video '%s': %v\n", req.Source, err)
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not copy video")
+		return
+	}
+
+	ctx := c.Request.Context()
+	taken, err := streaming.nameTaken(c, req.Destination)
+	if err != nil {
+		log.Printf("Failed to check name '%s': %v\n", req.Destination, err)
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not copy video")
+		return
+	}
+	if taken {
+		middlewares.RespondError(c, http.StatusConflict, middlewares.CodeConflict, "destination name already exists")
+		return
+	}
+
+	// A copy takes up as much storage as an upload of the same file
+	release, uploadErr := streaming.reserveQuota(c, req.Destination, int64(source.Size))
+	if uploadErr != nil {
+		message := uploadErr.message
+		if uploadErr.status == http.StatusInternalServerError {
+			message = "could not copy video"
+		}
+		middlewares.RespondError(c, uploadErr.status, middlewares.CodeForStatus(uploadErr.status), message)
+		return
+	}
+	defer release()
+
+	info, err := streaming.copyToFreeName(ctx, req.Source, req.Destination)
+	streaming.stats.invalidate(req.Destination)
+	// Someone else took the name since it was checked
+	if isPreconditionFailed(err) {
+		middlewares.RespondError(c, http.StatusConflict, middlewares.CodeConflict, "destination name already exists")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to copy '%s' to '%s': %v\n", req.Source, req.Destination, err)
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not copy video")
+		return
+	}
+
+	_, err = streaming.database.Video.CreateOne(
+		db.Video.ObjectName.Set(info.Key),
+		db.Video.Size.Set(source.Size),
+		db.Video.ContentType.Set(source.ContentType),
+		db.Video.Uploader.Link(db.User.ID.Equals(source.UploaderID)),
+		db.Video.Etag.Set(info.ETag),
+	).Exec(ctx)
+	if err != nil {
+		log.Printf("Failed to record metadata for %s: %v\n", info.Key, err)
+		// Without its row the copy would be stored but never listed or counted
+		if err := streaming.DeleteVideo(ctx, info.Key); err != nil {
+			log.Printf("Failed to roll back copy '%s': %v\n", info.Key, err)
+		}
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not copy video")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "copy successful",
+		"objectName":  info.Key,
+		"size":        source.Size,
+		"contentType": source.ContentType,
+		"etag":        info.ETag,
+	})
+}
+
+// copyToFreeName copies source to destination server-side, provided nothing
+// is stored under destination by then, so a concurrent upload or copy to the
+// same name is not overwritten. It fails with a precondition error otherwise.
+// minio.Client.CopyObject cannot send If-None-Match, so this goes through Core.
+func (streaming *Streaming) copyToFreeName(ctx context.Context, source, destination string) (minio.ObjectInfo, error) {
+	ctx, span := startSpan(ctx, "minio.CopyObject", attribute.String("object", destination))
+	info, err := minio.Core{Client: streaming.Client}.CopyObject(ctx,
+		bucketName, source, bucketName, destination,
+		map[string]string{"If-None-Match": "*"},
+		minio.CopySrcOptions{}, minio.PutObjectOptions{},
+	)
+	endSpan(span, err)
+	return info, err
+}
+
+// nameTaken reports whether objectName is already used by a recorded video or a stored object.
+func (streaming *Streaming) nameTaken(c *gin.Context, objectName string) (bool, error) {
+	ctx := c.Request.Context()
+	_, err := streaming.database.Video.FindUnique(
+		db.Video.ObjectName.Equals(objectName),
+	).Exec(ctx)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, db.ErrNotFound) {
+		return false, err
+	}
+
+	_, err = streaming.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
+	if err == nil {
+		return true, nil
+	}
+	if isNoSuchKey(err) {
+		return false, nil
+	}
+	return false, err
+}
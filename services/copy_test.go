@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"config"
+)
+
+// copyingStreaming is backed by a MinIO that stores objects by key and serves server-side copies, honoring
+// If-None-Match: * on the destination as MinIO does
+func copyingStreaming(t *testing.T, stored map[string]bool) *Streaming {
+	t.Helper()
+	var mu sync.Mutex
+	client := minioClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		key := strings.TrimPrefix(r.URL.Path, "/"+bucketName+"/")
+		if r.Method != http.MethodPut || r.Header.Get("X-Amz-Copy-Source") == "" {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		if stored[key] && r.Header.Get("If-None-Match") == "*" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			w.Write([]byte(`<Error><Code>PreconditionFailed</Code><Message>At least one of the pre-conditions you specified did not hold</Message></Error>`))
+			return
+		}
+		stored[key] = true
+		w.Write([]byte(`<CopyObjectResult><ETag>"copied"</ETag><LastModified>2024-01-01T00:00:00Z</LastModified></CopyObjectResult>`))
+	}))
+	cfg := &config.Config{}
+	cfg.Upload.MaxConcurrent = 1
+	return NewStreamingWithClient(nil, cfg, client)
+}
+
+func TestCopyToFreeName(t *testing.T) {
+	stored := map[string]bool{"source.mp4": true, "taken.mp4": true}
+	streaming := copyingStreaming(t, stored)
+
+	info, err := streaming.copyToFreeName(context.Background(), "source.mp4", "free.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Key != "free.mp4" || info.ETag != "copied" || !stored["free.mp4"] {
+		t.Fatalf("got %+v", info)
+	}
+	// A name taken after the check is not overwritten
+	if _, err := streaming.copyToFreeName(context.Background(), "source.mp4", "taken.mp4"); !isPreconditionFailed(err) {
+		t.Fatalf("copy onto a taken name: got %v, want a precondition failure", err)
+	}
+}
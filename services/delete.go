@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minio/minio-go/v7"
+	"go.opentelemetry.io/otel/attribute"
+
+	"db"
+	"middlewares"
+)
+
+// ownedVideo looks up the metadata of objectName if it belongs to the authenticated user.
+func (streaming *Streaming) ownedVideo(c *gin.Context, objectName string) (*db.VideoModel, error) {
+	ctx, span := startSpan(c.Request.Context(), "prisma.Video.FindFirst")
+	video, err := streaming.database.Video.FindFirst(
+		db.Video.ObjectName.Equals(objectName),
+		db.Video.Uploader.Where(db.User.Email.Equals(c.GetString("email"))),
+	).Exec(ctx)
+	endSpan(span, err)
+	return video, err
+}
+
+// DeleteVideo removes a stored video object from MinIO.
+func (streaming *Streaming) DeleteVideo(ctx context.Context, objectName string) error {
+	if !streaming.Ready() {
+		return errStorageUnavailable
+	}
+	defer streaming.stats.invalidate(objectName)
+	ctx, span := startSpan(ctx, "minio.RemoveObject", attribute.String("object", objectName))
+	err := streaming.RemoveObject(ctx, bucketName, objectName, minio.RemoveObjectOptions{})
+	endSpan(span, err)
+	return err
+}
+
+// RemoveVideo deletes one of the authenticated user's videos, honoring If-Match.
+func (streaming *Streaming) RemoveVideo(c *gin.Context) {
+	objectName := c.Query("objectName")
+	if objectName == "" {
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, "missing 'objectName' parameter")
+		return
+	}
+
+	video, err := streaming.ownedVideo(c, objectName)
+	if errors.Is(err, db.ErrNotFound) {
+		middlewares.RespondError(c, http.StatusNotFound, middlewares.CodeNotFound, "video not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to look up video '%s': %v\n", objectName, err)
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not delete video")
+		return
+	}
+
+	etag, ok := streaming.ifMatchETag(c, objectName)
+	if !ok {
+		middlewares.RespondError(c, http.StatusPreconditionFailed, middlewares.CodePreconditionFailed, "object has been modified")
+		return
+	}
+
+	// The record goes first, and under If-Match only while it still holds the
+	// matched ETag (or none, for videos recorded before ETags were): an upload
+	// that replaced the object since the check has changed it. MinIO has no
+	// conditional delete to do this for us. Should the object then fail to be
+	// removed, the record is put back.
+	filters := []db.VideoWhereParam{db.Video.ID.Equals(video.ID)}
+	if etag != "" {
+		filters = append(filters, db.Video.Etag.In([]string{etag, ""}))
+	}
+	ctx := c.Request.Context()
+	deleted, err := streaming.database.Video.FindMany(filters...).Delete().Exec(ctx)
+	if err != nil {
+		log.Printf("Failed to delete metadata for '%s': %v\n", objectName, err)
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not delete video")
+		return
+	}
+	if deleted.Count == 0 && etag != "" {
+		middlewares.RespondError(c, http.StatusPreconditionFailed, middlewares.CodePreconditionFailed, "object has been modified")
+		return
+	}
+	if deleted.Count == 0 {
+		middlewares.RespondError(c, http.StatusNotFound, middlewares.CodeNotFound, "video not found")
+		return
+	}
+	if err := streaming.DeleteVideo(ctx, objectName); err != nil {
+		log.Printf("Failed to delete object '%s': %v\n", objectName, err)
+		if err := streaming.restoreVideo(ctx, video); err != nil {
+			log.Printf("Failed to restore metadata for '%s': %v\n", objectName, err)
+		}
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not delete video")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "video deleted"})
+}
+
+// restoreVideo records video again after its record was deleted, keeping its
+// ID and creation time
+func (streaming *Streaming) restoreVideo(ctx context.Context, video *db.VideoModel) error {
+	var expiresAt *time.Time
+	if at, ok := video.ExpiresAt(); ok {
+		expiresAt = &at
+	}
+	_, err := streaming.database.Video.CreateOne(
+		db.Video.ObjectName.Set(video.ObjectName),
+		db.Video.Size.Set(video.Size),
+		db.Video.ContentType.Set(video.ContentType),
+		db.Video.Uploader.Link(db.User.ID.Equals(video.UploaderID)),
+		db.Video.ID.Set(video.ID),
+		db.Video.CreatedAt.Set(video.CreatedAt),
+		db.Video.Public.Set(video.Public),
+		db.Video.Etag.Set(video.Etag),
+		db.Video.ExpiresAt.SetOptional(expiresAt),
+	).Exec(ctx)
+	return err
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minio/minio-go/v7"
+
+	"db"
+)
+
+// maxExpiresIn is the longest lifetime an ephemeral upload may be given
+const maxExpiresIn = 365 * 24 * time.Hour
+
+// uploadExpiry reads the optional expiresIn form field, a lifetime in seconds,
+// and returns when the upload expires. It returns nil for uploads kept until
+// they are deleted.
+func uploadExpiry(c *gin.Context, now time.Time) (*time.Time, error) {
+	value := c.PostForm("expiresIn")
+	if value == "" {
+		return nil, nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 1 || seconds > int64(maxExpiresIn/time.Second) {
+		return nil, errors.New("expiresIn must be a number of seconds between 1 and 31536000")
+	}
+	expiresAt := now.Add(time.Duration(seconds) * time.Second)
+	return &expiresAt, nil
+}
+
+// SweepExpiredUploads deletes expired uploads every interval until ctx is done.
+func (streaming *Streaming) SweepExpiredUploads(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if !streaming.Ready() {
+				continue
+			}
+			sweepCtx, cancel := context.WithTimeout(ctx, interval)
+			if removed, err := streaming.RemoveExpired(sweepCtx, now); err != nil {
+				log.Printf("Failed to sweep expired uploads (%d removed): %v\n", removed, err)
+			} else if removed > 0 {
+				log.Printf("Removed %d expired uploads\n", removed)
+			}
+			cancel()
+		}
+	}
+}
+
+// RemoveExpired deletes the objects and metadata of every upload that expired
+// before now and returns how many were removed. Each row is only deleted if it
+// is still expired and still describes the same object, and the object only
+// if it was not replaced since, so a video re-uploaded while the sweep runs is
+// kept.
+func (streaming *Streaming) RemoveExpired(ctx context.Context, now time.Time) (int, error) {
+	spanCtx, span := startSpan(ctx, "prisma.Video.FindMany")
+	expired, err := streaming.database.Video.FindMany(
+		db.Video.ExpiresAt.Lt(now),
+	).Exec(spanCtx)
+	endSpan(span, err)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	var errs []error
+	for _, video := range expired {
+		spanCtx, span := startSpan(ctx, "prisma.Video.DeleteMany")
+		deleted, err := streaming.database.Video.FindMany(
+			db.Video.ID.Equals(video.ID),
+			db.Video.ExpiresAt.Lt(now),
+			db.Video.Etag.Equals(video.Etag),
+		).Delete().Exec(spanCtx)
+		endSpan(span, err)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if deleted.Count == 0 {
+			// Re-uploaded or given a new lifetime since it was listed
+			continue
+		}
+		removed++
+
+		info, err := streaming.StatObject(ctx, bucketName, video.ObjectName, minio.StatObjectOptions{})
+		if isNoSuchKey(err) || err == nil && info.ETag != video.Etag {
+			continue
+		}
+		if err == nil {
+			err = streaming.DeleteVideo(ctx, video.ObjectName)
+		}
+		if err != nil && !isNoSuchKey(err) {
+			errs = append(errs, fmt.Errorf("removing object of expired video %s: %w", video.ObjectName, err))
+		}
+	}
+	return removed, errors.Join(errs...)
+}
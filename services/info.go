@@ -0,0 +1,43 @@
+package services
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"middlewares"
+)
+
+// VideoInfo returns the stored metadata of a single object without its content.
+func (streaming *Streaming) VideoInfo(c *gin.Context) {
+	objectName := c.Query("objectName")
+	if objectName == "" {
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, "missing 'objectName' parameter")
+		return
+	}
+
+	info, err := streaming.GetObjectInfo(c.Request.Context(), objectName)
+	if err != nil {
+		if isNoSuchKey(err) {
+			middlewares.RespondError(c, http.StatusNotFound, middlewares.CodeNotFound, "video not found")
+			return
+		}
+		if isNoSuchBucket(err) {
+			logMissingBucket(err)
+			middlewares.RespondError(c, http.StatusServiceUnavailable, middlewares.CodeUnavailable, "video storage is not available")
+			return
+		}
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "failed to retrieve object info")
+		return
+	}
+
+	contentType, _ := streaming.contentType(info.Key, info.ContentType)
+	c.JSON(http.StatusOK, gin.H{
+		"objectName":   info.Key,
+		"size":         info.Size,
+		"contentType":  contentType,
+		"lastModified": info.LastModified,
+		"etag":         info.ETag,
+		"metadata":     videoMetadata(info),
+	})
+}
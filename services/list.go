@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"db"
+	"middlewares"
+)
+
+// videoFilter holds the list filters both as Prisma filters, for fetching a
+// page, and as SQL conditions on "Video" v joined with "User" u, for counting
+// the matches, which prisma-client-go has no query for.
+type videoFilter struct {
+	params     []db.VideoWhereParam
+	conditions []string
+	args       []interface{}
+}
+
+// add adds a filter; condition refers to its argument as ?
+func (f *videoFilter) add(param db.VideoWhereParam, condition string, arg interface{}) {
+	f.params = append(f.params, param)
+	f.args = append(f.args, arg)
+	f.conditions = append(f.conditions, strings.Replace(condition, "?", "$"+strconv.Itoa(len(f.args)), 1))
+}
+
+// count returns the number of videos matching f
+func (f *videoFilter) count(ctx context.Context, database *db.PrismaClient) (int, error) {
+	ctx, span := startSpan(ctx, "prisma.QueryRaw")
+	var rows []struct {
+		Count int `json:"count"`
+	}
+	err := database.Prisma.QueryRaw(
+		`SELECT COUNT(*)::int AS "count" FROM "Video" v JOIN "User" u ON u."id" = v."uploaderId" WHERE `+strings.Join(f.conditions, " AND "),
+		f.args...,
+	).Exec(ctx, &rows)
+	endSpan(span, err)
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	return rows[0].Count, nil
+}
+
+// videoFilters translates the list query parameters into filters.
+func videoFilters(c *gin.Context) *videoFilter {
+	filter := &videoFilter{
+		// Videos of soft-deleted accounts stay stored but are hidden
+		params:     []db.VideoWhereParam{db.Video.Uploader.Where(db.User.DeletedAt.IsNull())},
+		conditions: []string{`u."deletedAt" IS NULL`},
+	}
+	if q := c.Query("q"); q != "" {
+		filter.add(db.Video.ObjectName.Contains(q), `strpos(v."objectName", ?) > 0`, q)
+	}
+	if uploader := c.Query("uploader"); uploader != "" {
+		filter.add(db.Video.Uploader.Where(db.User.Email.Equals(uploader)), `u."email" = ?`, uploader)
+	}
+	if contentType := c.Query("contentType"); contentType != "" {
+		filter.add(db.Video.ContentType.Equals(contentType), `v."contentType" = ?`, contentType)
+	}
+	return filter
+}
+
+// videoOrder translates the sort and order query parameters into a Prisma ordering.
+func videoOrder(c *gin.Context) (db.VideoOrderByParam, bool) {
+	var direction db.SortOrder
+	switch c.DefaultQuery("order", "desc") {
+	case "asc":
+		direction = db.SORT_ORDER_ASC
+	case "desc":
+		direction = db.SORT_ORDER_DESC
+	default:
+		return nil, false
+	}
+
+	switch c.DefaultQuery("sort", "uploadTime") {
+	case "uploadTime":
+		return db.Video.CreatedAt.Order(direction), true
+	case "size":
+		return db.Video.Size.Order(direction), true
+	default:
+		return nil, false
+	}
+}
+
+// videoETag returns the recorded ETag of video, falling back to MinIO (through
+// the stat cache) for videos recorded before ETags were stored. It is empty
+// when neither knows it.
+func (streaming *Streaming) videoETag(ctx context.Context, video db.VideoModel) string {
+	if video.Etag != "" || !streaming.Ready() {
+		return video.Etag
+	}
+	info, err := streaming.GetObjectInfo(ctx, video.ObjectName)
+	if err != nil {
+		return ""
+	}
+	return info.ETag
+}
+
+// ListVideos returns a page of stored videos together with pagination totals.
+// Results can be filtered by name substring (q), uploader email and content type,
+// and sorted by size or uploadTime. With per-user prefixes only the user's own
+// videos are listed.
+func (streaming *Streaming) ListVideos(c *gin.Context) {
+	page, pageSize, err := PageParams(c)
+	if err != nil {
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, err.Error())
+		return
+	}
+	order, ok := videoOrder(c)
+	if !ok {
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, "sort must be size or uploadTime and order asc or desc")
+		return
+	}
+	filter := videoFilters(c)
+	if streaming.userPrefixes {
+		prefix := userKeyPrefix(c.GetString("email"))
+		filter.add(db.Video.ObjectName.StartsWith(prefix), `strpos(v."objectName", ?) = 1`, prefix)
+	}
+
+	ctx := c.Request.Context()
+	var lastModified time.Time
+	response, err := Paginate(page, pageSize, func() (int, error) {
+		return filter.count(ctx, streaming.database)
+	}, func(skip, take int) ([]gin.H, error) {
+		ctx, span := startSpan(ctx, "prisma.Video.FindMany")
+		videos, err := streaming.database.Video.FindMany(filter.params...).
+			OrderBy(order).
+			Skip(skip).
+			Take(take).
+			Exec(ctx)
+		endSpan(span, err)
+		if err != nil {
+			return nil, err
+		}
+		items := make([]gin.H, 0, len(videos))
+		for _, video := range videos {
+			if video.UpdatedAt.After(lastModified) {
+				lastModified = video.UpdatedAt
+			}
+			contentType, _ := streaming.contentType(video.ObjectName, video.ContentType)
+			items = append(items, gin.H{
+				"objectName":  video.ObjectName,
+				"size":        video.Size,
+				"contentType": contentType,
+				"uploadTime":  video.CreatedAt,
+				"public":      video.Public,
+				"etag":        streaming.videoETag(ctx, video),
+			})
+		}
+		return items, nil
+	})
+	if err != nil {
+		log.Printf("Failed to list videos: %v\n", err)
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not list videos")
+		return
+	}
+
+	respondJSONCached(c, response, lastModified)
+}
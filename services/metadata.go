@@ -0,0 +1,77 @@
+package services
+
+import (
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	// maxMetadataBytes is S3's limit on the user metadata of an object
+	maxMetadataBytes = 2048
+	maxTitleLength   = 256
+	// maxDescriptionLength leaves room for the other fields within maxMetadataBytes
+	maxDescriptionLength = 1024
+)
+
+// metadataFields maps the upload form fields to the MinIO user metadata keys
+// they are stored under, with the longest value each accepts.
+var metadataFields = []struct {
+	form, key string
+	maxLength int
+}{
+	{"title", "Title", maxTitleLength},
+	{"description", "Description", maxDescriptionLength},
+	{"duration", "Duration", 32},
+}
+
+// uploadMetadata reads the optional title, description and duration form
+// fields into MinIO user metadata. duration is in seconds. Values outside
+// ASCII are stored RFC 2047 encoded, as HTTP headers require.
+func uploadMetadata(form func(string) string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	size := 0
+	for _, field := range metadataFields {
+		value := strings.TrimSpace(form(field.form))
+		if value == "" {
+			continue
+		}
+		if !utf8.ValidString(value) || utf8.RuneCountInString(value) > field.maxLength {
+			return nil, fmt.Errorf("%s must be at most %d characters", field.form, field.maxLength)
+		}
+		if field.form == "duration" {
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds < 0 {
+				return nil, fmt.Errorf("duration must be a non-negative number of seconds")
+			}
+		}
+		encoded := mime.QEncoding.Encode("UTF-8", value)
+		metadata[field.key] = encoded
+		size += len("x-amz-meta-"+field.key) + len(encoded)
+	}
+	if size > maxMetadataBytes {
+		return nil, fmt.Errorf("metadata must not exceed %d bytes once encoded", maxMetadataBytes)
+	}
+	return metadata, nil
+}
+
+// videoMetadata returns the metadata given at upload, by form field name.
+func videoMetadata(info *minio.ObjectInfo) map[string]string {
+	metadata := make(map[string]string)
+	decoder := mime.WordDecoder{}
+	for _, field := range metadataFields {
+		value, ok := info.UserMetadata[field.key]
+		if !ok {
+			continue
+		}
+		if decoded, err := decoder.DecodeHeader(value); err == nil {
+			value = decoded
+		}
+		metadata[field.form] = value
+	}
+	return metadata
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// formOf returns a form lookup over fields
+func formOf(fields map[string]string) func(string) string {
+	return func(name string) string { return fields[name] }
+}
+
+func TestUploadMetadataRoundTrips(t *testing.T) {
+	fields := map[string]string{
+		"title":       "Café tour ",
+		"description": "Walking through the old town",
+		"duration":    "12.5",
+	}
+	metadata, err := uploadMetadata(formOf(fields))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range metadata {
+		for _, r := range value {
+			if r > 127 {
+				t.Fatalf("%s stored as %q, which is not valid in a header", key, value)
+			}
+		}
+	}
+
+	got := videoMetadata(&minio.ObjectInfo{UserMetadata: metadata})
+	want := map[string]string{"title": "Café tour", "description": "Walking through the old town", "duration": "12.5"}
+	if !maps.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// Fields left out are not stored
+	metadata, err = uploadMetadata(formOf(map[string]string{"title": "Only a title"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := videoMetadata(&minio.ObjectInfo{UserMetadata: metadata}); !maps.Equal(got, map[string]string{"title": "Only a title"}) {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestUploadMetadataLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]string
+	}{
+		{"long title", map[string]string{"title": strings.Repeat("t", maxTitleLength+1)}},
+		{"long description", map[string]string{"description": strings.Repeat("d", maxDescriptionLength+1)}},
+		{"invalid UTF-8", map[string]string{"title": "bad \xff"}},
+		{"duration that is no number", map[string]string{"duration": "ten minutes"}},
+		{"negative duration", map[string]string{"duration": "-1"}},
+		// Within each field's limit, but past S3's once encoded
+		{"too large encoded", map[string]string{
+			"title":       strings.Repeat("é", maxTitleLength),
+			"description": strings.Repeat("é", maxDescriptionLength),
+		}},
+	}
+	for _, tt := range tests {
+		if _, err := uploadMetadata(formOf(tt.fields)); err == nil {
+			t.Errorf("%s: accepted", tt.name)
+		}
+	}
+
+	fields := map[string]string{"title": strings.Repeat("t", maxTitleLength), "description": strings.Repeat("d", maxDescriptionLength)}
+	if _, err := uploadMetadata(formOf(fields)); err != nil {
+		t.Fatalf("fields at their limits: %v", err)
+	}
+}
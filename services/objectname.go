@@ -0,0 +1,56 @@
+package services
+
+import (
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// maxObjectNameLength keeps object keys well under S3's 1024 byte limit
+const maxObjectNameLength = 255
+
+var errInvalidObjectName = errors.New("objectName may only contain letters, digits, '.', '-', '_' and '/' separated path segments")
+
+// validObjectNameChar reports whether r may appear in an object name
+func validObjectNameChar(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+		r == '.' || r == '-' || r == '_' || r == '/'
+}
+
+// validateObjectName checks a client-chosen object name, rejecting anything
+// that is not a plain relative path of safe characters.
+func validateObjectName(name string) error {
+	if name == "" || len(name) > maxObjectNameLength || strings.IndexFunc(name, func(r rune) bool { return !validObjectNameChar(r) }) >= 0 {
+		return errInvalidObjectName
+	}
+	if strings.HasPrefix(name, "/") || path.Clean(name) != name {
+		return errInvalidObjectName
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "." || segment == ".." {
+			return errInvalidObjectName
+		}
+	}
+	return nil
+}
+
+// defaultObjectName derives a collision-free key from an uploaded file name by
+// prefixing a UUID to its sanitized base name.
+func defaultObjectName(filename string) string {
+	base := strings.Map(func(r rune) rune {
+		if r == '/' || !validObjectNameChar(r) {
+			return '_'
+		}
+		return r
+	}, path.Base(filename))
+	if base == "." || base == ".." {
+		base = "upload"
+	}
+	name := uuid.NewString() + "-" + base
+	if len(name) > maxObjectNameLength {
+		name = name[:maxObjectNameLength]
+	}
+	return name
+}
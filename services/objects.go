@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minio/minio-go/v7"
+
+	"middlewares"
+)
+
+// encodeCursor turns the last object name of a page into an opaque cursor.
+func encodeCursor(objectName string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(objectName))
+}
+
+// decodeCursor returns the object name a cursor continues after. An empty
+// cursor starts from the beginning of the bucket.
+func decodeCursor(cursor string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+	name, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(name) == 0 {
+		return "", errors.New("invalid cursor")
+	}
+	return string(name), nil
+}
+
+// listObjectsPage lists up to limit objects after startAfter that match tag
+// and, unless owned is nil, are in owned. more reports whether objects remain
+// past the page.
+func (streaming *Streaming) listObjectsPage(ctx context.Context, prefix, startAfter string, tag *tagFilter, owned map[string]bool, limit int) (objects []minio.ObjectInfo, more bool, err error) {
+	ctx, span := startSpan(ctx, "minio.ListObjects")
+	defer func() { endSpan(span, err) }()
+
+	// Stop MinIO's listing goroutine once the page is full
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for object := range streaming.Client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
+		Prefix:     prefix,
+		StartAfter: startAfter,
+		Recursive:  true,
+		// One extra key tells whether another page follows
+		MaxKeys: limit + 1,
+		// Tags come back with the listing, so filtering needs no request per object
+		WithMetadata: tag != nil,
+	}) {
+		if object.Err != nil {
+			return nil, false, object.Err
+		}
+		if !tag.matches(object.UserTags) || (owned != nil && !owned[object.Key]) {
+			continue
+		}
+		if len(objects) == limit {
+			return objects, true, nil
+		}
+		objects = append(objects, object)
+	}
+	return objects, false, nil
+}
+
+// ListObjects pages through the bucket in key order using MinIO's own
+// continuation, which stays fast on buckets too large for offset paging. The
+// response carries nextCursor while more objects remain; pass it back as the
+// cursor query parameter to fetch the next page. prefix narrows the listing,
+// and tag, as "key" or "key=value", keeps only objects carrying that tag.
+// Only the authenticated user's objects are listed: with per-user prefixes the
+// listing stays within the user's prefix, otherwise it skips keys the user
+// did not upload.
+func (streaming *Streaming) ListObjects(c *gin.Context) {
+	startAfter, err := decodeCursor(c.Query("cursor"))
+	if err != nil {
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, err.Error())
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", strconv.Itoa(defaultPageSize)))
+	if err != nil || pageSize < 1 {
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, "pageSize must be a positive integer")
+		return
+	}
+	pageSize = min(pageSize, maxPageSize)
+	tag, err := parseTagFilter(c.Query("tag"))
+	if err != nil {
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	prefix := c.Query("prefix")
+	if streaming.userPrefixes {
+		prefix = streaming.scopedKey(c, prefix)
+	}
+	owned, err := streaming.ownedKeys(c)
+	if err != nil {
+		log.Printf("Failed to look up videos: %v\n", err)
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not list objects")
+		return
+	}
+
+	objects, more, err := streaming.listObjectsPage(c.Request.Context(), prefix, startAfter, tag, owned, pageSize)
+	if err != nil {
+		log.Printf("Failed to list objects: %v\n", err)
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not list objects")
+		return
+	}
+
+	var lastModified time.Time
+	items := make([]gin.H, 0, len(objects))
+	for _, object := range objects {
+		if object.LastModified.After(lastModified) {
+			lastModified = object.LastModified
+		}
+		items = append(items, objectJSON(object, tag != nil))
+	}
+	response := gin.H{"items": items}
+	if more {
+		response["nextCursor"] = encodeCursor(objects[len(objects)-1].Key)
+	}
+	respondJSONCached(c, response, lastModified)
+}
+
+// objectJSON is the listing entry of an object, with its tags when the listing is filtered by tag.
+func objectJSON(object minio.ObjectInfo, withTags bool) gin.H {
+	item := gin.H{
+		"objectName":   object.Key,
+		"size":         object.Size,
+		"etag":         object.ETag,
+		"lastModified": object.LastModified,
+	}
+	if withTags {
+		item["tags"] = object.UserTags
+	}
+	return item
+}
+
+// streamFlushEvery is how many objects a streamed listing writes between flushes
+const streamFlushEvery = 500
+
+// StreamObjects sends every object under prefix as one JSON array, encoding
+// each object as MinIO lists it rather than holding the listing in memory, so
+// it suits buckets too large to page through. It takes the same prefix and tag
+// parameters as ListObjects and lists only the user's objects in the same way. Once the first byte is sent the status cannot
+// change, so an error partway through ends the response without the closing
+// bracket: the body is then invalid JSON, which clients cannot mistake for a
+// complete listing.
+func (streaming *Streaming) StreamObjects(c *gin.Context) {
+	tag, err := parseTagFilter(c.Query("tag"))
+	if err != nil {
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, err.Error())
+		return
+	}
+	prefix := c.Query("prefix")
+	if streaming.userPrefixes {
+		prefix = streaming.scopedKey(c, prefix)
+	}
+	owned, err := streaming.ownedKeys(c)
+	if err != nil {
+		log.Printf("Failed to look up videos: %v\n", err)
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not list objects")
+		return
+	}
+
+	ctx, span := startSpan(c.Request.Context(), "minio.ListObjects")
+	var listErr error
+	defer func() { endSpan(span, listErr) }()
+	// Stop MinIO's listing goroutine if the client goes away
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	objects := streaming.Client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
+		Prefix:       prefix,
+		Recursive:    true,
+		WithMetadata: tag != nil,
+	})
+	// Errors before the first object can still be answered properly
+	first, ok := <-objects
+	if ok && first.Err != nil {
+		listErr = first.Err
+		log.Printf("Failed to list objects: %v\n", listErr)
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not list objects")
+		return
+	}
+
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Status(http.StatusOK)
+	w := c.Writer
+	encoder := json.NewEncoder(w)
+	if _, err := w.WriteString("["); err != nil {
+		return
+	}
+	written := 0
+	for object := first; ok; object, ok = <-objects {
+		if object.Err != nil {
+			listErr = object.Err
+			log.Printf("Listing failed after %d objects: %v\n", written, listErr)
+			return
+		}
+		if !tag.matches(object.UserTags) || (owned != nil && !owned[object.Key]) {
+			continue
+		}
+		if written > 0 {
+			if _, err := w.WriteString(","); err != nil {
+				return
+			}
+		}
+		if err := encoder.Encode(objectJSON(object, tag != nil)); err != nil {
+			return
+		}
+		written++
+		if written%streamFlushEvery == 0 {
+			w.Flush()
+		}
+	}
+	w.WriteString("]")
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// PageParams reads the page and pageSize query parameters, defaulting to the
+// first page of defaultPageSize items. Non-numeric or non-positive values are an error.
+func PageParams(c *gin.Context) (page, pageSize int, err error) {
+	page, err = strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		return 0, 0, errors.New("page must be a positive integer")
+	}
+	pageSize, err = strconv.Atoi(c.DefaultQuery("pageSize", strconv.Itoa(defaultPageSize)))
+	if err != nil || pageSize < 1 {
+		return 0, 0, errors.New("pageSize must be a positive integer")
+	}
+	return page, pageSize, nil
+}
+
+// Paginate fetches one page of a listing and wraps it in the standard envelope
+// of items, page, pageSize, total and totalPages. page is raised to at least 1
+// and pageSize kept between 1 and maxPageSize. count returns the number of
+// matching rows, with a COUNT query rather than by loading them; fetch loads a
+// page and is meant to pass skip and take straight to Prisma's Skip and Take.
+func Paginate[T any](page, pageSize int, count func() (int, error), fetch func(skip, take int) ([]T, error)) (gin.H, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 1
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	total, err := count()
+	if err != nil {
+		return nil, err
+	}
+	items, err := fetch((page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []T{}
+	}
+
+	return gin.H{
+		"items":      items,
+		"page":       page,
+		"pageSize":   pageSize,
+		"total":      total,
+		"totalPages": (total + pageSize - 1) / pageSize,
+	}, nil
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPaginate(t *testing.T) {
+	rows := []int{1, 2, 3, 4, 5}
+	count := func() (int, error) { return len(rows), nil }
+	fetch := func(skip, take int) ([]int, error) {
+		return rows[min(skip, len(rows)):min(skip+take, len(rows))], nil
+	}
+
+	tests := []struct {
+		page, pageSize int
+		want           []int
+		wantPage       int
+		totalPages     int
+	}{
+		{1, 2, []int{1, 2}, 1, 3},
+		{3, 2, []int{5}, 3, 3},
+		{4, 2, []int{}, 4, 3},
+		// Out of range parameters are clamped
+		{0, 0, []int{1}, 1, 5},
+	}
+	for _, tt := range tests {
+		response, err := Paginate(tt.page, tt.pageSize, count, fetch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		items := response["items"].([]int)
+		if len(items) != len(tt.want) || response["page"] != tt.wantPage ||
+			response["total"] != len(rows) || response["totalPages"] != tt.totalPages {
+			t.Fatalf("page %d of %d: got %v", tt.page, tt.pageSize, response)
+		}
+		for i := range items {
+			if items[i] != tt.want[i] {
+				t.Fatalf("page %d of %d: items %v, want %v", tt.page, tt.pageSize, items, tt.want)
+			}
+		}
+	}
+}
+
+func TestPaginateCountError(t *testing.T) {
+	failed := errors.New("count failed")
+	_, err := Paginate(1, 10, func() (int, error) { return 0, failed }, func(skip, take int) ([]int, error) {
+		t.Fatal("fetched a page after the count failed")
+		return nil, nil
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("got %v, want the count error", err)
+	}
+}
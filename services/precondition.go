@@ -0,0 +1,46 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minio/minio-go/v7"
+)
+
+// ifMatchETag enforces an If-Match header against the object's current ETag.
+// ok is true when no If-Match was sent, with an empty etag; otherwise etag is
+// the ETag that matched, for the write to be made conditional on.
+func (streaming *Streaming) ifMatchETag(c *gin.Context, objectName string) (etag string, ok bool) {
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" {
+		return "", true
+	}
+
+	// Preconditions always check MinIO, refreshing the cache if the ETag moved on
+	info, err := streaming.StatObject(c.Request.Context(), bucketName, objectName, minio.StatObjectOptions{})
+	if err == nil {
+		streaming.stats.put(objectName, info, time.Now())
+	}
+	// A missing object cannot satisfy any If-Match, including "*"
+	if err != nil || !etagMatches(ifMatch, info.ETag) {
+		return "", false
+	}
+	return info.ETag, true
+}
+
+// isPreconditionFailed reports whether MinIO refused a conditional write
+func isPreconditionFailed(err error) bool {
+	return err != nil && minio.ToErrorResponse(err).Code == minio.PreconditionFailed
+}
+
+// etagMatches reports whether an If-Match header value matches etag.
+func etagMatches(ifMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.Trim(candidate, `"`) == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"middlewares"
+)
+
+var upgrader = websocket.Upgrader{}
+
+// progressHub fans out upload progress percentages to websocket subscribers
+type progressHub struct {
+	mu          sync.Mutex
+	subscribers map[string][]chan int
+}
+
+func newProgressHub() *progressHub {
+	return &progressHub{subscribers: make(map[string][]chan int)}
+}
+
+// subscribe registers for updates on key; the returned func unsubscribes.
+func (h *progressHub) subscribe(key string) (<-chan int, func()) {
+	ch := make(chan int, 1)
+	h.mu.Lock()
+	h.subscribers[key] = append(h.subscribers[key], ch)
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		subs := h.subscribers[key]
+		for i, sub := range subs {
+			if sub == ch {
+				h.subscribers[key] = append(subs[:i], subs[i+1:]...)
+				close(ch)
+				break
+			}
+		}
+		if len(h.subscribers[key]) == 0 {
+			delete(h.subscribers, key)
+		}
+	}
+}
+
+// publish sends percent to every subscriber of key, replacing any update a
+// slow subscriber has not consumed yet so the upload never blocks.
+func (h *progressHub) publish(key string, percent int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ch := range h.subscribers[key] {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- percent
+	}
+}
+
+// progressReader reports how much of a request body has been read
+type progressReader struct {
+	io.ReadCloser
+	total   int64
+	read    int64
+	percent int
+	report  func(int)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.read += int64(n)
+	if r.total > 0 {
+		if percent := int(r.read * 100 / r.total); percent != r.percent {
+			r.percent = percent
+			r.report(percent)
+		}
+	}
+	return n, err
+}
+
+// progressKey scopes an upload ID to the authenticated user.
+func progressKey(c *gin.Context, uploadID string) string {
+	return c.GetString("email") + "/" + uploadID
+}
+
+// trackProgress wraps the request body so reads are published under the
+// client-chosen uploadId query parameter, if one was sent.
+func (streaming *Streaming) trackProgress(c *gin.Context) {
+	uploadID := c.Query("uploadId")
+	if uploadID == "" {
+		return
+	}
+	key := progressKey(c, uploadID)
+	c.Request.Body = &progressReader{
+		ReadCloser: c.Request.Body,
+		total:      c.Request.ContentLength,
+		report: func(percent int) {
+			streaming.progress.publish(key, percent)
+		},
+	}
+}
+
+// UploadProgress upgrades to a websocket that streams {"uploadId","percent"}
+// messages for the upload started with the same uploadId, closing at 100%.
+func (streaming *Streaming) UploadProgress(c *gin.Context) {
+	uploadID := c.Query("uploadId")
+	if uploadID == "" {
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, "missing 'uploadId' parameter")
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	updates, unsubscribe := streaming.progress.subscribe(progressKey(c, uploadID))
+	defer unsubscribe()
+
+	// Drain client frames so a closed connection is noticed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case percent := <-updates:
+			if err := conn.WriteJSON(gin.H{"uploadId": uploadID, "percent": percent}); err != nil {
+				return
+			}
+			if percent >= 100 {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+func TestProgressReaderReportsPercent(t *testing.T) {
+	var reported []int
+	reader := &progressReader{
+		ReadCloser: io.NopCloser(strings.NewReader(strings.Repeat("x", 100))),
+		total:      100,
+		report:     func(percent int) { reported = append(reported, percent) },
+	}
+	buf := make([]byte, 25)
+	for {
+		if _, err := reader.Read(buf); err != nil {
+			break
+		}
+	}
+	if want := []int{25, 50, 75, 100}; !slices.Equal(reported, want) {
+		t.Fatalf("reported %v, want %v", reported, want)
+	}
+}
+
+func TestUploadProgressWebsocket(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	streaming := &Streaming{progress: newProgressHub()}
+	r := gin.New()
+	r.GET("/progress", func(c *gin.Context) {
+		c.Set("email", "user@example.com")
+	}, streaming.UploadProgress)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/progress?uploadId=u1"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	key := "user@example.com/u1"
+	deadline := time.Now().Add(5 * time.Second)
+	for !subscribed(streaming.progress, key) {
+		if time.Now().After(deadline) {
+			t.Fatal("websocket never subscribed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Another user's upload with the same ID is not reported
+	streaming.progress.publish("other@example.com/u1", 10)
+
+	for _, percent := range []int{50, 100} {
+		streaming.progress.publish(key, percent)
+		var update struct {
+			UploadID string `json:"uploadId"`
+			Percent  int    `json:"percent"`
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.ReadJSON(&update); err != nil {
+			t.Fatal(err)
+		}
+		if update.UploadID != "u1" || update.Percent != percent {
+			t.Fatalf("got %+v, want %d%%", update, percent)
+		}
+	}
+	// The socket closes once the upload is complete
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Fatalf("got %v, want a normal close", err)
+	}
+
+	resp, err := http.Get(server.URL + "/progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("without uploadId: got %d", resp.StatusCode)
+	}
+}
+
+// subscribed reports whether anyone listens for key
+func subscribed(h *progressHub, key string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers[key]) > 0
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"db"
+	"middlewares"
+)
+
+// PublicStream streams a video without authentication, but only if it is
+// marked public and its uploader's account is active. Anything else is
+// reported as not found so private object names are not disclosed.
+func (streaming *Streaming) PublicStream(c *gin.Context) {
+	objectName := c.Query("objectName")
+	if objectName == "" {
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, "missing 'objectName' parameter")
+		return
+	}
+
+	ctx, span := startSpan(c.Request.Context(), "prisma.Video.FindFirst")
+	_, err := streaming.database.Video.FindFirst(
+		db.Video.ObjectName.Equals(objectName),
+		db.Video.Public.Equals(true),
+		db.Video.Uploader.Where(db.User.DeletedAt.IsNull()),
+	).Exec(ctx)
+	endSpan(span, err)
+	if errors.Is(err, db.ErrNotFound) {
+		middlewares.RespondError(c, http.StatusNotFound, middlewares.CodeNotFound, "video not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to look up video '%s': %v\n", objectName, err)
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not stream video")
+		return
+	}
+
+	streaming.Stream(c.Writer, c.Request)
+}
+
+// SetVisibility marks one of the authenticated user's videos public or private.
+func (streaming *Streaming) SetVisibility(c *gin.Context) {
+	var req struct {
+		ObjectName string `json:"objectName" binding:"required"`
+		Public     *bool  `json:"public" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middlewares.RespondBindError(c, err)
+		return
+	}
+
+	video, err := streaming.ownedVideo(c, req.ObjectName)
+	if errors.Is(err, db.ErrNotFound) {
+		middlewares.RespondError(c, http.StatusNotFound, middlewares.CodeNotFound, "video not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to look up video '%s': %v\n", req.ObjectName, err)
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not update video")
+		return
+	}
+
+	_, err = streaming.database.Video.FindUnique(
+		db.Video.ID.Equals(video.ID),
+	).Update(
+		db.Video.Public.Set(*req.Public),
+	).Exec(c.Request.Context())
+	if err != nil {
+		log.Printf("Failed to update visibility of '%s': %v\n", req.ObjectName, err)
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not update video")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"objectName": req.ObjectName, "public": *req.Public})
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"db"
+)
+
+// reserveQuota rejects an upload of size bytes under objectName if it would
+// take the authenticated user past their quota. Replacing one of their own
+// objects only counts the difference. Otherwise the bytes stay reserved until
+// release is called, which must be after the upload is recorded, so concurrent
+// uploads cannot each fit the quota alone and exceed it together.
+func (streaming *Streaming) reserveQuota(c *gin.Context, objectName string, size int64) (release func(), uploadErr *uploadError) {
+	ctx := c.Request.Context()
+	email := c.GetString("email")
+	release = func() {}
+
+	spanCtx, span := startSpan(ctx, "prisma.User.FindUnique")
+	user, err := streaming.database.User.FindUnique(db.User.Email.Equals(email)).Exec(spanCtx)
+	endSpan(span, err)
+	if err != nil {
+		log.Printf("Failed to look up quota for %s: %v\n", email, err)
+		return release, &uploadError{http.StatusInternalServerError, "upload failed"}
+	}
+	limit := streaming.quotaLimit(user)
+	if limit == 0 {
+		return release, nil
+	}
+
+	reservation := streaming.reservations.acquire(user.ID)
+	reservation.Lock()
+	defer reservation.Unlock()
+
+	// Usage is read under the lock, so an upload finishing meanwhile is seen
+	// either as a stored video or as a reservation, never as neither
+	used, err := streaming.quotaUsed(ctx, user, objectName)
+	if err != nil {
+		log.Printf("Failed to compute usage for %s: %v\n", email, err)
+		streaming.reservations.drop(user.ID)
+		return release, &uploadError{http.StatusInternalServerError, "upload failed"}
+	}
+	used += reservation.bytes
+
+	if used+size > limit {
+		streaming.reservations.drop(user.ID)
+		return release, &uploadError{http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("upload quota exceeded: %d of %d bytes used, file is %d bytes", used, limit, size)}
+	}
+	reservation.bytes += size
+	return func() {
+		reservation.Lock()
+		reservation.bytes -= size
+		reservation.Unlock()
+		streaming.reservations.drop(user.ID)
+	}, nil
+}
+
+// quotaReservations holds the bytes of each user's uploads in progress
+type quotaReservations struct {
+	mu    sync.Mutex
+	users map[string]*quotaReservation
+}
+
+// quotaReservation is one user's reserved bytes. Its lock is held while the
+// quota is checked.
+type quotaReservation struct {
+	sync.Mutex
+	bytes int64
+	// holders counts the uploads using the entry, which is removed at zero
+	holders int
+}
+
+// acquire returns userID's reservation, creating it if needed; drop releases it
+func (r *quotaReservations) acquire(userID string) *quotaReservation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.users == nil {
+		r.users = make(map[string]*quotaReservation)
+	}
+	reservation, ok := r.users[userID]
+	if !ok {
+		reservation = &quotaReservation{}
+		r.users[userID] = reservation
+	}
+	reservation.holders++
+	return reservation
+}
+
+func (r *quotaReservations) drop(userID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if reservation := r.users[userID]; reservation != nil {
+		reservation.holders--
+		if reservation.holders == 0 {
+			delete(r.users, userID)
+		}
+	}
+}
+
+// QuotaUsage returns the bytes user has stored and their quota in bytes,
+// which is zero when unlimited.
+func (streaming *Streaming) QuotaUsage(ctx context.Context, user *db.UserModel) (used, limit int64, err error) {
+	used, err = streaming.quotaUsed(ctx, user, "")
+	return used, streaming.quotaLimit(user), err
+}
+
+// quotaLimit is user's quota in bytes: their own override if set, else the
+// default. Zero is unlimited.
+func (streaming *Streaming) quotaLimit(user *db.UserModel) int64 {
+	limitMB := streaming.quotaMB
+	if override, ok := user.UploadQuotaMB(); ok {
+		limitMB = override
+	}
+	if limitMB <= 0 {
+		return 0
+	}
+	return int64(limitMB) << 20
+}
+
+// quotaUsed sums the size of user's videos in the database, leaving out except.
+func (streaming *Streaming) quotaUsed(ctx context.Context, user *db.UserModel, except string) (int64, error) {
+	ctx, span := startSpan(ctx, "prisma.QueryRaw")
+	// float8 decodes as a plain JSON number, unlike SUM's bigint, and is exact
+	// far beyond any quota
+	var rows []struct {
+		Used float64 `json:"used"`
+	}
+	err := streaming.database.Prisma.QueryRaw(
+		`SELECT COALESCE(SUM("size"), 0)::float8 AS "used" FROM "Video" WHERE "uploaderId" = $1 AND "objectName" <> $2`,
+		user.ID, except,
+	).Exec(ctx, &rows)
+	endSpan(span, err)
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	return int64(rows[0].Used), nil
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"db"
+	"middlewares"
+)
+
+// RenameVideo moves one of the authenticated user's videos to a new name.
+// MinIO has no rename, so the object is copied and the original removed; if
+// any step after the copy fails, the copy and metadata change are rolled back
+// so the client sees either the old name or the new one, never both or neither.
+func (streaming *Streaming) RenameVideo(c *gin.Context) {
+	var req struct {
+		From string `json:"from" binding:"required"`
+		To   string `json:"to" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middlewares.RespondBindError(c, err)
+		return
+	}
+	if err := validateObjectName(req.To); err != nil {
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, err.Error())
+		return
+	}
+	req.To = streaming.scopedKey(c, req.To)
+
+	video, err := streaming.ownedVideo(c, req.From)
+	if errors.Is(err, db.ErrNotFound) {
+		middlewares.RespondError(c, http.StatusNotFound, middlewares.CodeNotFound, "video not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to look up video '%s': %v\n", req.From, err)
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not rename video")
+		return
+	}
+
+	taken, err := streaming.nameTaken(c, req.To)
+	if err != nil {
+		log.Printf("Failed to check name '%s': %v\n", req.To, err)
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not rename video")
+		return
+	}
+	if taken {
+		middlewares.RespondError(c, http.StatusConflict, middlewares.CodeConflict, "destination name already exists")
+		return
+	}
+
+	ctx := c.Request.Context()
+	copied, err := streaming.copyToFreeName(ctx, req.From, req.To)
+	streaming.stats.invalidate(req.To)
+	// Someone else took the name since it was checked
+	if isPreconditionFailed(err) {
+		middlewares.RespondError(c, http.StatusConflict, middlewares.CodeConflict, "destination name already exists")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to copy '%s' to '%s': %v\n", req.From, req.To, err)
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not rename video")
+		return
+	}
+
+	// rollback removes the copy so a failed rename leaves only the original
+	rollback := func() {
+		if err := streaming.DeleteVideo(ctx, req.To); err != nil {
+			log.Printf("Failed to roll back copy '%s': %v\n", req.To, err)
+		}
+	}
+
+	_, err = streaming.database.Video.FindUnique(
+		db.Video.ID.Equals(video.ID),
+	).Update(
+		db.Video.ObjectName.Set(req.To),
+		db.Video.Etag.Set(copied.ETag),
+	).Exec(ctx)
+	if err != nil {
+		log.Printf("Failed to rename metadata '%s': %v\n", req.From, err)
+		rollback()
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not rename video")
+		return
+	}
+
+	if err := streaming.DeleteVideo(ctx, req.From); err != nil {
+		log.Printf("Failed to remove '%s' after copy: %v\n", req.From, err)
+		_, err = streaming.database.Video.FindUnique(
+			db.Video.ID.Equals(video.ID),
+		).Update(
+			db.Video.ObjectName.Set(req.From),
+		).Exec(ctx)
+		if err != nil {
+			log.Printf("Failed to restore metadata '%s': %v\n", req.From, err)
+		}
+		rollback()
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not rename video")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "rename successful",
+		"objectName": req.To,
+	})
+}
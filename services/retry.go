@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// retryBaseDelay is the wait before the first retry of a MinIO call; it
+// doubles after every attempt
+const retryBaseDelay = 100 * time.Millisecond
+
+// isRetryable reports whether a MinIO error may go away on its own: network
+// failures and 5xx answers. Missing objects, failed preconditions and
+// cancelled requests are final.
+func isRetryable(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	resp := minio.ToErrorResponse(err)
+	if resp.StatusCode == 0 {
+		// No answer from MinIO at all, unless the client rejected the call itself
+		return resp.Code == ""
+	}
+	return resp.StatusCode >= 500
+}
+
+// withRetry runs fn up to MINIO_RETRY_ATTEMPTS times, backing off between
+// attempts for as long as it fails with a retryable error. fn must not have
+// written anything to the client, since a retry would repeat it.
+func (streaming *Streaming) withRetry(ctx context.Context, op string, fn func() error) error {
+	delay := retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if attempt >= streaming.retryAttempts || !isRetryable(ctx, err) {
+			return err
+		}
+		log.Printf("%s failed (attempt %d of %d), retrying in %v: %v\n", op, attempt, streaming.retryAttempts, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+
+	"config"
+)
+
+func TestIsRetryable(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"no error", context.Background(), nil, false},
+		{"network failure", context.Background(), errors.New("connection reset by peer"), true},
+		{"server error", context.Background(), minio.ErrorResponse{StatusCode: http.StatusServiceUnavailable, Code: "SlowDown"}, true},
+		{"missing object", context.Background(), minio.ErrorResponse{StatusCode: http.StatusNotFound, Code: "NoSuchKey"}, false},
+		{"changed object", context.Background(), minio.ErrorResponse{StatusCode: http.StatusPreconditionFailed, Code: "PreconditionFailed"}, false},
+		{"rejected by the client", context.Background(), minio.ErrorResponse{Code: "InvalidArgument"}, false},
+		{"cancelled request", cancelled, errors.New("connection reset by peer"), false},
+		{"deadline", context.Background(), context.DeadlineExceeded, false},
+	}
+	for _, tt := range tests {
+		if got := isRetryable(tt.ctx, tt.err); got != tt.want {
+			t.Errorf("%s: isRetryable is %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// flakyMinIO is fakeMinIO answering 503 to the requests, numbered from 1 in
+// the order they arrive, that fail picks. Every request is counted in requests.
+func flakyMinIO(t *testing.T, content map[string]string, fail func(n int64) bool, requests *atomic.Int64) *minio.Client {
+	t.Helper()
+	objects := objectHandler(content, nil)
+	return minioClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail(requests.Add(1)) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		objects.ServeHTTP(w, r)
+	}))
+}
+
+// retryingStreaming returns a Streaming trying MinIO reads attempts times
+func retryingStreaming(client *minio.Client, attempts int) *Streaming {
+	cfg := &config.Config{}
+	cfg.Upload.MaxConcurrent = 1
+	cfg.MinIO.RetryAttempts = attempts
+	return NewStreamingWithClient(nil, cfg, client)
+}
+
+func TestStreamRetriesTransientFailures(t *testing.T) {
+	const video = "0123456789"
+	tests := []struct {
+		name     string
+		object   string
+		fail     func(n int64) bool
+		status   int
+		requests int64
+	}{
+		// The stat and then the read each fail once before going through
+		{"recovering storage", "video.mp4", func(n int64) bool { return n == 1 || n == 3 }, http.StatusPartialContent, 4},
+		{"missing object", "missing.mp4", func(int64) bool { return false }, http.StatusNotFound, 1},
+		{"storage down", "video.mp4", func(int64) bool { return true }, http.StatusInternalServerError, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int64
+			streaming := retryingStreaming(flakyMinIO(t, map[string]string{"video.mp4": video}, tt.fail, &requests), 3)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/video?objectName="+tt.object, nil)
+			req.Header.Set("Range", "bytes=2-5")
+			w := httptest.NewRecorder()
+			streaming.Stream(w, req)
+			if w.Code != tt.status {
+				t.Fatalf("got %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusPartialContent && w.Body.String() != video[2:6] {
+				t.Fatalf("got body %q, want %q", w.Body.String(), video[2:6])
+			}
+			if got := requests.Load(); got != tt.requests {
+				t.Fatalf("%d requests to MinIO, want %d", got, tt.requests)
+			}
+		})
+	}
+}
+
+func TestStreamIsNotRetriedOnceBytesAreSent(t *testing.T) {
+	// Large enough to be streamed rather than read in one piece
+	video := strings.Repeat("v", 2*maxSharedRange)
+	var gets atomic.Int64
+	client := truncatingMinIO(t, video, &gets)
+	streaming := retryingStreaming(client, 3)
+
+	w := httptest.NewRecorder()
+	func() {
+		defer func() {
+			if recovered := recover(); recovered != http.ErrAbortHandler {
+				t.Fatalf("stream ended with %v, want the connection aborted", recovered)
+			}
+		}()
+		streaming.Stream(w, httptest.NewRequest(http.MethodGet, "/api/video?objectName=video.mp4", nil))
+	}()
+	if w.Body.Len() == 0 || w.Body.Len() >= len(video) {
+		t.Fatalf("sent %d of %d bytes, want part of the object", w.Body.Len(), len(video))
+	}
+	if gets.Load() != 1 {
+		t.Fatalf("%d reads from MinIO, want 1: bytes were already sent", gets.Load())
+	}
+}
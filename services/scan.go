@@ -0,0 +1,18 @@
+package services
+
+import "io"
+
+// Scanner inspects uploaded content before it is stored. Scan reports whether
+// the content is clean; an error means no verdict could be reached.
+// A ClamAV-backed implementation can be plugged in via Streaming.Scanner.
+type Scanner interface {
+	Scan(r io.Reader) (bool, error)
+}
+
+// NoopScanner accepts all content and is used when no scanner is configured.
+type NoopScanner struct{}
+
+// Scan always reports the content as clean.
+func (NoopScanner) Scan(io.Reader) (bool, error) {
+	return true, nil
+}
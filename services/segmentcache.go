@@ -0,0 +1,177 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/minio/minio-go/v7"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// segmentSize is the granularity of the stream cache; ranges are served from
+// the aligned segments that cover them.
+const segmentSize = defaultBufferSize
+
+// segmentKey identifies one segment of one version of an object
+type segmentKey struct {
+	objectName string
+	etag       string
+	index      int64
+}
+
+// segmentEntry is a cached segment in the LRU list
+type segmentEntry struct {
+	key  segmentKey
+	data []byte
+}
+
+// segmentCache is an LRU cache of object segments bounded by total bytes.
+// Keys include the ETag, so a changed object never serves stale bytes.
+type segmentCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	used     int64
+	order    *list.List
+	entries  map[segmentKey]*list.Element
+}
+
+func newSegmentCache(maxBytes int64) *segmentCache {
+	return &segmentCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[segmentKey]*list.Element),
+	}
+}
+
+// get returns a cached segment and marks it recently used
+func (sc *segmentCache) get(key segmentKey) ([]byte, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	element, ok := sc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	sc.order.MoveToFront(element)
+	return element.Value.(*segmentEntry).data, true
+}
+
+// add caches a segment, evicting the least recently used ones to make room
+func (sc *segmentCache) add(key segmentKey, data []byte) {
+	size := int64(len(data))
+	if size > sc.maxBytes {
+		return
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if _, ok := sc.entries[key]; ok {
+		return
+	}
+	for sc.used+size > sc.maxBytes {
+		oldest := sc.order.Back()
+		entry := oldest.Value.(*segmentEntry)
+		sc.order.Remove(oldest)
+		delete(sc.entries, entry.key)
+		sc.used -= int64(len(entry.data))
+	}
+	sc.entries[key] = sc.order.PushFront(&segmentEntry{key: key, data: data})
+	sc.used += size
+}
+
+// segment returns segment index of the object, from the cache or else from MinIO.
+func (streaming *Streaming) segment(ctx context.Context, info *minio.ObjectInfo, index int64) ([]byte, error) {
+	key := segmentKey{objectName: info.Key, etag: info.ETag, index: index}
+	if data, ok := streaming.segments.get(key); ok {
+		return data, nil
+	}
+
+	start := index * segmentSize
+	end := min(start+segmentSize, info.Size) - 1
+	data, err := streaming.fetchRange(ctx, info, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	streaming.segments.add(key, data)
+	return data, nil
+}
+
+// fetchRange reads bytes start through end of this version of the object.
+// Concurrent calls for the same range share a single MinIO read, so a burst of
+// players requesting the same bytes costs one upstream request.
+func (streaming *Streaming) fetchRange(ctx context.Context, info *minio.ObjectInfo, start, end int64) ([]byte, error) {
+	key := fmt.Sprintf("%s\x00%s\x00%d-%d", info.Key, info.ETag, start, end)
+	data, err, _ := streaming.inflight.Do(key, func() (interface{}, error) {
+		// The read is shared, so one client going away must not cancel it for the rest
+		ctx := context.WithoutCancel(ctx)
+
+		opts := minio.GetObjectOptions{}
+		if err := opts.SetRange(start, end); err != nil {
+			return nil, err
+		}
+		// Only this version may be shared or cached under its ETag
+		if err := opts.SetMatchETag(info.ETag); err != nil {
+			return nil, err
+		}
+
+		ctx, span := startSpan(ctx, "minio.GetObject",
+			attribute.String("object", info.Key),
+			attribute.Int64("range.start", start),
+			attribute.Int64("range.end", end),
+		)
+		var data []byte
+		err := streaming.withRetry(ctx, "GetObject "+info.Key, func() error {
+			object, err := streaming.GetObject(ctx, bucketName, info.Key, opts)
+			if err != nil {
+				return err
+			}
+			defer object.Close()
+			data, err = io.ReadAll(object)
+			return err
+		})
+		endSpan(span, err)
+		return data, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.([]byte), nil
+}
+
+// readSegments writes bytes start through end of the object to w from cached
+// segments, fetching missing ones from MinIO.
+func (streaming *Streaming) readSegments(ctx context.Context, info *minio.ObjectInfo, w http.ResponseWriter, start, end int64) {
+	for offset := start; offset <= end; {
+		index := offset / segmentSize
+		data, err := streaming.segment(ctx, info, index)
+		if err != nil {
+			if ctx.Err() == nil {
+				abortStream(info.Key, offset-start, err)
+			}
+			return
+		}
+
+		segmentStart := index * segmentSize
+		from := offset - segmentStart
+		to := min(end-segmentStart+1, int64(len(data)))
+		if from >= to {
+			// The object is shorter than its info claimed; it changed under us
+			abortStream(info.Key, offset-start, errors.New("object changed while streaming"))
+		}
+		if _, err := w.Write(data[from:to]); err != nil {
+			log.Printf("Error writing to response for object '%s': %v\n", info.Key, err)
+			return
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		offset = segmentStart + to
+	}
+}
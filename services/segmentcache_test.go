@@ -0,0 +1,153 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestSegmentCacheEviction(t *testing.T) {
+	cache := newSegmentCache(30)
+	key := func(index int64) segmentKey { return segmentKey{objectName: "video.mp4", etag: "etag", index: index} }
+	for index := range int64(3) {
+		cache.add(key(index), make([]byte, 10))
+	}
+	// Using the oldest segment makes the second one the least recently used
+	if _, ok := cache.get(key(0)); !ok {
+		t.Fatal("miss for a cached segment")
+	}
+	cache.add(key(3), make([]byte, 10))
+	if _, ok := cache.get(key(1)); ok {
+		t.Fatal("least recently used segment not evicted")
+	}
+	for _, index := range []int64{0, 2, 3} {
+		if _, ok := cache.get(key(index)); !ok {
+			t.Fatalf("segment %d evicted", index)
+		}
+	}
+	if cache.used != 30 {
+		t.Fatalf("cache holds %d bytes, want 30", cache.used)
+	}
+
+	// Segments larger than the whole cache are not kept
+	cache.add(key(4), make([]byte, 31))
+	if _, ok := cache.get(key(4)); ok {
+		t.Fatal("oversized segment cached")
+	}
+	// Another version of the object is another segment
+	if _, ok := cache.get(segmentKey{objectName: "video.mp4", etag: "changed", index: 0}); ok {
+		t.Fatal("segment of another version returned")
+	}
+}
+
+func TestReadSegments(t *testing.T) {
+	// Two and a half segments, each byte telling its offset apart from its neighbours
+	var content strings.Builder
+	for i := range segmentSize*5/2 + 1 {
+		content.WriteByte(byte(i % 251))
+	}
+	video := content.String()
+	var gets atomic.Int64
+	streaming := &Streaming{
+		Client:        fakeMinIO(t, map[string]string{"video.mp4": video}, &gets),
+		segments:      newSegmentCache(4 * segmentSize),
+		retryAttempts: 1,
+	}
+	info, err := streaming.StatObject(context.Background(), bucketName, "video.mp4", minio.StatObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(start, end int64) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		streaming.readSegments(context.Background(), &info, w, start, end)
+		if !bytes.Equal(w.Body.Bytes(), []byte(video[start:end+1])) {
+			t.Fatalf("bytes %d-%d: got %d bytes that differ from the object", start, end, w.Body.Len())
+		}
+	}
+	tests := []struct {
+		name       string
+		start, end int64
+		// gets is how many segments had to come from MinIO
+		gets int64
+	}{
+		{"across a boundary", segmentSize - 10, segmentSize + 10, 2},
+		{"cached", segmentSize - 5, segmentSize + 5, 0},
+		{"within a cached segment", 100, 200, 0},
+		{"partial last segment", 2*segmentSize + 1, info.Size - 1, 1},
+		{"whole object", 0, info.Size - 1, 0},
+	}
+	for _, tt := range tests {
+		before := gets.Load()
+		read(tt.start, tt.end)
+		if got := gets.Load() - before; got != tt.gets {
+			t.Fatalf("%s: %d reads from MinIO, want %d", tt.name, got, tt.gets)
+		}
+	}
+}
+
+func TestConcurrentReadsShareOneRequest(t *testing.T) {
+	const video = "0123456789abcdefghij"
+	var gets atomic.Int64
+	release := make(chan struct{})
+	objects := objectHandler(map[string]string{"video.mp4": video}, nil)
+	// Reads are held until released, so every client asks while one is in flight
+	streaming := &Streaming{
+		Client: minioClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				gets.Add(1)
+				<-release
+			}
+			objects.ServeHTTP(w, r)
+		})),
+		retryAttempts: 1,
+	}
+	info, err := streaming.StatObject(context.Background(), bucketName, "video.mp4", minio.StatObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ranges := [][2]int64{{0, 9}, {5, 14}}
+	const clients = 10
+	var wg sync.WaitGroup
+	results := make([][]byte, len(ranges)*clients)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := ranges[i%len(ranges)]
+			data, err := streaming.fetchRange(context.Background(), &info, r[0], r[1])
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = data
+		}()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for gets.Load() < int64(len(ranges)) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	// Let the remaining clients join the reads in flight
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := gets.Load(); got != int64(len(ranges)) {
+		t.Fatalf("%d clients made %d reads from MinIO, want one per range", len(results), got)
+	}
+	for i, data := range results {
+		r := ranges[i%len(ranges)]
+		if want := video[r[0] : r[1]+1]; string(data) != want {
+			t.Fatalf("bytes %d-%d: got %q, want %q", r[0], r[1], data, want)
+		}
+	}
+}
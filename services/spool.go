@@ -0,0 +1,147 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+)
+
+// maxFormValueBytes caps the non-file fields of an upload, as net/http does
+const maxFormValueBytes = 10 << 20
+
+// uploadForm is a parsed multipart upload
+type uploadForm struct {
+	Value map[string][]string
+	File  map[string][]*spooledFile
+}
+
+// spooledFile is a file part of an upload, held in memory or, past the spool
+// threshold, in a temp file
+type spooledFile struct {
+	Filename string
+	Header   textproto.MIMEHeader
+	Size     int64
+	content  []byte
+	path     string
+}
+
+// memoryFile is a spooledFile held in memory, opened
+type memoryFile struct {
+	*bytes.Reader
+}
+
+func (memoryFile) Close() error { return nil }
+
+// Open returns the content of the file
+func (f *spooledFile) Open() (multipart.File, error) {
+	if f.path == "" {
+		return memoryFile{bytes.NewReader(f.content)}, nil
+	}
+	return os.Open(f.path)
+}
+
+// RemoveAll deletes the temp files of the form
+func (form *uploadForm) RemoveAll() error {
+	var err error
+	for _, files := range form.File {
+		for _, file := range files {
+			if file.path != "" {
+				err = errors.Join(err, os.Remove(file.path))
+			}
+		}
+	}
+	return err
+}
+
+// readUploadForm parses a multipart upload like Request.ParseMultipartForm,
+// holding up to maxMemory bytes of files in memory, but spools the rest to dir
+// (the system temp dir if empty) rather than always to os.TempDir, which
+// mime/multipart offers no way to change. The fields stay readable through
+// c.PostForm. Call RemoveAll on the form once done with it.
+func readUploadForm(r *http.Request, maxMemory int64, dir string) (*uploadForm, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	form := &uploadForm{
+		Value: make(map[string][]string),
+		File:  make(map[string][]*spooledFile),
+	}
+	valueBytes := int64(maxFormValueBytes)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			form.RemoveAll()
+			return nil, err
+		}
+		name := part.FormName()
+		if name == "" {
+			continue
+		}
+
+		if part.FileName() == "" {
+			var value bytes.Buffer
+			n, err := io.CopyN(&value, part, valueBytes+1)
+			if err != nil && err != io.EOF {
+				form.RemoveAll()
+				return nil, err
+			}
+			valueBytes -= n
+			if valueBytes < 0 {
+				form.RemoveAll()
+				return nil, multipart.ErrMessageTooLarge
+			}
+			form.Value[name] = append(form.Value[name], value.String())
+			continue
+		}
+
+		file, err := spoolPart(part, max(maxMemory, 0), dir)
+		if err != nil {
+			form.RemoveAll()
+			return nil, err
+		}
+		maxMemory -= int64(len(file.content))
+		form.File[name] = append(form.File[name], file)
+	}
+
+	// What ParseMultipartForm would have left for c.PostForm to read
+	r.MultipartForm = &multipart.Form{Value: form.Value}
+	r.PostForm = form.Value
+	return form, nil
+}
+
+// spoolPart reads a file part, keeping it in memory if it fits in maxMemory
+// bytes and writing it to a temp file in dir otherwise
+func spoolPart(part *multipart.Part, maxMemory int64, dir string) (*spooledFile, error) {
+	file := &spooledFile{Filename: part.FileName(), Header: part.Header}
+	var head bytes.Buffer
+	n, err := io.CopyN(&head, part, maxMemory+1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if n <= maxMemory {
+		file.content = head.Bytes()
+		file.Size = n
+		return file, nil
+	}
+
+	spooled, err := os.CreateTemp(dir, "upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer spooled.Close()
+	file.path = spooled.Name()
+	file.Size, err = io.Copy(spooled, io.MultiReader(&head, part))
+	if err != nil {
+		os.Remove(file.path)
+		return nil, err
+	}
+	return file, nil
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// uploadRequest builds a multipart request with one value and the given files
+func uploadRequest(t *testing.T, files map[string][]byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("objectName", "clip.mp4")
+	for name, content := range files {
+		part, err := form.CreateFormFile(name, name+".mp4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(content)
+	}
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func TestReadUploadFormSpoolsToDir(t *testing.T) {
+	dir := t.TempDir()
+	tmpdir := os.Getenv("TMPDIR")
+	small, large := []byte("small"), bytes.Repeat([]byte("L"), 64)
+	req := uploadRequest(t, map[string][]byte{"small": small, "large": large})
+
+	form, err := readUploadForm(req, 16, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := req.PostForm.Get("objectName"); got != "clip.mp4" {
+		t.Fatalf("objectName field: got %q", got)
+	}
+	if os.Getenv("TMPDIR") != tmpdir {
+		t.Fatal("TMPDIR was changed")
+	}
+
+	for name, want := range map[string][]byte{"small": small, "large": large} {
+		file := form.File[name][0]
+		if file.Size != int64(len(want)) {
+			t.Fatalf("%s: size %d, want %d", name, file.Size, len(want))
+		}
+		opened, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(opened)
+		opened.Close()
+		if !bytes.Equal(content, want) {
+			t.Fatalf("%s: read %q, want %q", name, content, want)
+		}
+	}
+	if path := form.File["small"][0].path; path != "" {
+		t.Fatalf("small file spooled to %s, want it kept in memory", path)
+	}
+	spooled := form.File["large"][0].path
+	if filepath.Dir(spooled) != dir {
+		t.Fatalf("large file spooled to %s, want it in %s", spooled, dir)
+	}
+
+	if err := form.RemoveAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(spooled); !os.IsNotExist(err) {
+		t.Fatalf("spooled file left behind: %v", err)
+	}
+}
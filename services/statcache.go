@@ -0,0 +1,72 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// statEntry is cached object info and when it stops being used
+type statEntry struct {
+	info    minio.ObjectInfo
+	expires time.Time
+}
+
+// statCache keeps StatObject results for a short time, so the many range
+// requests of one playback share a single lookup. Writes made through this
+// service invalidate their object; the TTL bounds staleness for changes made
+// directly in MinIO.
+type statCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]statEntry
+}
+
+func newStatCache(ttl time.Duration) *statCache {
+	return &statCache{ttl: ttl, entries: make(map[string]statEntry)}
+}
+
+// get returns the cached info for objectName if it has not expired
+func (sc *statCache) get(objectName string, now time.Time) (minio.ObjectInfo, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	entry, ok := sc.entries[objectName]
+	if !ok {
+		return minio.ObjectInfo{}, false
+	}
+	if !now.Before(entry.expires) {
+		delete(sc.entries, objectName)
+		return minio.ObjectInfo{}, false
+	}
+	return entry.info, true
+}
+
+// put caches fresh info for objectName. An entry with the same ETag keeps its
+// expiry, since the object has not changed; a different ETag replaces it.
+func (sc *statCache) put(objectName string, info minio.ObjectInfo, now time.Time) {
+	if sc.ttl <= 0 {
+		return
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if entry, ok := sc.entries[objectName]; ok && entry.info.ETag == info.ETag && now.Before(entry.expires) {
+		return
+	}
+	// Expired entries are dropped here too, so the map stays bounded by recent traffic
+	for name, entry := range sc.entries {
+		if !now.Before(entry.expires) {
+			delete(sc.entries, name)
+		}
+	}
+	sc.entries[objectName] = statEntry{info: info, expires: now.Add(sc.ttl)}
+}
+
+// invalidate drops objectName after it was written or removed
+func (sc *statCache) invalidate(objectName string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	delete(sc.entries, objectName)
+}
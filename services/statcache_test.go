@@ -0,0 +1,53 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestStatCache(t *testing.T) {
+	cache := newStatCache(time.Minute)
+	now := time.Now()
+	first := minio.ObjectInfo{Key: "video.mp4", ETag: "first", Size: 10}
+	cache.put("video.mp4", first, now)
+
+	if info, ok := cache.get("video.mp4", now.Add(59*time.Second)); !ok || info.ETag != "first" {
+		t.Fatalf("within the TTL: got %+v, %v", info, ok)
+	}
+	if _, ok := cache.get("other.mp4", now); ok {
+		t.Fatal("hit for an object never cached")
+	}
+	// The same ETag again does not extend the entry
+	cache.put("video.mp4", first, now.Add(30*time.Second))
+	if _, ok := cache.get("video.mp4", now.Add(time.Minute)); ok {
+		t.Fatal("hit after the TTL")
+	}
+
+	// After expiry the next lookup caches fresh info
+	second := minio.ObjectInfo{Key: "video.mp4", ETag: "second", Size: 20}
+	cache.put("video.mp4", second, now.Add(time.Minute))
+	if info, ok := cache.get("video.mp4", now.Add(90*time.Second)); !ok || info.ETag != "second" {
+		t.Fatalf("after a refresh: got %+v, %v", info, ok)
+	}
+	// A changed ETag replaces the entry at once
+	cache.put("video.mp4", first, now.Add(100*time.Second))
+	if info, _ := cache.get("video.mp4", now.Add(100*time.Second)); info.ETag != "first" {
+		t.Fatalf("changed ETag: got %q", info.ETag)
+	}
+
+	cache.invalidate("video.mp4")
+	if _, ok := cache.get("video.mp4", now.Add(100*time.Second)); ok {
+		t.Fatal("hit after invalidation")
+	}
+}
+
+func TestStatCacheDisabled(t *testing.T) {
+	cache := newStatCache(0)
+	now := time.Now()
+	cache.put("video.mp4", minio.ObjectInfo{ETag: "etag"}, now)
+	if _, ok := cache.get("video.mp4", now); ok {
+		t.Fatal("cache with a zero TTL returned an entry")
+	}
+}
@@ -2,6 +2,8 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -9,28 +11,121 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/sync/singleflight"
+
+	"config"
+	"db"
+	"middlewares"
 )
 
 const (
-	minioEndpoint     = "localhost:9000"
-	useSSL            = false
 	bucketName        = "videos"
 	defaultBufferSize = 1024 * 1024
+	// maxSharedRange is the longest uncached range buffered whole so that
+	// concurrent identical requests share one read
+	maxSharedRange = defaultBufferSize
 )
 
 type Streaming struct {
 	*minio.Client
+	database *db.PrismaClient
+	uploads  *semaphore.Weighted
+	// ready is set once the MinIO client is connected; Client must not be used before
+	ready atomic.Bool
+	// progress publishes upload progress to websocket clients
+	progress *progressHub
+	// bytesPerSecond limits each stream's egress; zero disables throttling
+	bytesPerSecond int
+	// Scanner checks uploads before they are committed to MinIO
+	Scanner Scanner
+	// stats caches object info between the requests of a playback
+	stats *statCache
+	// segments caches recently streamed bytes; nil when STREAM_CACHE_MB is unset
+	segments *segmentCache
+	// allowedTypes lists the content types uploads may have; empty allows any
+	allowedTypes []string
+	// partSize is the multipart upload part size; zero lets MinIO choose
+	partSize uint64
+	// contentTypes maps extensions to the type served for objects stored without a specific one
+	contentTypes map[string]string
+	// maxRange caps the bytes served for one Range request; zero is unlimited
+	maxRange int64
+	// activeStreams counts Stream calls in progress
+	activeStreams atomic.Int64
+	// inflight coalesces concurrent reads of the same range
+	inflight singleflight.Group
+	// multipartMemory is how much of an upload is held in memory before spooling to disk
+	multipartMemory int64
+	// spoolDir is where uploads spool to; empty is the system temp dir
+	spoolDir string
+	// retryAttempts bounds how often a failing MinIO read is tried
+	retryAttempts int
+	// quotaMB is the default per-user storage quota; zero is unlimited
+	quotaMB int
+	// reservations holds the bytes of uploads in progress against each user's quota
+	reservations quotaReservations
+	// userPrefixes stores and scopes each user's videos under users/<email hash>/
+	userPrefixes bool
+	// minioConfig is where connect finds the video store
+	minioConfig config.MinIOConfig
+}
+
+// isNoSuchKey reports whether err is MinIO's answer for a missing object
+func isNoSuchKey(err error) bool {
+	return err != nil && minio.ToErrorResponse(err).Code == "NoSuchKey"
+}
+
+// isNoSuchBucket reports whether err says the configured bucket does not
+// exist, which is a deployment problem rather than a missing video
+func isNoSuchBucket(err error) bool {
+	return err != nil && minio.ToErrorResponse(err).Code == "NoSuchBucket"
+}
+
+// logMissingBucket explains a NoSuchBucket answer to whoever runs the server
+func logMissingBucket(err error) {
+	log.Printf("Bucket '%s' does not exist, the MinIO server may be misconfigured: %v\n", bucketName, err)
+}
+
+// writeError sends a JSON error body like the rest of the API. Stream works on
+// the plain http.ResponseWriter, so it cannot use gin's c.JSON.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(middlewares.APIError{Code: code, Message: message})
 }
 
+var (
+	// errRangeUnit is returned for a Range in a unit other than bytes
+	errRangeUnit = errors.New("unsupported range unit")
+	// errRangeNotSatisfiable is returned for a well-formed range outside the object
+	errRangeNotSatisfiable = errors.New("range not satisfiable")
+)
+
+// parseRange parses a single "bytes=start-end" range, tolerating whitespace
+// around the unit, the equals sign and the numbers. Syntax errors and
+// errRangeUnit should be answered with 400, errRangeNotSatisfiable with 416.
 func parseRange(rangeHeader string, fileSize int64) (int64, int64, error) {
-	if !strings.HasPrefix(rangeHeader, "bytes=") {
-		return 0, 0, fmt.Errorf("invalid range prefix")
+	unit, rangeSpec, found := strings.Cut(rangeHeader, "=")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid range format")
+	}
+	if !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+		return 0, 0, errRangeUnit
+	}
+	// An empty object has no bytes for any range to select
+	if fileSize == 0 {
+		return 0, 0, errRangeNotSatisfiable
 	}
 
-	rangeSpec := strings.TrimPrefix(rangeHeader, "bytes=")
+	rangeSpec = strings.TrimSpace(rangeSpec)
 	if strings.Contains(rangeSpec, ",") {
 		return 0, 0, fmt.Errorf("multiple ranges not supported")
 	}
@@ -39,6 +134,7 @@ func parseRange(rangeHeader string, fileSize int64) (int64, int64, error) {
 	if len(parts) != 2 {
 		return 0, 0, fmt.Errorf("invalid range format")
 	}
+	parts[0], parts[1] = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
 
 	var start, end int64
 	var err error
@@ -48,6 +144,9 @@ func parseRange(rangeHeader string, fileSize int64) (int64, int64, error) {
 		if err != nil {
 			return 0, 0, err
 		}
+		if suffixLength <= 0 {
+			return 0, 0, errRangeNotSatisfiable
+		}
 		if suffixLength > fileSize {
 			suffixLength = fileSize
 		}
@@ -63,6 +162,9 @@ func parseRange(rangeHeader string, fileSize int64) (int64, int64, error) {
 			if err != nil {
 				return 0, 0, err
 			}
+			if end < start {
+				return 0, 0, fmt.Errorf("invalid range values")
+			}
 			if end >= fileSize {
 				end = fileSize - 1
 			}
@@ -71,113 +173,279 @@ func parseRange(rangeHeader string, fileSize int64) (int64, int64, error) {
 		}
 	}
 
-	if start > end || start < 0 || end >= fileSize {
-		return 0, 0, fmt.Errorf("invalid range values")
+	if start < 0 || start >= fileSize || start > end {
+		return 0, 0, errRangeNotSatisfiable
 	}
 
 	return start, end, nil
 }
 
-func NewMinioClient() (*minio.Client, error) {
-	accessKey := os.Getenv("MINIO_ACCESS_KEY")
-	if accessKey == "" {
-		log.Fatalln("Missing MINIO_ACCESS_KEY environment variable")
-	}
-	secretKey := os.Getenv("MINIO_SECRET_KEY")
-	if secretKey == "" {
-		log.Fatalln("Missing MINIO_SECRET_KEY environment variable")
-	}
-
-	minioClient, err := minio.New(minioEndpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-		Secure: useSSL,
+// NewMinioClient creates a client for the MinIO server cfg describes. An empty
+// region lets the client discover it, and MinIO then creates buckets in us-east-1.
+func NewMinioClient(cfg config.MinIOConfig) (*minio.Client, error) {
+	minioClient, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
 	})
 	if err != nil {
-		log.Fatalln("Error initializing MinIO client:", err)
+		return nil, fmt.Errorf("initializing MinIO client: %w", err)
 	}
 	return minioClient, nil
 }
-func NewStreaming() *Streaming {
-	// Read MinIO credentials from environment variables
-	minioClient, err := NewMinioClient()
-	if err != nil {
-		log.Fatalf("Failed to create MinIO client: %v", err)
+
+// NewStreaming creates the streaming service and connects to MinIO in the
+// background, so the app can start while MinIO is down. Video routes guarded
+// by RequireStorage answer 503 until the connection succeeds. Connecting stops
+// when ctx is done.
+func NewStreaming(ctx context.Context, database *db.PrismaClient, cfg *config.Config) *Streaming {
+	streaming := newStreaming(database, cfg)
+	go streaming.connect(ctx)
+	return streaming
+}
+
+// NewStreamingWithClient creates the streaming service around an already
+// connected MinIO client, such as one pointing at a throwaway container in
+// integration tests. The videos bucket must exist.
+func NewStreamingWithClient(database *db.PrismaClient, cfg *config.Config, client *minio.Client) *Streaming {
+	streaming := newStreaming(database, cfg)
+	streaming.Client = client
+	streaming.ready.Store(true)
+	return streaming
+}
+
+// newStreaming builds the service from cfg without a MinIO client.
+func newStreaming(database *db.PrismaClient, cfg *config.Config) *Streaming {
+	streaming := &Streaming{
+		database:        database,
+		uploads:         semaphore.NewWeighted(int64(cfg.Upload.MaxConcurrent)),
+		progress:        newProgressHub(),
+		bytesPerSecond:  cfg.Stream.BytesPerSecond,
+		maxRange:        int64(cfg.Stream.MaxRangeMB) << 20,
+		contentTypes:    contentTypesWith(cfg.Stream.ContentTypes),
+		allowedTypes:    cfg.Upload.AllowedTypes,
+		partSize:        cfg.Upload.PartSize,
+		Scanner:         NoopScanner{},
+		stats:           newStatCache(cfg.Stream.StatCacheTTL),
+		multipartMemory: cfg.Upload.SpoolMemory,
+		retryAttempts:   cfg.MinIO.RetryAttempts,
+		quotaMB:         cfg.Upload.QuotaMB,
+		userPrefixes:    cfg.Upload.UserKeyPrefix,
+		minioConfig:     cfg.MinIO,
+	}
+	if cfg.Upload.TempDir != "" {
+		if err := os.MkdirAll(cfg.Upload.TempDir, 0o700); err != nil {
+			log.Printf("Uploads will spool to %s: %v\n", os.TempDir(), err)
+		} else {
+			streaming.spoolDir = cfg.Upload.TempDir
+		}
 	}
-	return &Streaming{
-		Client: minioClient,
+	if cfg.Stream.CacheMB > 0 {
+		streaming.segments = newSegmentCache(int64(cfg.Stream.CacheMB) << 20)
 	}
+	return streaming
+}
+
+// ActiveStreams is the number of video streams currently being served,
+// including ones still waiting on MinIO.
+func (streaming *Streaming) ActiveStreams() int64 {
+	return streaming.activeStreams.Load()
 }
 
-func (streaming *Streaming) GetObjectInfo(w http.ResponseWriter, objectName string) (*minio.ObjectInfo, error) {
-	objectInfo, err := streaming.StatObject(context.Background(), bucketName, objectName, minio.StatObjectOptions{})
+// GetObjectInfo returns the object's info, from the stat cache when it is fresh.
+func (streaming *Streaming) GetObjectInfo(ctx context.Context, objectName string) (*minio.ObjectInfo, error) {
+	if objectInfo, ok := streaming.stats.get(objectName, time.Now()); ok {
+		return &objectInfo, nil
+	}
+	ctx, span := startSpan(ctx, "minio.StatObject", attribute.String("object", objectName))
+	var objectInfo minio.ObjectInfo
+	err := streaming.withRetry(ctx, "StatObject "+objectName, func() (err error) {
+		objectInfo, err = streaming.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
+		return err
+	})
+	endSpan(span, err)
 	if err != nil {
 		log.Printf("Error getting object info for '%s': %v\n", objectName, err)
 		return nil, err
 	}
+	streaming.stats.put(objectName, objectInfo, time.Now())
 	return &objectInfo, nil
 }
 
-func (streaming *Streaming) Get(w http.ResponseWriter, objectName string) *minio.Object {
-	object, err := streaming.GetObject(context.Background(), bucketName, objectName, minio.GetObjectOptions{})
+// Get opens the object for reading, answering 500 if it cannot be.
+func (streaming *Streaming) Get(ctx context.Context, w http.ResponseWriter, objectName string, opts minio.GetObjectOptions) *minio.Object {
+	object, err := streaming.openObject(ctx, objectName, opts)
 	if err != nil {
-		http.Error(w, "Failed to get object", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, middlewares.CodeInternal, "failed to get object")
 		log.Printf("Error getting object '%s': %v\n", objectName, err)
 		return nil
 	}
 	return object
 }
+
+// openObject opens the object for reading. GetObject is lazy, so the first
+// request is made here with Stat, where it can still be retried; failures once
+// bytes are flowing to the client are not.
+func (streaming *Streaming) openObject(ctx context.Context, objectName string, opts minio.GetObjectOptions) (*minio.Object, error) {
+	var object *minio.Object
+	err := streaming.withRetry(ctx, "GetObject "+objectName, func() (err error) {
+		object, err = streaming.GetObject(ctx, bucketName, objectName, opts)
+		if err != nil {
+			return err
+		}
+		if _, err = object.Stat(); err != nil {
+			object.Close()
+		}
+		return err
+	})
+	return object, err
+}
+
+// abortStream ends a video response whose headers are already sent but whose
+// body cannot be completed. The status can no longer change, so the connection
+// is dropped instead: the client sees a broken transfer it will retry rather
+// than a short body that looks complete.
+func abortStream(objectName string, sent int64, err error) {
+	log.Printf("Aborting stream of '%s' after %d bytes: %v\n", objectName, sent, err)
+	panic(http.ErrAbortHandler)
+}
+
 func (streaming *Streaming) Stream(w http.ResponseWriter, r *http.Request) {
+	streaming.activeStreams.Add(1)
+	defer streaming.activeStreams.Add(-1)
+	// Video bodies are already compressed and served by byte range
+	middlewares.DisableCompression(w)
 	objectName := r.FormValue("objectName")
 	if objectName == "" {
-		http.Error(w, "Missing 'objectName' parameter", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, middlewares.CodeInvalidRequest, "missing 'objectName' parameter")
 		return
 	}
 
-	objectInfo, err := streaming.GetObjectInfo(w, objectName)
+	objectInfo, err := streaming.GetObjectInfo(r.Context(), objectName)
+	if isNoSuchKey(err) {
+		writeError(w, http.StatusNotFound, middlewares.CodeNotFound, "video not found")
+		return
+	}
+	if isNoSuchBucket(err) {
+		logMissingBucket(err)
+		writeError(w, http.StatusServiceUnavailable, middlewares.CodeUnavailable, "video storage is not available")
+		return
+	}
 	if err != nil || objectInfo == nil {
-		http.Error(w, "Failed to retrieve object info", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, middlewares.CodeInternal, "failed to retrieve object info")
 		return
 	}
 
 	fileSize := objectInfo.Size
 	w.Header().Set("Accept-Ranges", "bytes")
+	// Videos were always served as MP4 before their type was looked at, so
+	// that stays the fallback
+	contentType, ok := streaming.contentType(objectName, objectInfo.ContentType)
+	if !ok {
+		contentType = "video/mp4"
+	}
 
 	rangeHeader := r.Header.Get("Range")
 
+	// Without a Range the whole object is sent the same way a range would be;
+	// Accept-Ranges tells the client it can resume with one. Empty objects get
+	// an empty 200 and never reach MinIO
 	if rangeHeader == "" {
-		w.Header().Set("Content-Type", "video/mp4")
+		w.Header().Set("Content-Type", contentType)
 		w.Header().Set("Content-Length", strconv.FormatInt(fileSize, 10))
 		w.WriteHeader(http.StatusOK)
 
-		object := streaming.Get(w, objectName)
-		defer object.Close()
-
-		if _, err := io.Copy(w, object); err != nil {
-			log.Printf("Error streaming object '%s': %v\n", objectName, err)
+		if fileSize > 0 {
+			streaming.copyRange(r.Context(), objectInfo, streaming.throttle(r.Context(), w), 0, fileSize-1)
 		}
 		return
 	}
 
 	start, end, err := parseRange(rangeHeader, fileSize)
+	if errors.Is(err, errRangeNotSatisfiable) {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", fileSize))
+		writeError(w, http.StatusRequestedRangeNotSatisfiable, middlewares.CodeRangeNotSatisfiable, "range not satisfiable")
+		return
+	}
+	if errors.Is(err, errRangeUnit) {
+		writeError(w, http.StatusBadRequest, middlewares.CodeInvalidRequest, "unsupported range unit, only bytes are supported")
+		return
+	}
 	if err != nil {
-		http.Error(w, "Invalid Range header", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, middlewares.CodeInvalidRequest, "invalid Range header")
 		log.Printf("Error parsing range '%s': %v\n", rangeHeader, err)
 		return
 	}
+	// Oversized ranges are cut short; Content-Range tells the client where to resume
+	if streaming.maxRange > 0 && end-start+1 > streaming.maxRange {
+		end = start + streaming.maxRange - 1
+	}
 
-	w.Header().Set("Content-Type", "video/mp4")
+	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
 	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, fileSize))
 	w.WriteHeader(http.StatusPartialContent)
 
-	streaming.ReadBuffer(objectName, w, start, end)
+	streaming.copyRange(r.Context(), objectInfo, streaming.throttle(r.Context(), w), start, end)
+}
+
+// copyRange sends bytes start through end of the object, through the segment
+// cache when it is enabled. Without it, ranges up to maxSharedRange are read
+// in one piece so identical concurrent requests can share the read; longer
+// ones are streamed.
+func (streaming *Streaming) copyRange(ctx context.Context, info *minio.ObjectInfo, w http.ResponseWriter, start, end int64) {
+	if streaming.segments != nil {
+		streaming.readSegments(ctx, info, w, start, end)
+		return
+	}
+	if end-start+1 > maxSharedRange {
+		streaming.ReadBuffer(ctx, info.Key, w, start, end)
+		return
+	}
 
+	data, err := streaming.fetchRange(ctx, info, start, end)
+	if err != nil {
+		if ctx.Err() == nil {
+			abortStream(info.Key, 0, err)
+		}
+		return
+	}
+	if _, err := w.Write(data); err != nil {
+		log.Printf("Error writing to response for object '%s': %v\n", info.Key, err)
+		return
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
 }
 
-func (streaming *Streaming) ReadBuffer(objectName string, w http.ResponseWriter, start int64, end int64) {
+// ReadBuffer copies bytes start through end of the object to w, flushing after
+// every buffer. It stops when ctx is done, e.g. once the client disconnects.
+func (streaming *Streaming) ReadBuffer(ctx context.Context, objectName string, w http.ResponseWriter, start int64, end int64) {
 	getOpts := minio.GetObjectOptions{}
-	getOpts.SetRange(start, end)
-	object := streaming.Get(w, objectName)
+	if err := getOpts.SetRange(start, end); err != nil {
+		log.Printf("Error setting range for object '%s': %v\n", objectName, err)
+		return
+	}
+	// The span covers the whole read, since GetObject only fetches lazily
+	ctx, span := startSpan(ctx, "minio.GetObject",
+		attribute.String("object", objectName),
+		attribute.Int64("range.start", start),
+		attribute.Int64("range.end", end),
+	)
+	var readErr error
+	defer func() { endSpan(span, readErr) }()
+
+	// The response headers are already out, so failures abort the connection
+	var sent int64
+	object, err := streaming.openObject(ctx, objectName, getOpts)
+	if err != nil {
+		if ctx.Err() == nil {
+			readErr = err
+			abortStream(objectName, sent, err)
+		}
+		return
+	}
 	defer object.Close()
 	buffer := make([]byte, defaultBufferSize)
 	for {
@@ -187,13 +455,16 @@ func (streaming *Streaming) ReadBuffer(objectName string, w http.ResponseWriter,
 				log.Printf("Error writing to response for object '%s': %v\n", objectName, writeErr)
 				break
 			}
+			sent += int64(n)
 			if f, ok := w.(http.Flusher); ok {
 				f.Flush()
 			}
 		}
 		if err != nil {
-			if err != io.EOF {
-				log.Printf("Error reading object '%s': %v\n", objectName, err)
+			// A cancelled context means the client went away, which is not an error
+			if err != io.EOF && ctx.Err() == nil {
+				readErr = err
+				abortStream(objectName, sent, err)
 			}
 			break
 		}
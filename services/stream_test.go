@@ -0,0 +1,386 @@
+package services
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"config"
+	"middlewares"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header     string
+		start, end int64
+		err        error
+	}{
+		{"bytes=0-99", 0, 99, nil},
+		{"bytes= 0-99", 0, 99, nil},
+		{"bytes = 10 - 19", 10, 19, nil},
+		{" Bytes=\t500-", 500, 999, nil},
+		{"bytes= -100", 900, 999, nil},
+		{"bytes=900-5000", 900, 999, nil},
+		{"items=0-9", 0, 0, errRangeUnit},
+		{"none= 0-9", 0, 0, errRangeUnit},
+		{"bytes=1000-", 0, 0, errRangeNotSatisfiable},
+		{"bytes=-0", 0, 0, errRangeNotSatisfiable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			start, end, err := parseRange(tt.header, 1000)
+			if !errors.Is(err, tt.err) || start != tt.start || end != tt.end {
+				t.Fatalf("got %d-%d, %v; want %d-%d, %v", start, end, err, tt.start, tt.end, tt.err)
+			}
+		})
+	}
+
+	// Malformed ranges are syntax errors, answered with 400
+	for _, header := range []string{"bytes 0-9", "bytes=a-9", "bytes=0-9,20-29", "bytes=9-0", "bytes=0-9-"} {
+		_, _, err := parseRange(header, 1000)
+		if err == nil || errors.Is(err, errRangeUnit) || errors.Is(err, errRangeNotSatisfiable) {
+			t.Fatalf("%q: got %v, want a syntax error", header, err)
+		}
+	}
+}
+
+// fakeMinIO serves the objects in content from the videos bucket, answers
+// 403 for denied.mp4, as with wrong credentials, and 404 for anything else.
+// Objects under legacy/ are typed application/octet-stream, as uploads were
+// before their type was recorded, and the rest video/mp4. Each GetObject
+// request is counted in gets, if given.
+func fakeMinIO(t *testing.T, content map[string]string, gets *atomic.Int64) *minio.Client {
+	t.Helper()
+	return minioClient(t, objectHandler(content, gets))
+}
+
+// objectHandler is the handler behind fakeMinIO
+func objectHandler(content map[string]string, gets *atomic.Int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if gets != nil && r.Method == http.MethodGet {
+			gets.Add(1)
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/"+bucketName+"/")
+		body, ok := content[name]
+		switch {
+		case name == "denied.mp4":
+			w.WriteHeader(http.StatusForbidden)
+		case !ok:
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Header().Set("ETag", `"etag"`)
+			w.Header().Set("Content-Type", "video/mp4")
+			if strings.HasPrefix(name, "legacy/") {
+				w.Header().Set("Content-Type", "application/octet-stream")
+			}
+			http.ServeContent(w, r, name, time.Now(), strings.NewReader(body))
+		}
+	})
+}
+
+// minioClient returns a client talking to handler as its MinIO server. The
+// client does not retry by itself, so handler sees exactly the requests
+// Streaming makes.
+func minioClient(t *testing.T, handler http.Handler) *minio.Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client, err := minio.New(strings.TrimPrefix(server.URL, "http://"), &minio.Options{
+		Creds:      credentials.NewStaticV4("access", "secret", ""),
+		Region:     "us-east-1",
+		MaxRetries: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// truncatingMinIO serves video as video.mp4, but breaks off every read
+// reaching past the middle of the object there, as when MinIO goes away
+// mid-transfer. Each read is counted in gets.
+func truncatingMinIO(t *testing.T, video string, gets *atomic.Int64) *minio.Client {
+	t.Helper()
+	objects := objectHandler(map[string]string{"video.mp4": video}, nil)
+	return minioClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			objects.ServeHTTP(w, r)
+			return
+		}
+		gets.Add(1)
+		start, end := int64(0), int64(len(video)-1)
+		if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+			start, end, _ = parseRange(rangeHeader, int64(len(video)))
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(video)))
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		if r.Header.Get("Range") != "" {
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		middle := int64(len(video) / 2)
+		if end < middle {
+			w.Write([]byte(video[start : end+1]))
+			return
+		}
+		w.Write([]byte(video[start:max(start, middle)]))
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+}
+
+func TestStreamErrors(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Upload.MaxConcurrent = 1
+	streaming := NewStreamingWithClient(nil, cfg, fakeMinIO(t, map[string]string{"video.mp4": "0123456789"}, nil))
+
+	tests := []struct {
+		name        string
+		query       string
+		rangeHeader string
+		status      int
+		code        string
+	}{
+		{"missing objectName", "", "", http.StatusBadRequest, middlewares.CodeInvalidRequest},
+		{"missing object", "?objectName=missing.mp4", "", http.StatusNotFound, middlewares.CodeNotFound},
+		{"storage error", "?objectName=denied.mp4", "", http.StatusInternalServerError, middlewares.CodeInternal},
+		{"unknown unit", "?objectName=video.mp4", "items=0-1", http.StatusBadRequest, middlewares.CodeInvalidRequest},
+		{"malformed range", "?objectName=video.mp4", "bytes=a-b", http.StatusBadRequest, middlewares.CodeInvalidRequest},
+		{"outside the object", "?objectName=video.mp4", "bytes=50-", http.StatusRequestedRangeNotSatisfiable, middlewares.CodeRangeNotSatisfiable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/video"+tt.query, nil)
+			if tt.rangeHeader != "" {
+				req.Header.Set("Range", tt.rangeHeader)
+			}
+			w := httptest.NewRecorder()
+			streaming.Stream(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("got %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+				t.Fatalf("got Content-Type %q", ct)
+			}
+			var body middlewares.APIError
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != tt.code || body.Message == "" {
+				t.Fatalf("body %s is not a %s APIError", w.Body, tt.code)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/video?objectName=video.mp4", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	w := httptest.NewRecorder()
+	streaming.Stream(w, req)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "2345" {
+		t.Fatalf("valid range: got %d %q", w.Code, w.Body)
+	}
+}
+
+func TestStreamEmptyObject(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Upload.MaxConcurrent = 1
+	var gets atomic.Int64
+	streaming := NewStreamingWithClient(nil, cfg, fakeMinIO(t, map[string]string{"empty.mp4": ""}, &gets))
+	stream := func(rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/video?objectName=empty.mp4", nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		w := httptest.NewRecorder()
+		streaming.Stream(w, req)
+		return w
+	}
+
+	w := stream("")
+	if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("Content-Length") != "0" {
+		t.Fatalf("without a range: got %d with %d bytes, Content-Length %q", w.Code, w.Body.Len(), w.Header().Get("Content-Length"))
+	}
+	for _, rangeHeader := range []string{"bytes=0-", "bytes=0-0", "bytes=-1"} {
+		w := stream(rangeHeader)
+		if w.Code != http.StatusRequestedRangeNotSatisfiable || w.Header().Get("Content-Range") != "bytes */0" {
+			t.Fatalf("%q: got %d with Content-Range %q, want 416 with bytes */0", rangeHeader, w.Code, w.Header().Get("Content-Range"))
+		}
+	}
+	if gets.Load() != 0 {
+		t.Fatalf("%d reads of an empty object from MinIO", gets.Load())
+	}
+}
+
+func TestStreamIsNeverGzipped(t *testing.T) {
+	video := strings.Repeat("compressible video ", 1000)
+	cfg := &config.Config{}
+	cfg.Upload.MaxConcurrent = 1
+	streaming := NewStreamingWithClient(nil, cfg, fakeMinIO(t, map[string]string{"video.mp4": video}, nil))
+	// The route is not exempted; the handler opts out by itself
+	r := gin.New()
+	r.Use(middlewares.GzipMiddleware(gzip.BestSpeed, 1))
+	r.GET("/api/video", func(c *gin.Context) { streaming.Stream(c.Writer, c.Request) })
+
+	tests := []struct {
+		rangeHeader string
+		status      int
+		want        string
+	}{
+		{"", http.StatusOK, video},
+		{"bytes=100-1099", http.StatusPartialContent, video[100:1100]},
+		{"bytes=-50", http.StatusPartialContent, video[len(video)-50:]},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/video?objectName=video.mp4", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		if tt.rangeHeader != "" {
+			req.Header.Set("Range", tt.rangeHeader)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status || w.Header().Get("Content-Encoding") != "" || w.Body.String() != tt.want {
+			t.Fatalf("%q: got %d with Content-Encoding %q and %d bytes, want %d with the bytes as stored",
+				tt.rangeHeader, w.Code, w.Header().Get("Content-Encoding"), w.Body.Len(), tt.status)
+		}
+	}
+}
+
+func TestStreamClampsOversizedRanges(t *testing.T) {
+	var content strings.Builder
+	for i := range 3 << 20 {
+		content.WriteByte(byte(i % 251))
+	}
+	video := content.String()
+	cfg := &config.Config{}
+	cfg.Upload.MaxConcurrent = 1
+	cfg.Stream.MaxRangeMB = 1
+	streaming := NewStreamingWithClient(nil, cfg, fakeMinIO(t, map[string]string{"video.mp4": video}, nil))
+
+	tests := []struct {
+		rangeHeader  string
+		start, end   int
+		contentRange string
+	}{
+		{"bytes=0-", 0, 1<<20 - 1, "bytes 0-1048575/3145728"},
+		{"bytes=1048576-3145727", 1 << 20, 2<<20 - 1, "bytes 1048576-2097151/3145728"},
+		{"bytes=-2097152", 1 << 20, 2<<20 - 1, "bytes 1048576-2097151/3145728"},
+		// Ranges within the cap are served whole
+		{"bytes=100-199", 100, 199, "bytes 100-199/3145728"},
+		{"bytes=2097152-", 2 << 20, 3<<20 - 1, "bytes 2097152-3145727/3145728"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/video?objectName=video.mp4", nil)
+		req.Header.Set("Range", tt.rangeHeader)
+		w := httptest.NewRecorder()
+		streaming.Stream(w, req)
+		if w.Code != http.StatusPartialContent || w.Header().Get("Content-Range") != tt.contentRange {
+			t.Fatalf("%q: got %d with Content-Range %q, want 206 with %q", tt.rangeHeader, w.Code, w.Header().Get("Content-Range"), tt.contentRange)
+		}
+		if w.Body.String() != video[tt.start:tt.end+1] || w.Header().Get("Content-Length") != strconv.Itoa(tt.end-tt.start+1) {
+			t.Fatalf("%q: got %d bytes with Content-Length %q, want bytes %d-%d", tt.rangeHeader, w.Body.Len(), w.Header().Get("Content-Length"), tt.start, tt.end)
+		}
+	}
+}
+
+func TestStreamAbortsMidTransfer(t *testing.T) {
+	var content strings.Builder
+	// The segment cache gets the first segment whole and fails on the second
+	for i := range 3 * maxSharedRange {
+		content.WriteByte(byte(i % 251))
+	}
+	video := content.String()
+
+	tests := []struct {
+		name    string
+		cacheMB int
+	}{
+		{"streamed", 0},
+		{"through the segment cache", 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gets atomic.Int64
+			cfg := &config.Config{}
+			cfg.Upload.MaxConcurrent = 1
+			cfg.MinIO.RetryAttempts = 1
+			cfg.Stream.CacheMB = tt.cacheMB
+			streaming := NewStreamingWithClient(nil, cfg, truncatingMinIO(t, video, &gets))
+			// net/http drops the connection on http.ErrAbortHandler
+			server := httptest.NewServer(http.HandlerFunc(streaming.Stream))
+			t.Cleanup(server.Close)
+
+			resp, err := http.Get(server.URL + "/api/video?objectName=video.mp4")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || resp.ContentLength != int64(len(video)) {
+				t.Fatalf("got %d with Content-Length %d", resp.StatusCode, resp.ContentLength)
+			}
+			body, err := io.ReadAll(resp.Body)
+			// The client sees a broken transfer rather than a short body that looks complete
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("reading %d of %d bytes: got %v, want io.ErrUnexpectedEOF", len(body), len(video), err)
+			}
+			if len(body) == 0 || !strings.HasPrefix(video, string(body)) {
+				t.Fatalf("got %d bytes before the failure, want the start of the object", len(body))
+			}
+		})
+	}
+}
+
+func TestMissingBucket(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Upload.MaxConcurrent = 1
+	// MinIO names the error in a header where HEAD answers have no body
+	missingBucket := minioClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Minio-Error-Code", "NoSuchBucket")
+		w.Header().Set("X-Minio-Error-Desc", `"The specified bucket does not exist"`)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	missingKey := fakeMinIO(t, nil, nil)
+
+	r := gin.New()
+	tests := []struct {
+		name   string
+		client *minio.Client
+		status int
+		code   string
+	}{
+		{"missing bucket", missingBucket, http.StatusServiceUnavailable, middlewares.CodeUnavailable},
+		{"missing object", missingKey, http.StatusNotFound, middlewares.CodeNotFound},
+	}
+	for _, tt := range tests {
+		streaming := NewStreamingWithClient(nil, cfg, tt.client)
+		prefix := "/" + strings.ReplaceAll(tt.name, " ", "-")
+		r.GET(prefix+"/video", func(c *gin.Context) { streaming.Stream(c.Writer, c.Request) })
+		r.GET(prefix+"/info", streaming.VideoInfo)
+
+		for _, path := range []string{prefix + "/video", prefix + "/info"} {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"?objectName=video.mp4", nil))
+			var body middlewares.APIError
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("%s: decoding %s: %v", path, w.Body, err)
+			}
+			if w.Code != tt.status || body.Code != tt.code {
+				t.Fatalf("%s: got %d with code %q, want %d with %q", path, w.Code, body.Code, tt.status, tt.code)
+			}
+		}
+	}
+}
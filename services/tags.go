@@ -0,0 +1,125 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/tags"
+	"go.opentelemetry.io/otel/attribute"
+
+	"db"
+	"middlewares"
+)
+
+// SetTags replaces the tags of one of the authenticated user's videos. Tags
+// are stored on the MinIO object, at most 10 per object, following S3's rules
+// for key and value length and characters.
+func (streaming *Streaming) SetTags(c *gin.Context) {
+	var req struct {
+		ObjectName string            `json:"objectName" binding:"required"`
+		Tags       map[string]string `json:"tags" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middlewares.RespondBindError(c, err)
+		return
+	}
+	objectTags, err := tags.NewTags(req.Tags, true)
+	if err != nil {
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	_, err = streaming.ownedVideo(c, req.ObjectName)
+	if errors.Is(err, db.ErrNotFound) {
+		middlewares.RespondError(c, http.StatusNotFound, middlewares.CodeNotFound, "video not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to look up video '%s': %v\n", req.ObjectName, err)
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not update tags")
+		return
+	}
+
+	ctx, span := startSpan(c.Request.Context(), "minio.PutObjectTagging", attribute.String("object", req.ObjectName))
+	err = streaming.PutObjectTagging(ctx, bucketName, req.ObjectName, objectTags, minio.PutObjectTaggingOptions{})
+	endSpan(span, err)
+	if isNoSuchKey(err) {
+		middlewares.RespondError(c, http.StatusNotFound, middlewares.CodeNotFound, "video not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to tag '%s': %v\n", req.ObjectName, err)
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not update tags")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"objectName": req.ObjectName, "tags": objectTags.ToMap()})
+}
+
+// GetTags returns the tags of one of the authenticated user's videos.
+func (streaming *Streaming) GetTags(c *gin.Context) {
+	objectName := c.Query("objectName")
+	if objectName == "" {
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, "missing 'objectName' parameter")
+		return
+	}
+
+	_, err := streaming.ownedVideo(c, objectName)
+	if errors.Is(err, db.ErrNotFound) {
+		middlewares.RespondError(c, http.StatusNotFound, middlewares.CodeNotFound, "video not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to look up video '%s': %v\n", objectName, err)
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not read tags")
+		return
+	}
+
+	ctx, span := startSpan(c.Request.Context(), "minio.GetObjectTagging", attribute.String("object", objectName))
+	objectTags, err := streaming.GetObjectTagging(ctx, bucketName, objectName, minio.GetObjectTaggingOptions{})
+	endSpan(span, err)
+	if isNoSuchKey(err) {
+		middlewares.RespondError(c, http.StatusNotFound, middlewares.CodeNotFound, "video not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read tags of '%s': %v\n", objectName, err)
+		middlewares.RespondError(c, http.StatusInternalServerError, middlewares.CodeInternal, "could not read tags")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"objectName": objectName, "tags": objectTags.ToMap()})
+}
+
+// tagFilter selects objects carrying a tag, with a given value unless anyValue is set.
+type tagFilter struct {
+	key      string
+	value    string
+	anyValue bool
+}
+
+// parseTagFilter reads a "key" or "key=value" tag query parameter. An empty
+// parameter yields nil, which matches every object.
+func parseTagFilter(param string) (*tagFilter, error) {
+	if param == "" {
+		return nil, nil
+	}
+	key, value, hasValue := strings.Cut(param, "=")
+	if key == "" {
+		return nil, errors.New("tag must be key or key=value")
+	}
+	return &tagFilter{key: key, value: value, anyValue: !hasValue}, nil
+}
+
+// matches reports whether an object's tags satisfy the filter.
+func (f *tagFilter) matches(objectTags map[string]string) bool {
+	if f == nil {
+		return true
+	}
+	value, ok := objectTags[f.key]
+	return ok && (f.anyValue || value == f.value)
+}
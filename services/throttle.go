@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// throttledWriter caps the rate at which bytes are written to a client using a token bucket.
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	limiter *rate.Limiter
+}
+
+// newThrottledWriter wraps w so that at most bytesPerSecond are written. The
+// bucket starts empty so the first second is throttled like the rest.
+func newThrottledWriter(ctx context.Context, w http.ResponseWriter, bytesPerSecond int) *throttledWriter {
+	limiter := rate.NewLimiter(rate.Limit(bytesPerSecond), bytesPerSecond)
+	limiter.AllowN(time.Now(), bytesPerSecond)
+	return &throttledWriter{ResponseWriter: w, ctx: ctx, limiter: limiter}
+}
+
+// Write blocks until enough tokens are available, writing at most one burst at a time.
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		chunk := min(len(p)-written, tw.limiter.Burst())
+		if err := tw.limiter.WaitN(tw.ctx, chunk); err != nil {
+			return written, err
+		}
+		n, err := tw.ResponseWriter.Write(p[written : written+chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Flush passes through to the underlying writer so streaming keeps flushing.
+func (tw *throttledWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// throttle wraps w with the configured per-stream byte rate, if any.
+func (streaming *Streaming) throttle(ctx context.Context, w http.ResponseWriter) http.ResponseWriter {
+	if streaming.bytesPerSecond <= 0 {
+		return w
+	}
+	return newThrottledWriter(ctx, w, streaming.bytesPerSecond)
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestThrottledWriterLimitsRate(t *testing.T) {
+	w := httptest.NewRecorder()
+	streaming := &Streaming{bytesPerSecond: 10000}
+	throttled := streaming.throttle(context.Background(), w)
+
+	start := time.Now()
+	n, err := throttled.Write(make([]byte, 5000))
+	if err != nil || n != 5000 || w.Body.Len() != 5000 {
+		t.Fatalf("wrote %d bytes (%d received): %v", n, w.Body.Len(), err)
+	}
+	// The bucket starts empty, so half the rate takes half a second
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("5000 bytes at 10000 B/s took %v", elapsed)
+	}
+}
+
+func TestThrottledWriterStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	throttled := newThrottledWriter(ctx, httptest.NewRecorder(), 100)
+	cancel()
+	if _, err := throttled.Write(make([]byte, 10)); err == nil {
+		t.Fatal("write after the client left did not fail")
+	}
+}
+
+func TestThrottleDisabled(t *testing.T) {
+	w := httptest.NewRecorder()
+	if got := (&Streaming{}).throttle(context.Background(), w); got != w {
+		t.Fatal("writer wrapped although no rate is configured")
+	}
+}
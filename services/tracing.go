@@ -0,0 +1,31 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"db"
+)
+
+// tracer creates the child spans for MinIO operations and database queries
+var tracer = otel.Tracer("services")
+
+// startSpan starts a client span named after the MinIO or Prisma call it covers
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endSpan ends span, marking it failed when err is set. A query finding no
+// rows is an answer rather than a failure.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"config"
+)
+
+func TestMinIOSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := tracer
+	tracer = provider.Tracer("services")
+	t.Cleanup(func() { tracer = previous })
+
+	cfg := &config.Config{}
+	cfg.Upload.MaxConcurrent = 1
+	streaming := NewStreamingWithClient(nil, cfg, fakeMinIO(t, map[string]string{"video.mp4": "0123456789"}, nil))
+
+	ctx, request := provider.Tracer("test").Start(context.Background(), "request")
+	if _, err := streaming.GetObjectInfo(ctx, "video.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := streaming.GetObjectInfo(ctx, "denied.mp4"); err == nil {
+		t.Fatal("denied object has info")
+	}
+	request.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want one per StatObject and the request", len(spans))
+	}
+	for _, span := range spans[:2] {
+		if span.Name != "minio.StatObject" || span.SpanKind != trace.SpanKindClient {
+			t.Fatalf("got span %q of kind %v", span.Name, span.SpanKind)
+		}
+		if span.Parent.SpanID() != request.SpanContext().SpanID() {
+			t.Fatalf("%s is not a child of the request span", span.Name)
+		}
+	}
+	if spans[0].Status.Code == codes.Error || spans[1].Status.Code != codes.Error {
+		t.Fatalf("got statuses %v and %v, want only the failed call marked", spans[0].Status.Code, spans[1].Status.Code)
+	}
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+
+	"db"
+)
+
+// Tx collects the writes of a transaction, made with the Tx form of Prisma
+// queries, e.g. database.User.FindUnique(...).Update(...).Tx().
+type Tx struct {
+	ops []db.PrismaTransaction
+}
+
+// Add queues writes to run in the transaction, in order.
+func (tx *Tx) Add(ops ...db.PrismaTransaction) {
+	tx.ops = append(tx.ops, ops...)
+}
+
+// WithTransaction runs the writes fn queues on tx as one Prisma transaction:
+// either all of them are committed or, if one fails, none are. Prisma's Go
+// client cannot run code between the writes of a transaction, so fn does its
+// reads and checks up front; an error from fn aborts before anything is written.
+//
+// It only covers database writes, such as the password change with its history.
+// Account deletion is a single write already. Uploads, copies and renames
+// span MinIO, which no database transaction reaches; copies and renames
+// remove what they stored when their database write fails.
+func WithTransaction(ctx context.Context, database *db.PrismaClient, fn func(tx *Tx) error) error {
+	tx := &Tx{}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if len(tx.ops) == 0 {
+		return nil
+	}
+	ctx, span := startSpan(ctx, "prisma.Transaction")
+	err := database.Prisma.Transaction(tx.ops...).Exec(ctx)
+	endSpan(span, err)
+	return err
+}
@@ -1,54 +1,352 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/minio/minio-go/v7"
+	"go.opentelemetry.io/otel/attribute"
+
+	"db"
+	"middlewares"
+)
+
+const (
+	// maxUploadSize is the largest single file accepted, 100 MB
+	maxUploadSize = 100 << 20
+	// maxBatchSize caps the whole body of a batch upload
+	maxBatchSize = 10 * maxUploadSize
 )
 
+// uploadError describes why a single file could not be stored
+type uploadError struct {
+	status  int
+	message string
+}
+
 // UploadVideo handles multipart uploads of video files to MinIO.
+// Progress can be followed over UploadProgress by passing an uploadId query parameter.
 func (streaming *Streaming) UploadVideo(c *gin.Context) {
-	// Max upload size of, say, 100 MB. Adjust as you like.
-	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, 100<<20)
+	// Reject rather than queue once the concurrent upload limit is reached
+	if !streaming.uploads.TryAcquire(1) {
+		c.Header("Retry-After", "5")
+		middlewares.RespondError(c, http.StatusServiceUnavailable, middlewares.CodeUnavailable, "too many concurrent uploads")
+		return
+	}
+	defer streaming.uploads.Release(1)
+
+	streaming.trackProgress(c)
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize)
+	// Parse with the configured spool threshold and directory; FormFile would use its own
+	form, err := readUploadForm(c.Request, streaming.multipartMemory, streaming.spoolDir)
+	if err != nil {
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, "failed to read file: "+err.Error())
+		return
+	}
+	defer form.RemoveAll()
 
 	// Read the file part from the form ("file" is the field name)
-	file, header, err := c.Request.FormFile("file")
+	if len(form.File["file"]) == 0 {
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, "failed to read file: "+http.ErrMissingFile.Error())
+		return
+	}
+	header := form.File["file"][0]
+
+	// Use the requested key if given, otherwise make the file name unique
+	objectName := c.PostForm("objectName")
+	if objectName == "" {
+		objectName = defaultObjectName(header.Filename)
+	} else if err := validateObjectName(objectName); err != nil {
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, err.Error())
+		return
+	}
+	objectName = streaming.scopedKey(c, objectName)
+
+	// Content-MD5 may be sent on the request or on the file part
+	expectedMD5 := c.GetHeader("Content-MD5")
+	if expectedMD5 == "" {
+		expectedMD5 = header.Header.Get("Content-MD5")
+	}
+	expiresAt, err := uploadExpiry(c, time.Now())
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read file: " + err.Error()})
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, err.Error())
 		return
 	}
+	metadata, err := uploadMetadata(c.PostForm)
+	if err != nil {
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, err.Error())
+		return
+	}
+	result, uploadErr := streaming.storeVideo(c, header, objectName, expectedMD5, expiresAt, metadata)
+	if uploadErr != nil {
+		middlewares.RespondError(c, uploadErr.status, middlewares.CodeForStatus(uploadErr.status), uploadErr.message)
+		return
+	}
+	result["message"] = "upload successful"
+	c.JSON(http.StatusOK, result)
+}
+
+// UploadVideoBatch handles multipart uploads carrying several "files" parts.
+// Each file is validated and stored on its own; if any fails the response is
+// 207 Multi-Status with a per-file result.
+func (streaming *Streaming) UploadVideoBatch(c *gin.Context) {
+	if !streaming.uploads.TryAcquire(1) {
+		c.Header("Retry-After", "5")
+		middlewares.RespondError(c, http.StatusServiceUnavailable, middlewares.CodeUnavailable, "too many concurrent uploads")
+		return
+	}
+	defer streaming.uploads.Release(1)
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBatchSize)
+	form, err := readUploadForm(c.Request, streaming.multipartMemory, streaming.spoolDir)
+	if err != nil {
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, "failed to read files: "+err.Error())
+		return
+	}
+	defer form.RemoveAll()
+	headers := form.File["files"]
+	if len(headers) == 0 {
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, "no files provided")
+		return
+	}
+	// expiresIn applies to every file of the batch
+	expiresAt, err := uploadExpiry(c, time.Now())
+	if err != nil {
+		middlewares.RespondError(c, http.StatusBadRequest, middlewares.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	status := http.StatusOK
+	results := make([]gin.H, 0, len(headers))
+	for _, header := range headers {
+		result, uploadErr := streaming.storeVideo(c, header, streaming.scopedKey(c, defaultObjectName(header.Filename)), header.Header.Get("Content-MD5"), expiresAt, nil)
+		if uploadErr != nil {
+			status = http.StatusMultiStatus
+			results = append(results, gin.H{
+				"file":    header.Filename,
+				"success": false,
+				"status":  uploadErr.status,
+				"code":    middlewares.CodeForStatus(uploadErr.status),
+				"error":   uploadErr.message,
+			})
+			continue
+		}
+		result["file"] = header.Filename
+		result["success"] = true
+		result["status"] = http.StatusOK
+		results = append(results, result)
+	}
+
+	c.JSON(status, gin.H{"results": results})
+}
+
+// storeVideo validates, scans, uploads and records a single multipart file under objectName.
+// When expectedMD5 (base64, as in a Content-MD5 header) is given the file must match it.
+// Uploads with an expiresAt are removed by the expiry sweeper once it passes.
+// metadata is stored as the object's user metadata.
+func (streaming *Streaming) storeVideo(c *gin.Context, header *spooledFile, objectName, expectedMD5 string, expiresAt *time.Time, metadata map[string]string) (gin.H, *uploadError) {
+	if header.Size > maxUploadSize {
+		return nil, &uploadError{http.StatusRequestEntityTooLarge, "file too large"}
+	}
+
+	// Only the owner may replace a video
+	isNew, uploadErr := streaming.checkOverwrite(c, objectName)
+	if uploadErr != nil {
+		return nil, uploadErr
+	}
+
+	release, uploadErr := streaming.reserveQuota(c, objectName, header.Size)
+	if uploadErr != nil {
+		return nil, uploadErr
+	}
+	defer release()
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, &uploadError{http.StatusBadRequest, "failed to read file: " + err.Error()}
+	}
 	defer file.Close()
 
-	objectName := header.Filename
 	fileSize := header.Size
 	contentType := header.Header.Get("Content-Type")
 	if contentType == "" {
 		contentType = "application/octet-stream"
 	}
+	// The declared type must be allowed, and so must the one the content looks
+	// like, unless it is too unusual to recognize
+	if len(streaming.allowedTypes) > 0 {
+		if !contentTypeAllowed(streaming.allowedTypes, contentType) {
+			return nil, &uploadError{http.StatusUnsupportedMediaType, "content type " + contentType + " is not allowed"}
+		}
+		sniffed, err := sniffContentType(file)
+		if err != nil {
+			return nil, &uploadError{http.StatusBadRequest, "failed to read file: " + err.Error()}
+		}
+		if !isGenericContentType(sniffed) && !contentTypeAllowed(streaming.allowedTypes, sniffed) {
+			return nil, &uploadError{http.StatusUnsupportedMediaType, "file content is " + sniffed + ", which is not allowed"}
+		}
+	}
+
+	// Refuse to overwrite an object that changed since the client last saw it
+	matchETag, ok := streaming.ifMatchETag(c, objectName)
+	if !ok {
+		return nil, &uploadError{http.StatusPreconditionFailed, "object has been modified"}
+	}
+
+	// Catch corruption in transit before anything is stored
+	if expectedMD5 != "" {
+		if uploadErr := verifyMD5(file, expectedMD5); uploadErr != nil {
+			return nil, uploadErr
+		}
+	}
+
+	// Scan before anything is stored, then rewind for the upload
+	clean, err := streaming.Scanner.Scan(file)
+	if err != nil {
+		log.Printf("Failed to scan %s: %v\n", objectName, err)
+		return nil, &uploadError{http.StatusInternalServerError, "could not scan file"}
+	}
+	if !clean {
+		log.Printf("Rejected infected upload %s\n", objectName)
+		return nil, &uploadError{http.StatusUnprocessableEntity, "file failed malware scan"}
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, &uploadError{http.StatusInternalServerError, "upload failed"}
+	}
+
+	// With an MD5 given MinIO verifies it too, covering the hop from here to storage
+	opts := minio.PutObjectOptions{
+		ContentType:    contentType,
+		SendContentMd5: expectedMD5 != "",
+		UserMetadata:   metadata,
+		PartSize:       streaming.partSize,
+	}
+	// A free name must still be free when the object is written, or someone
+	// else's upload could be replaced
+	if isNew {
+		opts.SetMatchETagExcept("*")
+	}
+	// MinIO checks If-Match again as it writes, so an overwrite that landed
+	// since the check above still fails
+	if matchETag != "" {
+		opts.SetMatchETag(matchETag)
+	}
 
 	// Upload to MinIO
+	ctx, span := startSpan(c.Request.Context(), "minio.PutObject", attribute.String("object", objectName))
 	info, err := streaming.PutObject(
-		context.Background(),
+		// Not the request context: an upload that reached MinIO is finished even if the client left
+		context.WithoutCancel(ctx),
 		bucketName,
 		objectName,
 		file,
 		fileSize,
-		minio.PutObjectOptions{ContentType: contentType},
+		opts,
 	)
+	endSpan(span, err)
+	streaming.stats.invalidate(objectName)
+	if isNew && isPreconditionFailed(err) {
+		return nil, &uploadError{http.StatusConflict, "object name is already taken"}
+	}
+	if isPreconditionFailed(err) {
+		return nil, &uploadError{http.StatusPreconditionFailed, "object has been modified"}
+	}
 	if err != nil {
 		log.Printf("Failed to upload %s: %v\n", objectName, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "upload failed"})
-		return
+		return nil, &uploadError{http.StatusInternalServerError, "upload failed"}
+	}
+
+	// Record the upload so the video can be listed and traced back to its owner
+	public := c.PostForm("public") == "true"
+	updates := []db.VideoSetParam{
+		db.Video.Size.Set(int(info.Size)),
+		db.Video.Etag.Set(info.ETag),
+		db.Video.ContentType.Set(contentType),
+		// An overwrite is kept for good unless it is given a lifetime of its own
+		db.Video.ExpiresAt.SetOptional(expiresAt),
+	}
+	// Overwrites keep the existing owner, and the existing visibility unless the form sets it
+	if _, ok := c.GetPostForm("public"); ok {
+		updates = append(updates, db.Video.Public.Set(public))
+	}
+	ctx, span = startSpan(c.Request.Context(), "prisma.Video.UpsertOne")
+	_, err = streaming.database.Video.UpsertOne(
+		db.Video.ObjectName.Equals(info.Key),
+	).Create(
+		db.Video.ObjectName.Set(info.Key),
+		db.Video.Size.Set(int(info.Size)),
+		db.Video.ContentType.Set(contentType),
+		db.Video.Uploader.Link(db.User.Email.Equals(c.GetString("email"))),
+		db.Video.Public.Set(public),
+		db.Video.Etag.Set(info.ETag),
+		db.Video.ExpiresAt.SetOptional(expiresAt),
+	).Update(updates...).Exec(ctx)
+	endSpan(span, err)
+	if err != nil {
+		log.Printf("Failed to record metadata for %s: %v\n", info.Key, err)
+		return nil, &uploadError{http.StatusInternalServerError, "upload failed"}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":     "upload successful",
+	result := gin.H{
 		"objectName":  info.Key,
 		"size":        info.Size,
 		"contentType": contentType,
 		"uploadTime":  info.LastModified,
-	})
+		"etag":        info.ETag,
+	}
+	if expiresAt != nil {
+		result["expiresAt"] = *expiresAt
+	}
+	return result, nil
+}
+
+// checkOverwrite refuses to store objectName over a video or object that is
+// not the authenticated user's. It reports whether the name is still free, in
+// which case the upload may only create the object.
+func (streaming *Streaming) checkOverwrite(c *gin.Context, objectName string) (bool, *uploadError) {
+	_, err := streaming.ownedVideo(c, objectName)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, db.ErrNotFound) {
+		log.Printf("Failed to look up video '%s': %v\n", objectName, err)
+		return false, &uploadError{http.StatusInternalServerError, "upload failed"}
+	}
+	taken, err := streaming.nameTaken(c, objectName)
+	if err != nil {
+		log.Printf("Failed to check name '%s': %v\n", objectName, err)
+		return false, &uploadError{http.StatusInternalServerError, "upload failed"}
+	}
+	if taken {
+		return false, &uploadError{http.StatusConflict, "object name is already taken"}
+	}
+	return true, nil
+}
+
+// verifyMD5 checks file against a base64 Content-MD5 value and rewinds it.
+func verifyMD5(file multipart.File, expectedMD5 string) *uploadError {
+	expected, err := base64.StdEncoding.DecodeString(expectedMD5)
+	if err != nil || len(expected) != md5.Size {
+		return &uploadError{http.StatusBadRequest, "invalid Content-MD5"}
+	}
+	hash := md5.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return &uploadError{http.StatusBadRequest, "failed to read file: " + err.Error()}
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return &uploadError{http.StatusInternalServerError, "upload failed"}
+	}
+	if !bytes.Equal(hash.Sum(nil), expected) {
+		return &uploadError{http.StatusBadRequest, "Content-MD5 mismatch"}
+	}
+	return nil
 }
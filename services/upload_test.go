@@ -0,0 +1,42 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestUploadConcurrencyLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	streaming := &Streaming{uploads: semaphore.NewWeighted(1)}
+	upload := func(handler func(*gin.Context)) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/video/upload", nil)
+		handler(c)
+		return w
+	}
+
+	streaming.uploads.TryAcquire(1)
+	for name, handler := range map[string]func(*gin.Context){
+		"single": streaming.UploadVideo,
+		"batch":  streaming.UploadVideoBatch,
+	} {
+		w := upload(handler)
+		if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "5" {
+			t.Fatalf("%s upload over the limit: got %d, Retry-After %q", name, w.Code, w.Header().Get("Retry-After"))
+		}
+	}
+
+	// Once a slot frees up the upload is read, and this one has no form
+	streaming.uploads.Release(1)
+	if w := upload(streaming.UploadVideo); w.Code != http.StatusBadRequest {
+		t.Fatalf("upload under the limit: got %d, want 400", w.Code)
+	}
+	if !streaming.uploads.TryAcquire(1) {
+		t.Fatal("upload slot not released")
+	}
+}
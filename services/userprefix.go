@@ -0,0 +1,74 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"db"
+	"middlewares"
+)
+
+// userKeyPrefix is the key prefix of email's videos: users/ followed by a hash
+// of the address, so keys do not reveal it.
+func userKeyPrefix(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(email)))
+	return "users/" + hex.EncodeToString(sum[:16]) + "/"
+}
+
+// scopedKey places objectName under the authenticated user's prefix when
+// per-user prefixes are on. Names already under it are kept as they are.
+func (streaming *Streaming) scopedKey(c *gin.Context, objectName string) string {
+	if !streaming.userPrefixes {
+		return objectName
+	}
+	prefix := userKeyPrefix(c.GetString("email"))
+	if strings.HasPrefix(objectName, prefix) {
+		return objectName
+	}
+	return prefix + objectName
+}
+
+// ownedKeys returns the keys of the authenticated user's videos, which bound
+// object listings when per-user prefixes are off. With prefixes on it returns
+// nil: the prefix alone keeps listings to the user's own keys.
+func (streaming *Streaming) ownedKeys(c *gin.Context) (map[string]bool, error) {
+	if streaming.userPrefixes {
+		return nil, nil
+	}
+	ctx, span := startSpan(c.Request.Context(), "prisma.Video.FindMany")
+	videos, err := streaming.database.Video.FindMany(
+		db.Video.Uploader.Where(db.User.Email.Equals(c.GetString("email"))),
+	).Exec(ctx)
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	owned := make(map[string]bool, len(videos))
+	for _, video := range videos {
+		owned[video.ObjectName] = true
+	}
+	return owned, nil
+}
+
+// inUserScope reports whether objectName lies under the authenticated user's
+// prefix. Everything is in scope when per-user prefixes are off.
+func (streaming *Streaming) inUserScope(c *gin.Context, objectName string) bool {
+	return !streaming.userPrefixes || strings.HasPrefix(objectName, userKeyPrefix(c.GetString("email")))
+}
+
+// RequireUserScope answers 404 on routes reading the objectName query
+// parameter when it lies outside the authenticated user's prefix, as if the
+// video did not exist.
+func (streaming *Streaming) RequireUserScope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !streaming.inUserScope(c, c.Query("objectName")) {
+			middlewares.AbortWithError(c, http.StatusNotFound, middlewares.CodeNotFound, "video not found")
+			return
+		}
+		c.Next()
+	}
+}